@@ -0,0 +1,147 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Alertmanager = "alertmanager"
+
+	alertmanagerAlertsPath = "/api/v2/alerts"
+)
+
+// AlertmanagerSink forwards enriched alerts with all alertsforge_* labels to downstream alertmanagers,
+// so their routing and inhibition keep working. Firing alerts are posted with EndsAt in the future and
+// have to be posted again before it, this is done by resink which must be more frequent than ttl
+type AlertmanagerSink struct {
+	name     string
+	urls     []string
+	user     string
+	password string
+	token    string
+	ttl      time.Duration
+	client   *http.Client
+	retry    RetryPolicy
+}
+
+// postableAlert is alert of alertmanager api v2
+type postableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     time.Time         `json:"startsAt,omitempty"`
+	EndsAt       time.Time         `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// NewAlertmanagerSink creates alertmanager sink from sink config: urls is required comma separated list of
+// alertmanager base urls, alerts are accepted if at least one of them accepted them as alertmanagers of
+// the same cluster share alerts. ttl is how long firing alert lives without repost, defaults to 3 resinks,
+// it's an error if AF_RESINK_TIME is not set or not less than ttl as firing alerts are reposted only by resink
+func NewAlertmanagerSink(sink config.Sink) (*AlertmanagerSink, error) {
+	a := &AlertmanagerSink{
+		name:     sink.Name,
+		user:     sharedtools.MustTemplateString(sink.Config["user"], nil, ""),
+		password: sharedtools.MustTemplateString(sink.Config["password"], nil, ""),
+		token:    sharedtools.MustTemplateString(sink.Config["token"], nil, ""),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		retry:    retryPolicyFromConfig(sink.Config),
+	}
+	for _, url := range splitList(sharedtools.MustTemplateString(sink.Config["urls"], nil, "")) {
+		a.urls = append(a.urls, strings.TrimSuffix(url, "/")+alertmanagerAlertsPath)
+	}
+	if len(a.urls) == 0 {
+		return nil, fmt.Errorf("alertmanager sink %s requires urls", sink.Name)
+	}
+
+	resink, resinkErr := time.ParseDuration(os.Getenv("AF_RESINK_TIME"))
+	a.ttl = 3 * resink
+	if ttl, err := time.ParseDuration(sink.Config["ttl"]); err == nil && ttl > 0 {
+		a.ttl = ttl
+	}
+	if resinkErr != nil || resink <= 0 || resink >= a.ttl {
+		return nil, fmt.Errorf("alertmanager sink %s requires AF_RESINK_TIME less than ttl %s, otherwise firing alerts expire in alertmanager", sink.Name, a.ttl)
+	}
+	return a, nil
+}
+
+func (a *AlertmanagerSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errs []error) {
+	if len(alerts) == 0 {
+		return
+	}
+	now := time.Now()
+	postable := make([]postableAlert, 0, len(alerts))
+	for _, alert := range alerts {
+		postable = append(postable, a.postableAlert(alert, now))
+	}
+	body, err := json.Marshal(postable)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	sent := false
+	for _, url := range a.urls {
+		if err := a.post(url, body); err != nil {
+			zap.S().Errorf("can't send alerts to alertmanager %s of sink %s: %s", url, a.name, err)
+			errs = append(errs, err)
+			continue
+		}
+		sent = true
+	}
+	if !sent {
+		return nil, nil, []error{errors.Join(errs...)}
+	}
+	for _, alert := range alerts {
+		if alert.Status == sharedtools.Resolved {
+			resolved = append(resolved, alert.Fingerprint)
+		} else {
+			accepted = append(accepted, alert.Fingerprint)
+		}
+	}
+	return accepted, resolved, nil
+}
+
+// postableAlert sets EndsAt of firing alert to ttl from now, resolved alert keeps its EndsAt if it's in the past
+func (a *AlertmanagerSink) postableAlert(alert sharedtools.Alert, now time.Time) postableAlert {
+	postable := postableAlert{
+		Labels:       alert.Labels,
+		Annotations:  alert.Annotations,
+		StartsAt:     alert.StartsAt,
+		EndsAt:       now.Add(a.ttl),
+		GeneratorURL: alert.GeneratorURL,
+	}
+	if alert.Status == sharedtools.Resolved {
+		postable.EndsAt = alert.EndsAt
+		if postable.EndsAt.IsZero() || postable.EndsAt.After(now) {
+			postable.EndsAt = now
+		}
+	}
+	return postable
+}
+
+func (a *AlertmanagerSink) post(url string, body []byte) error {
+	_, err := sendWithRetry(a.client, a.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		if a.user != "" {
+			req.SetBasicAuth(a.user, a.password)
+		} else if a.token != "" {
+			req.Header.Add("Authorization", "Bearer "+a.token)
+		}
+		return req, nil
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertmanagerSink_SendAlerts(t *testing.T) {
+	t.Setenv("AF_RESINK_TIME", "5m")
+	received := []postableAlert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v2/alerts", r.URL.Path)
+		assert.Equal(t, "Bearer am-token", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer down.Close()
+
+	sink, err := NewAlertSink(config.Sink{Name: "am", Type: Alertmanager, Config: map[string]string{
+		"urls":  down.URL + "," + server.URL + "/",
+		"token": "am-token",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, sink.(*AlertmanagerSink).ttl)
+
+	startsAt := time.Now().Add(-time.Hour)
+	endsAt := time.Now().Add(-time.Minute)
+	labels := map[string]string{"alertname": "HighCPU", "alertsforge_grafana_pod_cpu": "2024-06-05/cpu.png"}
+	accepted, resolved, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Pending, Labels: labels, StartsAt: startsAt, GeneratorURL: "http://prometheus/graph"},
+		{Fingerprint: "2", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "DiskFull"}, StartsAt: startsAt, EndsAt: endsAt},
+		{Fingerprint: "3", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "DiskFull"}, StartsAt: startsAt},
+	})
+	// one of alertmanagers accepted alerts
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	assert.Equal(t, []string{"2", "3"}, resolved)
+
+	require.Len(t, received, 3)
+	assert.Equal(t, labels, received[0].Labels)
+	assert.Equal(t, "http://prometheus/graph", received[0].GeneratorURL)
+	assert.True(t, received[0].StartsAt.Equal(startsAt))
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), received[0].EndsAt, time.Minute)
+	assert.True(t, received[1].EndsAt.Equal(endsAt))
+	assert.WithinDuration(t, time.Now(), received[2].EndsAt, time.Minute)
+}
+
+func TestAlertmanagerSink_Errors(t *testing.T) {
+	noSleep(t)
+	_, err := NewAlertmanagerSink(config.Sink{Name: "am", Type: Alertmanager})
+	assert.Error(t, err)
+
+	// firing alerts would expire before resink reposts them
+	t.Setenv("AF_RESINK_TIME", "")
+	_, err = NewAlertmanagerSink(config.Sink{Name: "am", Type: Alertmanager, Config: map[string]string{"urls": "http://127.0.0.1:1", "ttl": "1h"}})
+	assert.Error(t, err)
+	t.Setenv("AF_RESINK_TIME", "1h")
+	_, err = NewAlertmanagerSink(config.Sink{Name: "am", Type: Alertmanager, Config: map[string]string{"urls": "http://127.0.0.1:1", "ttl": "1h"}})
+	assert.Error(t, err)
+
+	t.Setenv("AF_RESINK_TIME", "20m")
+	sink, err := NewAlertmanagerSink(config.Sink{Name: "am", Type: Alertmanager, Config: map[string]string{"urls": "http://127.0.0.1:1", "ttl": "1h"}})
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, sink.ttl)
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, accepted)
+	assert.Len(t, errs, 1)
+}
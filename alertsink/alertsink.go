@@ -1,6 +1,8 @@
 package alertsink
 
 import (
+	"fmt"
+
 	"github.com/mobalyticshq/alertsforge/config"
 	"github.com/mobalyticshq/alertsforge/sharedtools"
 )
@@ -13,6 +15,29 @@ const (
 	Oncall = "oncall"
 )
 
-func NewAlertSink(sinkName string, runbooks *config.RunbooksConfig) SinkInterface {
-	return NewOncallSink(runbooks)
+// NewAlertSink creates sink of sink.Type
+func NewAlertSink(sink config.Sink, runbooks *config.RunbooksConfig) (SinkInterface, error) {
+	switch sink.Type {
+	case Oncall:
+		return NewOncallSink(sink, runbooks)
+	case Slack:
+		return NewSlackSink(sink, runbooks)
+	case PagerDuty:
+		return NewPagerDutySink(sink, runbooks)
+	case Opsgenie:
+		return NewOpsgenieSink(sink, runbooks)
+	case Webhook:
+		return NewWebhookSink(sink, runbooks)
+	case Email:
+		return NewEmailSink(sink, runbooks)
+	case Telegram:
+		return NewTelegramSink(sink, runbooks)
+	case Teams:
+		return NewTeamsSink(sink, runbooks)
+	case Jira:
+		return NewJiraSink(sink, runbooks)
+	case Alertmanager:
+		return NewAlertmanagerSink(sink)
+	}
+	return nil, fmt.Errorf("unknown type %q of sink %s", sink.Type, sink.Name)
 }
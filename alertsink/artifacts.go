@@ -0,0 +1,106 @@
+package alertsink
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"golang.org/x/exp/maps"
+)
+
+// dashboardURLSuffix is the suffix of label with dashboard of grafana image, like static enricher adds
+// alertsforge_grafana_pod_memory_dashboard_url for alertsforge_grafana_pod_memory
+const dashboardURLSuffix = "_dashboard_url"
+
+// maxArtifactSize limits size of images downloaded to be attached to messages
+const maxArtifactSize = 5 << 20
+
+type Link struct {
+	Href string `json:"href"`
+	Text string `json:"text,omitempty"`
+}
+
+type Image struct {
+	Src  string `json:"src"`
+	Href string `json:"href,omitempty"`
+	Alt  string `json:"alt,omitempty"`
+	// Path is the object name in artifacts bucket, empty for external images
+	Path string `json:"-"`
+}
+
+// alertArtifacts finds results of enrichers in labels and annotations of alert: png files written by grafana enricher
+// become images, txt files written by command enricher and http urls in *_url labels become links.
+// Paths of files in bucket are prefixed with artifactsURL, they are skipped if it's empty
+func alertArtifacts(alert sharedtools.Alert, artifactsURL string) (links []Link, images []Image) {
+	artifactsURL = strings.TrimSuffix(artifactsURL, "/")
+	values := sharedtools.CopyMap(alert.Annotations)
+	sharedtools.MergeMaps(values, alert.Labels)
+	keys := maps.Keys(values)
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := strings.TrimSpace(values[key])
+		external := strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+		href := value
+		if !external {
+			if artifactsURL == "" || strings.ContainsAny(value, " \n") {
+				continue
+			}
+			href = artifactsURL + "/" + strings.TrimPrefix(value, "/")
+		}
+
+		switch {
+		case strings.HasSuffix(value, ".png"):
+			image := Image{Src: href, Href: values[key+dashboardURLSuffix], Alt: key}
+			if !external {
+				image.Path = value
+			}
+			images = append(images, image)
+		case strings.HasSuffix(value, ".txt"):
+			links = append(links, Link{Href: href, Text: key})
+		case external && strings.HasSuffix(key, "_url"):
+			links = append(links, Link{Href: href, Text: key})
+		}
+	}
+	if alert.GeneratorURL != "" {
+		links = append(links, Link{Href: alert.GeneratorURL, Text: "source"})
+	}
+	return
+}
+
+// groupArtifacts returns artifacts of all firing alerts of group without duplicates
+func groupArtifacts(alerts []sharedtools.Alert, artifactsURL string) (links []Link, images []Image) {
+	seen := map[string]bool{}
+	for _, alert := range alerts {
+		alertLinks, alertImages := alertArtifacts(alert, artifactsURL)
+		for _, link := range alertLinks {
+			if !seen[link.Href] {
+				seen[link.Href] = true
+				links = append(links, link)
+			}
+		}
+		for _, image := range alertImages {
+			if !seen[image.Src] {
+				seen[image.Src] = true
+				images = append(images, image)
+			}
+		}
+	}
+	return
+}
+
+// fetchArtifact downloads artifact to attach it to message for sinks which can't refer images by url
+func fetchArtifact(client *http.Client, src string) ([]byte, error) {
+	res, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if !isSuccessStatus(res.StatusCode) {
+		return nil, fmt.Errorf("unexpected status code %d from %s", res.StatusCode, src)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, maxArtifactSize))
+}
@@ -0,0 +1,165 @@
+package alertsink
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultDeadLetterSize = 1000
+
+// DeadLetter is oncall request which was not delivered after all retries, there is one letter per integration
+// and title with the latest payload, so replay doesn't send outdated state of alert group
+type DeadLetter struct {
+	ID             string        `json:"id"`
+	IntegrationURL string        `json:"integrationUrl"`
+	Request        OncallRequest `json:"request"`
+	Error          string        `json:"error"`
+	Failures       int           `json:"failures"`
+	FirstFailedAt  time.Time     `json:"firstFailedAt"`
+	LastFailedAt   time.Time     `json:"lastFailedAt"`
+}
+
+// DeadLetterQueue is implemented by sinks which keep undelivered payloads for admin endpoint
+type DeadLetterQueue interface {
+	DeadLetters() []DeadLetter
+	// ReplayDeadLetters sends letters with ids again, all letters are sent if ids are empty
+	ReplayDeadLetters(ids []string) (replayed []string, errors []error)
+}
+
+// deadLetterQueue keeps dead letters in order of the first failure, the oldest are dropped above size,
+// letters are saved to json file if path is set
+type deadLetterQueue struct {
+	path    string
+	size    int
+	letters []DeadLetter
+	mutex   sync.Mutex
+}
+
+func newDeadLetterQueue(path string, size int) *deadLetterQueue {
+	if size <= 0 {
+		size = defaultDeadLetterSize
+	}
+	queue := &deadLetterQueue{path: path, size: size}
+	if path == "" {
+		return queue
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.S().Errorf("can't read dead letters from %s: %s", path, err)
+		}
+		return queue
+	}
+	if err := json.Unmarshal(data, &queue.letters); err != nil {
+		zap.S().Errorf("can't parse dead letters from %s: %s", path, err)
+		queue.letters = nil
+	}
+	return queue
+}
+
+func deadLetterID(integrationURL, title string) string {
+	hash := sha256.Sum256([]byte(integrationURL + "\n" + title))
+	return fmt.Sprintf("%x", hash[:8])
+}
+
+// add stores request or replaces payload of the letter with the same integration and title
+func (q *deadLetterQueue) add(integrationURL string, request OncallRequest, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := time.Now()
+	id := deadLetterID(integrationURL, request.Title)
+	for i := range q.letters {
+		if q.letters[i].ID == id {
+			q.letters[i].Request = request
+			q.letters[i].Error = err.Error()
+			q.letters[i].Failures++
+			q.letters[i].LastFailedAt = now
+			q.save()
+			return
+		}
+	}
+	q.letters = append(q.letters, DeadLetter{
+		ID:             id,
+		IntegrationURL: integrationURL,
+		Request:        request,
+		Error:          err.Error(),
+		Failures:       1,
+		FirstFailedAt:  now,
+		LastFailedAt:   now,
+	})
+	if len(q.letters) > q.size {
+		zap.S().Warnf("dead letter queue is full, dropping %d oldest letters", len(q.letters)-q.size)
+		q.letters = q.letters[len(q.letters)-q.size:]
+	}
+	q.save()
+}
+
+// remove deletes letter of integration and title, it's done when newer payload is delivered
+func (q *deadLetterQueue) remove(integrationURL, title string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	id := deadLetterID(integrationURL, title)
+	for i := range q.letters {
+		if q.letters[i].ID == id {
+			q.letters = append(q.letters[:i], q.letters[i+1:]...)
+			q.save()
+			return
+		}
+	}
+}
+
+// replayFailed counts failed replay, payload is kept as it may be updated while replaying
+func (q *deadLetterQueue) replayFailed(letter DeadLetter, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i := range q.letters {
+		if q.letters[i].ID == letter.ID {
+			q.letters[i].Error = err.Error()
+			q.letters[i].Failures++
+			q.letters[i].LastFailedAt = time.Now()
+			q.save()
+			return
+		}
+	}
+}
+
+// removeReplayed deletes replayed letter unless it was updated by newer failure while replaying
+func (q *deadLetterQueue) removeReplayed(letter DeadLetter) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i := range q.letters {
+		if q.letters[i].ID == letter.ID && q.letters[i].LastFailedAt.Equal(letter.LastFailedAt) {
+			q.letters = append(q.letters[:i], q.letters[i+1:]...)
+			q.save()
+			return
+		}
+	}
+}
+
+func (q *deadLetterQueue) list() []DeadLetter {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]DeadLetter{}, q.letters...)
+}
+
+func (q *deadLetterQueue) save() {
+	if q.path == "" {
+		return
+	}
+	data, err := json.Marshal(q.letters)
+	if err != nil {
+		zap.S().Errorf("can't marshal dead letters: %s", err)
+		return
+	}
+	if err := writeFileAtomic(q.path, data); err != nil {
+		zap.S().Errorf("can't write dead letters: %s", err)
+	}
+}
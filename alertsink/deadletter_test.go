@@ -0,0 +1,124 @@
+package alertsink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOncallSetter_Status(t *testing.T) {
+	delays := noSleep(t)
+	var requests, status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+	setter := &OncallSetter{client: server.Client(), retry: RetryPolicy{Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 10 * time.Second}}
+
+	status.Store(http.StatusServiceUnavailable)
+	err := setter.doOncallIncident(server.URL, OncallRequest{Title: "HighCPU"})
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.Response.StatusCode)
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second}, *delays)
+
+	// client errors are not retried
+	requests.Store(0)
+	status.Store(http.StatusBadRequest)
+	assert.Error(t, setter.doOncallIncident(server.URL, OncallRequest{Title: "HighCPU"}))
+	assert.Equal(t, int32(1), requests.Load())
+
+	status.Store(http.StatusOK)
+	assert.NoError(t, setter.doOncallIncident(server.URL, OncallRequest{Title: "HighCPU"}))
+}
+
+func TestOncallSink_DeadLetters(t *testing.T) {
+	noSleep(t)
+	server := newFakeOncall(t)
+	server.IntegrationStatus = http.StatusInternalServerError
+	integrationURL := server.IntegrationURL("test")
+
+	deadLetterPath := filepath.Join(t.TempDir(), "deadletters.json")
+	newSink := func() *OncallSink {
+		t.Setenv("AF_ONCALL_INTEGRATION_URL", integrationURL)
+		sinkRunbooks := config.RunbooksConfig{OncallMessage: config.OncallMessage{Title: "{{ .Labels.alertname }}"}}
+		sink, err := NewOncallSink(config.Sink{Name: "oncall", Type: Oncall, Config: map[string]string{"deadLetterPath": deadLetterPath, "retryAttempts": "2"}}, &sinkRunbooks)
+		require.NoError(t, err)
+		return sink
+	}
+	sink := newSink()
+	alert := sharedtools.Alert{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}, Annotations: map[string]string{}}
+
+	// failed request is not accepted and is kept once with the latest payload
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{alert})
+	assert.Empty(t, accepted)
+	assert.Len(t, errs, 1)
+	sink.SendAlerts([]sharedtools.Alert{alert})
+	letters := sink.DeadLetters()
+	require.Len(t, letters, 1)
+	assert.Equal(t, 2, letters[0].Failures)
+	assert.Equal(t, integrationURL, letters[0].IntegrationURL)
+	assert.Equal(t, "DiskFull", letters[0].Request.Title)
+	assert.Contains(t, letters[0].Error, "500")
+
+	// queue survives restart, failed replay keeps letter
+	sink = newSink()
+	replayed, errs := sink.ReplayDeadLetters(nil)
+	assert.Empty(t, replayed)
+	assert.Len(t, errs, 1)
+	require.Len(t, sink.DeadLetters(), 1)
+	assert.Equal(t, 3, sink.DeadLetters()[0].Failures)
+
+	server.IntegrationStatus = http.StatusOK
+	replayed, errs = sink.ReplayDeadLetters([]string{"unknown"})
+	assert.Empty(t, replayed)
+	assert.Empty(t, errs)
+	replayed, errs = sink.ReplayDeadLetters([]string{letters[0].ID})
+	assert.Equal(t, []string{letters[0].ID}, replayed)
+	assert.Empty(t, errs)
+	assert.Empty(t, newSink().DeadLetters())
+
+	// delivered payload removes letter of the group
+	server.IntegrationStatus = http.StatusBadGateway
+	sink.SendAlerts([]sharedtools.Alert{alert})
+	assert.Len(t, sink.DeadLetters(), 1)
+	server.IntegrationStatus = http.StatusOK
+	accepted, _, errs = sink.SendAlerts([]sharedtools.Alert{alert})
+	assert.Equal(t, []string{"1"}, accepted)
+	assert.Empty(t, errs)
+	assert.Empty(t, sink.DeadLetters())
+}
+
+func TestDeadLetterQueue_Size(t *testing.T) {
+	queue := newDeadLetterQueue("", 2)
+	for _, title := range []string{"a", "b", "c"} {
+		queue.add("http://oncall", OncallRequest{Title: title}, assert.AnError)
+	}
+	letters := queue.list()
+	require.Len(t, letters, 2)
+	assert.Equal(t, "b", letters[0].Request.Title)
+	assert.Equal(t, "c", letters[1].Request.Title)
+}
+
+func TestSinkStatePath(t *testing.T) {
+	sink := config.Sink{Name: "oncall", Config: map[string]string{}}
+	t.Setenv("AF_BUFFER_PATH", "")
+	assert.Empty(t, sinkStatePath(sink, "deadLetterPath", "deadletters"))
+
+	t.Setenv("AF_BUFFER_PATH", "/data/buffer.jsonl")
+	assert.Equal(t, "/data/oncall-deadletters.json", sinkStatePath(sink, "deadLetterPath", "deadletters"))
+
+	sink.Config["deadLetterPath"] = "/var/lib/alertsforge/letters.json"
+	assert.Equal(t, "/var/lib/alertsforge/letters.json", sinkStatePath(sink, "deadLetterPath", "deadletters"))
+}
@@ -0,0 +1,413 @@
+package alertsink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Email = "email"
+
+	defaultEmailPort    = "587"
+	defaultEmailSubject = `{{ if .FiringAlerts }}[FIRING:{{ len .FiringAlerts }}]{{ else }}[RESOLVED]{{ end }} {{ .Title }}`
+	defaultEmailText    = `{{- range .FiringAlerts }}
+FIRING {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}
+{{- range .ResolvedAlerts }}
+RESOLVED {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}`
+	defaultEmailHTML = `<h3>{{ .Title }}</h3>
+{{- range .FiringAlerts }}
+<p><b>FIRING</b> {{ .Labels.alertname }} {{ .Annotations.description }}</p>
+{{- end }}
+{{- range .ResolvedAlerts }}
+<p><b>RESOLVED</b> {{ .Labels.alertname }} {{ .Annotations.description }}</p>
+{{- end }}`
+
+	emailTLSStartTLS = "starttls"
+	emailTLSImplicit = "tls"
+	emailTLSNone     = "none"
+
+	emailMessageIDRef = "email_message_id"
+)
+
+// EmailSink sends mail per alert group change, all mails of the group are replies to the first firing mail
+// so mail clients show them as one thread. Grafana images of the group are embedded inline
+type EmailSink struct {
+	runbooks     *config.RunbooksConfig
+	name         string
+	from         string
+	to           string
+	subject      string
+	html         string
+	text         string
+	artifactsURL string
+	inlineImages bool
+	client       *http.Client
+	sender       emailSenderInterface
+	groups       *groupStore
+}
+
+type emailSenderInterface interface {
+	sendMail(from string, to []string, message []byte) error
+}
+
+// smtpSender sends mail with STARTTLS (default), implicit tls or plain connection and PLAIN auth if username is set
+type smtpSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	tlsMode  string
+	retry    RetryPolicy
+}
+
+// NewEmailSink creates email sink from sink config: host, from and to are required, to is comma separated list
+// rendered per group; subject, html and text are templates over AlertTemplate of the group, values in html
+// are escaped, html defaults to oncall_message.web_message and text to oncall_message.simple_message
+func NewEmailSink(sink config.Sink, runbooks *config.RunbooksConfig) (*EmailSink, error) {
+	sender := &smtpSender{
+		host:     sharedtools.MustTemplateString(sink.Config["host"], nil, ""),
+		port:     sharedtools.MustTemplateString(sink.Config["port"], nil, ""),
+		username: sharedtools.MustTemplateString(sink.Config["username"], nil, ""),
+		password: sharedtools.MustTemplateString(sink.Config["password"], nil, ""),
+		tlsMode:  strings.ToLower(sink.Config["tls"]),
+		retry:    retryPolicyFromConfig(sink.Config),
+	}
+	e := &EmailSink{
+		runbooks:     runbooks,
+		name:         sink.Name,
+		from:         sharedtools.MustTemplateString(sink.Config["from"], nil, ""),
+		to:           sink.Config["to"],
+		subject:      sink.Config["subject"],
+		html:         sink.Config["html"],
+		text:         sink.Config["text"],
+		artifactsURL: sink.Config["artifactsUrl"],
+		inlineImages: sink.Config["inlineImages"] != "false",
+		client:       &http.Client{Timeout: 10 * time.Second},
+		sender:       sender,
+		groups:       newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if sender.host == "" || e.from == "" || e.to == "" {
+		return nil, fmt.Errorf("email sink %s requires host, from and to", sink.Name)
+	}
+	if sender.port == "" {
+		sender.port = defaultEmailPort
+	}
+	switch sender.tlsMode {
+	case "":
+		sender.tlsMode = emailTLSStartTLS
+	case emailTLSStartTLS, emailTLSImplicit, emailTLSNone:
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q of email sink %s", sender.tlsMode, sink.Name)
+	}
+	if e.subject == "" {
+		e.subject = defaultEmailSubject
+	}
+	if e.html == "" {
+		e.html = defaultEmailHTML
+		if runbooks.OncallMessage.WebMessage != "" {
+			e.html = `<h3>{{ .Title }}</h3><div style="white-space: pre-wrap">` + runbooks.OncallMessage.WebMessage + `</div>`
+		}
+	}
+	if e.text == "" {
+		e.text = defaultEmailText
+		if runbooks.OncallMessage.SimpleMessage != "" {
+			e.text = runbooks.OncallMessage.SimpleMessage
+		}
+	}
+	return e, nil
+}
+
+func (e *EmailSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(e.runbooks, alerts, "") {
+		group := e.groups.get(batch.Key, batch.Title)
+		group.merge(batch.Alerts)
+		if e.groups.unknownResolved(group) {
+			log.Warnf("resolved alert group %s is unknown to email sink %s, its message can't be updated without stored state", group.Key, e.name)
+			_, resolvedInGroup := batchResult(batch.Alerts)
+			resolved = append(resolved, resolvedInGroup...)
+			continue
+		}
+
+		if err := e.sendGroup(group); err != nil {
+			log.Errorf("can't send alert group %s to email sink %s: %s", batch.Key, e.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		e.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (e *EmailSink) sendGroup(group *AlertGroup) error {
+	variables := group.Template()
+	to := splitList(sharedtools.MustTemplateString(e.to, variables, ""))
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients for alert group %s", group.Key)
+	}
+
+	messageID := e.messageID(group.Key)
+	headers := textproto.MIMEHeader{}
+	headers.Set("From", e.from)
+	headers.Set("To", strings.Join(to, ", "))
+	headers.Set("Subject", mime.QEncoding.Encode("utf-8", sharedtools.MustTemplateString(e.subject, variables, group.Title)))
+	headers.Set("Date", time.Now().Format(time.RFC1123Z))
+	headers.Set("Message-ID", messageID)
+	headers.Set("MIME-Version", "1.0")
+	// replies to the first mail of the group keep all mails about it in one thread
+	if thread := group.Refs[emailMessageIDRef]; thread != "" {
+		headers.Set("In-Reply-To", thread)
+		headers.Set("References", thread)
+	}
+
+	html := sharedtools.MustHTMLTemplateString(e.html, variables, "error while parsing html message")
+	text := sharedtools.MustTemplateString(e.text, variables, "error while parsing text message")
+	message, err := e.buildMessage(headers, html, text, variables.FiringAlerts)
+	if err != nil {
+		return err
+	}
+	envelopeFrom := e.from
+	if address, err := mail.ParseAddress(e.from); err == nil {
+		envelopeFrom = address.Address
+	}
+	if err := e.sender.sendMail(envelopeFrom, to, message); err != nil {
+		return err
+	}
+	if group.Refs[emailMessageIDRef] == "" {
+		group.Refs[emailMessageIDRef] = messageID
+	}
+	return nil
+}
+
+func (e *EmailSink) messageID(key string) string {
+	domain := "alertsforge"
+	if _, host, found := strings.Cut(e.from, "@"); found {
+		domain = strings.TrimSuffix(host, ">")
+	}
+	hash := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("<%x.%d@%s>", hash[:8], time.Now().UnixNano(), domain)
+}
+
+// inlineImage is grafana image attached to the mail, html refers it by cid
+type inlineImage struct {
+	Image
+	ContentID string
+	Data      []byte
+}
+
+// buildMessage builds multipart/alternative mail with text and html parts,
+// html part is multipart/related with images whose urls in html are replaced with cid references
+func (e *EmailSink) buildMessage(headers textproto.MIMEHeader, htmlBody, text string, firing []sharedtools.Alert) ([]byte, error) {
+	images := []inlineImage{}
+	if e.inlineImages {
+		_, groupImages := groupArtifacts(firing, e.artifactsURL)
+		for i, image := range groupImages {
+			data, err := fetchArtifact(e.client, image.Src)
+			if err != nil {
+				zap.S().Warnf("can't fetch image %s for email sink %s: %s", image.Src, e.name, err)
+				continue
+			}
+			images = append(images, inlineImage{Image: image, ContentID: fmt.Sprintf("image%d@alertsforge", i), Data: data})
+		}
+	}
+	for _, image := range images {
+		// urls of values in html body are escaped by template
+		src := html.EscapeString(image.Src)
+		if strings.Contains(htmlBody, src) || strings.Contains(htmlBody, image.Src) {
+			htmlBody = strings.ReplaceAll(htmlBody, src, "cid:"+image.ContentID)
+			htmlBody = strings.ReplaceAll(htmlBody, image.Src, "cid:"+image.ContentID)
+			continue
+		}
+		htmlBody += fmt.Sprintf(`<p><a href="%s"><img style="max-width: 100%%" src="cid:%s" alt="%s"></a></p>`,
+			html.EscapeString(image.Href), image.ContentID, html.EscapeString(image.Alt))
+	}
+
+	message := &bytes.Buffer{}
+	alternative := multipart.NewWriter(message)
+	headers.Set("Content-Type", "multipart/alternative; boundary="+alternative.Boundary())
+	for name, values := range headers {
+		fmt.Fprintf(message, "%s: %s\r\n", name, strings.Join(values, ", "))
+	}
+	message.WriteString("\r\n")
+
+	if err := writeQuotedPart(alternative, "text/plain; charset=utf-8", text); err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		if err := writeQuotedPart(alternative, "text/html; charset=utf-8", htmlBody); err != nil {
+			return nil, err
+		}
+		if err := alternative.Close(); err != nil {
+			return nil, err
+		}
+		return message.Bytes(), nil
+	}
+
+	relatedBody := &bytes.Buffer{}
+	related := multipart.NewWriter(relatedBody)
+	if err := writeQuotedPart(related, "text/html; charset=utf-8", htmlBody); err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		part, err := related.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + image.ContentID + ">"},
+			"Content-Disposition":       {mime.FormatMediaType("inline", map[string]string{"filename": image.Alt + ".png"})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write([]byte(wrapBase64(image.Data))); err != nil {
+			return nil, err
+		}
+	}
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+	part, err := alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + related.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(relatedBody.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+	return message.Bytes(), nil
+}
+
+func writeQuotedPart(writer *multipart.Writer, contentType, body string) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	quoted := quotedprintable.NewWriter(part)
+	if _, err := quoted.Write([]byte(body)); err != nil {
+		return err
+	}
+	return quoted.Close()
+}
+
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	lines := []string{}
+	for len(encoded) > 76 {
+		lines = append(lines, encoded[:76])
+		encoded = encoded[76:]
+	}
+	lines = append(lines, encoded)
+	return strings.Join(lines, "\r\n")
+}
+
+func (s *smtpSender) sendMail(from string, to []string, message []byte) error {
+	attempts := s.retry.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			sleep(retryDelay(s.retry, attempt, err))
+		}
+		if err = s.send(from, to, message); err == nil || !isTemporarySMTPError(err) {
+			return err
+		}
+		zap.S().Warnf("sending mail via %s failed, attempt %d/%d: %s", s.host, attempt+1, attempts, err)
+	}
+	return err
+}
+
+func (s *smtpSender) send(from string, to []string, message []byte) error {
+	addr := net.JoinHostPort(s.host, s.port)
+	tlsConfig := &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if s.tlsMode == emailTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if s.tlsMode == emailTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s doesn't support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// isTemporarySMTPError is true for network errors and 4xx replies of smtp server
+func isTemporarySMTPError(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 400 && protoErr.Code < 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,215 @@
+package alertsink
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMail struct {
+	From    string
+	To      []string
+	Message *mail.Message
+}
+
+type fakeEmailSender struct {
+	mails []sentMail
+	err   error
+}
+
+func (f *fakeEmailSender) sendMail(from string, to []string, message []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(message)))
+	if err != nil {
+		return err
+	}
+	f.mails = append(f.mails, sentMail{From: from, To: to, Message: parsed})
+	return nil
+}
+
+// readParts returns content types and bodies of all leaf parts of multipart message
+func readParts(t *testing.T, contentType string, body io.Reader) map[string]string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err)
+	parts := map[string]string{}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		parts[mediaType] = string(data)
+		return parts
+	}
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.NoError(t, err)
+		for key, value := range readParts(t, part.Header.Get("Content-Type"), part) {
+			parts[key] = value
+		}
+		if id := part.Header.Get("Content-ID"); id != "" {
+			parts["content-id"] = id
+		}
+	}
+}
+
+func TestEmailSink_SendAlerts(t *testing.T) {
+	static := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2024-06-05/cpu.png", r.URL.Path)
+		w.Write([]byte("png"))
+	}))
+	defer static.Close()
+
+	runbooks := config.RunbooksConfig{OncallMessage: config.OncallMessage{
+		Title:      "{{ .Labels.alertname }}",
+		WebMessage: `{{ range .FiringAlerts }}<img src=` + static.URL + `/{{ .Labels.alertsforge_grafana_pod_cpu }}>{{ end }}`,
+	}}
+	sink, err := NewAlertSink(config.Sink{Name: "email", Type: Email, Config: map[string]string{
+		"host":         "smtp.example.com",
+		"from":         "Alertsforge <alerts@example.com>",
+		"to":           "oncall@example.com, {{ .Labels.team }}@example.com",
+		"artifactsUrl": static.URL,
+	}}, &runbooks)
+	require.NoError(t, err)
+	sender := &fakeEmailSender{}
+	sink.(*EmailSink).sender = sender
+
+	labels := map[string]string{"alertname": "HighCPU", "team": "devops", "alertsforge_grafana_pod_cpu": "2024-06-05/cpu.png"}
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Pending, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	require.Len(t, sender.mails, 1)
+
+	firing := sender.mails[0]
+	assert.Equal(t, "alerts@example.com", firing.From)
+	assert.Equal(t, "Alertsforge <alerts@example.com>", firing.Message.Header.Get("From"))
+	assert.Equal(t, []string{"oncall@example.com", "devops@example.com"}, firing.To)
+	assert.Equal(t, "[FIRING:1] HighCPU", firing.Message.Header.Get("Subject"))
+	assert.Contains(t, firing.Message.Header.Get("Message-ID"), "@example.com>")
+	assert.Empty(t, firing.Message.Header.Get("In-Reply-To"))
+	parts := readParts(t, firing.Message.Header.Get("Content-Type"), firing.Message.Body)
+	assert.Equal(t, "cG5n", parts["image/png"]) // base64 of png
+	assert.Equal(t, "<image0@alertsforge>", parts["content-id"])
+	assert.Contains(t, parts["text/html"], "<img src=cid:image0@alertsforge>")
+	assert.Contains(t, parts["text/plain"], "FIRING HighCPU")
+
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, sender.mails, 2)
+	reply := sender.mails[1].Message
+	assert.Equal(t, "[RESOLVED] HighCPU", reply.Header.Get("Subject"))
+	assert.Equal(t, firing.Message.Header.Get("Message-ID"), reply.Header.Get("In-Reply-To"))
+	assert.Equal(t, firing.Message.Header.Get("Message-ID"), reply.Header.Get("References"))
+	assert.Empty(t, sink.(*EmailSink).groups.groups)
+}
+
+func TestEmailSink_HTMLEscaping(t *testing.T) {
+	sink, err := NewEmailSink(config.Sink{Name: "email", Type: Email, Config: map[string]string{
+		"host": "smtp.example.com",
+		"from": "alerts@example.com",
+		"to":   "oncall@example.com",
+	}}, &config.RunbooksConfig{})
+	require.NoError(t, err)
+	sender := &fakeEmailSender{}
+	sink.sender = sender
+
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{
+		Fingerprint: "1",
+		Status:      sharedtools.Pending,
+		Labels:      map[string]string{"alertname": "HighCPU"},
+		Annotations: map[string]string{"description": `cpu > 90% & <script>alert("x")</script>`},
+	}})
+	assert.Empty(t, errs)
+	require.Len(t, sender.mails, 1)
+	parts := readParts(t, sender.mails[0].Message.Header.Get("Content-Type"), sender.mails[0].Message.Body)
+	assert.Contains(t, parts["text/html"], "<p><b>FIRING</b> HighCPU cpu &gt; 90% &amp; &lt;script&gt;")
+	assert.NotContains(t, parts["text/html"], "<script>")
+	assert.Contains(t, parts["text/plain"], `cpu > 90% & <script>`)
+}
+
+func TestNewEmailSink_Errors(t *testing.T) {
+	_, err := NewEmailSink(config.Sink{Name: "email", Type: Email, Config: map[string]string{"host": "smtp"}}, &slackRunbooks)
+	assert.Error(t, err)
+	_, err = NewEmailSink(config.Sink{Name: "email", Type: Email, Config: map[string]string{"host": "smtp", "from": "a@b", "to": "c@d", "tls": "ssl"}}, &slackRunbooks)
+	assert.Error(t, err)
+}
+
+// fakeSMTPServer accepts one plain text session and returns received commands and data
+func fakeSMTPServer(t *testing.T) (host, port string, received chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	received = make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		lines := []string{}
+		reader := bufio.NewReader(conn)
+		write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		write("220 localhost ESMTP")
+		data := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				received <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch {
+			case data && line == ".":
+				data = false
+				write("250 queued")
+			case data:
+			case strings.HasPrefix(line, "EHLO"):
+				write("250 localhost")
+			case strings.HasPrefix(line, "DATA"):
+				data = true
+				write("354 go ahead")
+			case strings.HasPrefix(line, "QUIT"):
+				write("221 bye")
+				received <- lines
+				return
+			default:
+				write("250 ok")
+			}
+		}
+	}()
+	host, port, err = net.SplitHostPort(listener.Addr().String())
+	require.NoError(t, err)
+	return host, port, received
+}
+
+func TestSmtpSender_SendMail(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	sender := &smtpSender{host: host, port: port, tlsMode: emailTLSNone, retry: RetryPolicy{Attempts: 1}}
+	require.NoError(t, sender.sendMail("alerts@example.com", []string{"oncall@example.com"}, []byte("Subject: test\r\n\r\nbody\r\n")))
+	lines := <-received
+	assert.Contains(t, lines, "MAIL FROM:<alerts@example.com>")
+	assert.Contains(t, lines, "RCPT TO:<oncall@example.com>")
+	assert.Contains(t, lines, "Subject: test")
+
+	// server without STARTTLS is rejected in default mode
+	host, port, _ = fakeSMTPServer(t)
+	sender = &smtpSender{host: host, port: port, tlsMode: emailTLSStartTLS, retry: RetryPolicy{Attempts: 1}}
+	assert.ErrorContains(t, sender.sendMail("alerts@example.com", []string{"oncall@example.com"}, []byte("body")), "STARTTLS")
+}
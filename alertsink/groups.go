@@ -0,0 +1,252 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+// groupAlertsByTitle groups alerts by rendered oncall_message title, like oncall does with alert groups
+func groupAlertsByTitle(runbooks *config.RunbooksConfig, alerts []sharedtools.Alert) map[string][]sharedtools.Alert {
+	groupedAlerts := map[string][]sharedtools.Alert{}
+	for _, alert := range alerts {
+		variables := AlertTemplate{
+			Labels:      alert.Labels,
+			Annotations: alert.Annotations,
+		}
+		title := sharedtools.MustTemplateString(runbooks.OncallMessage.Title, variables, "error while parsing title")
+		groupedAlerts[title] = append(groupedAlerts[title], alert)
+	}
+	return groupedAlerts
+}
+
+// alertBatch is a part of alerts sent to sink which belong to the same group
+type alertBatch struct {
+	Key    string
+	Title  string
+	Alerts []sharedtools.Alert
+}
+
+// groupAlertsByKey groups alerts by keyTemplate rendered over title, labels and annotations of alert,
+// alerts are grouped by title if keyTemplate is empty
+func groupAlertsByKey(runbooks *config.RunbooksConfig, alerts []sharedtools.Alert, keyTemplate string) []alertBatch {
+	batches := map[string]*alertBatch{}
+	keys := []string{}
+	for title, alertsWithTitle := range groupAlertsByTitle(runbooks, alerts) {
+		for _, alert := range alertsWithTitle {
+			key := title
+			if keyTemplate != "" {
+				variables := AlertTemplate{Title: title, Labels: alert.Labels, Annotations: alert.Annotations}
+				key = sharedtools.MustTemplateString(keyTemplate, variables, title)
+			}
+			if _, ok := batches[key]; !ok {
+				batches[key] = &alertBatch{Key: key, Title: title}
+				keys = append(keys, key)
+			}
+			batches[key].Alerts = append(batches[key].Alerts, alert)
+		}
+	}
+	sort.Strings(keys)
+	result := make([]alertBatch, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *batches[key])
+	}
+	return result
+}
+
+// AlertGroup is the state of alerts with the same key kept by sinks which update their messages,
+// Refs are sink specific ids of the message like slack ts
+type AlertGroup struct {
+	Key    string                       `json:"key"`
+	Title  string                       `json:"title"`
+	Alerts map[string]sharedtools.Alert `json:"alerts"`
+	Refs   map[string]string            `json:"refs,omitempty"`
+}
+
+func newAlertGroup(key, title string) *AlertGroup {
+	return &AlertGroup{Key: key, Title: title, Alerts: map[string]sharedtools.Alert{}, Refs: map[string]string{}}
+}
+
+// merge updates group with new alerts, pending alerts become firing
+func (g *AlertGroup) merge(alerts []sharedtools.Alert) {
+	for _, alert := range alerts {
+		if alert.Status == sharedtools.Pending {
+			alert.Status = sharedtools.Firing
+		}
+		g.Alerts[alert.Fingerprint] = alert
+	}
+}
+
+func (g *AlertGroup) Resolved() bool {
+	for _, alert := range g.Alerts {
+		if alert.Status != sharedtools.Resolved {
+			return false
+		}
+	}
+	return true
+}
+
+// Template returns data for message templates, labels and annotations are taken from the latest firing alert
+func (g *AlertGroup) Template() AlertTemplate {
+	var firingAlerts, resolvedAlerts sharedtools.AlertsSlice
+	for _, alert := range g.Alerts {
+		if alert.Status == sharedtools.Resolved {
+			resolvedAlerts = append(resolvedAlerts, alert)
+		} else {
+			firingAlerts = append(firingAlerts, alert)
+		}
+	}
+	sort.Sort(firingAlerts)
+	sort.Sort(resolvedAlerts)
+
+	variables := AlertTemplate{
+		Title:          g.Title,
+		FiringAlerts:   firingAlerts,
+		ResolvedAlerts: resolvedAlerts,
+	}
+	if len(firingAlerts) > 0 {
+		variables.Labels, variables.Annotations = firingAlerts[0].Labels, firingAlerts[0].Annotations
+	} else if len(resolvedAlerts) > 0 {
+		variables.Labels, variables.Annotations = resolvedAlerts[0].Labels, resolvedAlerts[0].Annotations
+	}
+	return variables
+}
+
+func (g *AlertGroup) copy() *AlertGroup {
+	group := newAlertGroup(g.Key, g.Title)
+	for fingerprint, alert := range g.Alerts {
+		group.Alerts[fingerprint] = sharedtools.CopyAlert(&alert)
+	}
+	for key, value := range g.Refs {
+		group.Refs[key] = value
+	}
+	return group
+}
+
+// groupStore keeps alert groups of a sink, groups are saved to json file if path is set
+// so messages are updated instead of duplicated after restart
+type groupStore struct {
+	path   string
+	groups map[string]*AlertGroup
+	mutex  sync.Mutex
+}
+
+func newGroupStore(path string) *groupStore {
+	store := &groupStore{path: path, groups: map[string]*AlertGroup{}}
+	if path == "" {
+		return store
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.S().Errorf("can't read alert groups from %s: %s", path, err)
+		}
+		return store
+	}
+	if err := json.Unmarshal(data, &store.groups); err != nil {
+		zap.S().Errorf("can't parse alert groups from %s: %s", path, err)
+		store.groups = map[string]*AlertGroup{}
+	}
+	return store
+}
+
+// get returns copy of the group, new group is returned if there is no such key
+func (s *groupStore) get(key, title string) *AlertGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if group, ok := s.groups[key]; ok {
+		return group.copy()
+	}
+	return newAlertGroup(key, title)
+}
+
+// unknownResolved is true for resolved group which isn't in store, it happens when group's alerts are resolved
+// after restart with lost state. Sinks which address group by key close it anyway, as close is idempotent there,
+// sinks which need ref of sent message can't update it
+func (s *groupStore) unknownResolved(group *AlertGroup) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.groups[group.Key]
+	return !ok && group.Resolved()
+}
+
+// put saves the group, resolved groups are removed
+func (s *groupStore) put(group *AlertGroup) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if group.Resolved() {
+		delete(s.groups, group.Key)
+	} else {
+		s.groups[group.Key] = group.copy()
+	}
+	s.save()
+}
+
+// putRefs saves refs of stored group without its alerts, so steps of failed send which succeeded are not repeated
+func (s *groupStore) putRefs(group *AlertGroup) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stored, ok := s.groups[group.Key]
+	if !ok {
+		return
+	}
+	stored.Refs = group.copy().Refs
+	s.save()
+}
+
+func (s *groupStore) save() {
+	if s.path == "" {
+		return
+	}
+	data, err := json.Marshal(s.groups)
+	if err != nil {
+		zap.S().Errorf("can't marshal alert groups: %s", err)
+		return
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		zap.S().Errorf("can't write alert groups: %s", err)
+	}
+}
+
+// sinkStatePath returns path of sink state file set by key of sink config, by default the file is kept next to
+// AF_BUFFER_PATH, state is kept in memory only if neither is set
+func sinkStatePath(sink config.Sink, key, name string) string {
+	if path := sink.Config[key]; path != "" {
+		return path
+	}
+	bufferPath := os.Getenv("AF_BUFFER_PATH")
+	if bufferPath == "" {
+		zap.S().Warnf("neither %s of sink %s nor AF_BUFFER_PATH is set, %s are kept in memory and lost on restart", key, sink.Name, name)
+		return ""
+	}
+	return filepath.Join(filepath.Dir(bufferPath), sink.Name+"-"+name+".json")
+}
+
+// writeFileAtomic writes temporary file and renames it, so state is not lost if process dies while writing
+func writeFileAtomic(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// batchResult splits fingerprints of alerts sent to sink into accepted and resolved ones
+func batchResult(alerts []sharedtools.Alert) (accepted []string, resolved []string) {
+	for _, alert := range alerts {
+		if alert.Status == sharedtools.Resolved {
+			resolved = append(resolved, alert.Fingerprint)
+		} else {
+			accepted = append(accepted, alert.Fingerprint)
+		}
+	}
+	return
+}
@@ -0,0 +1,297 @@
+package alertsink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Jira = "jira"
+
+	defaultJiraIssueType       = "Task"
+	defaultJiraCloseTransition = "Done"
+	defaultJiraDescription     = `{{- range .FiringAlerts }}
+* {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}`
+	defaultJiraComment = `New alerts:
+{{- range .FiringAlerts }}
+* {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}`
+	defaultJiraResolveComment = "All alerts are resolved"
+
+	jiraIssueRef = "jira_issue"
+	// jiraResolvedRef is set when resolve comment is posted, so it's not repeated if transition fails
+	jiraResolvedRef = "jira_resolve_commented"
+)
+
+// JiraSink creates issue per alert group for non urgent alerts, existing open issue of the group is found by
+// dedup label so issues are not duplicated after restart, new alerts of the group are added as comments
+// and the issue is transitioned to closeTransition when all alerts of the group are resolved
+type JiraSink struct {
+	runbooks        *config.RunbooksConfig
+	name            string
+	url             string
+	user            string
+	token           string
+	project         string
+	issueType       string
+	summary         string
+	description     string
+	comment         string
+	labels          string
+	priority        string
+	jql             string
+	closeTransition string
+	client          *http.Client
+	retry           RetryPolicy
+	groups          *groupStore
+}
+
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary string `json:"summary"`
+	} `json:"fields"`
+}
+
+type jiraTransition struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	To   struct {
+		Name string `json:"name"`
+	} `json:"to"`
+}
+
+// NewJiraSink creates jira sink from sink config: url, token and project are required, with user basic auth
+// of jira cloud is used, without it token is personal access token. summary, description, comment, labels
+// and priority are templates over AlertTemplate of the group, jql overrides search of existing open issue
+func NewJiraSink(sink config.Sink, runbooks *config.RunbooksConfig) (*JiraSink, error) {
+	j := &JiraSink{
+		runbooks:        runbooks,
+		name:            sink.Name,
+		url:             strings.TrimSuffix(sharedtools.MustTemplateString(sink.Config["url"], nil, ""), "/"),
+		user:            sharedtools.MustTemplateString(sink.Config["user"], nil, ""),
+		token:           sharedtools.MustTemplateString(sink.Config["token"], nil, ""),
+		project:         sink.Config["project"],
+		issueType:       sink.Config["issueType"],
+		summary:         sink.Config["summary"],
+		description:     sink.Config["description"],
+		comment:         sink.Config["comment"],
+		labels:          sink.Config["labels"],
+		priority:        sink.Config["priority"],
+		jql:             sink.Config["jql"],
+		closeTransition: sink.Config["closeTransition"],
+		client:          &http.Client{Timeout: 10 * time.Second},
+		retry:           retryPolicyFromConfig(sink.Config),
+		groups:          newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if j.url == "" || j.token == "" || j.project == "" {
+		return nil, fmt.Errorf("jira sink %s requires url, token and project", sink.Name)
+	}
+	if j.issueType == "" {
+		j.issueType = defaultJiraIssueType
+	}
+	if j.summary == "" {
+		j.summary = "{{ .Title }}"
+	}
+	if j.description == "" {
+		j.description = defaultJiraDescription
+		if runbooks.OncallMessage.SimpleMessage != "" {
+			j.description = runbooks.OncallMessage.SimpleMessage
+		}
+	}
+	if j.comment == "" {
+		j.comment = defaultJiraComment
+	}
+	if j.closeTransition == "" {
+		j.closeTransition = defaultJiraCloseTransition
+	}
+	return j, nil
+}
+
+func (j *JiraSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(j.runbooks, alerts, "") {
+		group := j.groups.get(batch.Key, batch.Title)
+		newAlerts := []sharedtools.Alert{}
+		for _, alert := range batch.Alerts {
+			existing, ok := group.Alerts[alert.Fingerprint]
+			if alert.Status != sharedtools.Resolved && (!ok || existing.Status == sharedtools.Resolved) {
+				newAlerts = append(newAlerts, alert)
+			}
+		}
+		group.merge(batch.Alerts)
+		if j.groups.unknownResolved(group) {
+			log.Infof("resolved alert group %s is unknown to jira sink %s, closing it by issue with dedup label", group.Key, j.name)
+		}
+
+		if err := j.sendGroup(group, newAlerts); err != nil {
+			log.Errorf("can't send alert group %s to jira sink %s: %s", batch.Title, j.name, err)
+			errors = append(errors, err)
+			j.groups.putRefs(group)
+			continue
+		}
+		j.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (j *JiraSink) sendGroup(group *AlertGroup, newAlerts []sharedtools.Alert) error {
+	variables := group.Template()
+	issue := group.Refs[jiraIssueRef]
+	created := false
+	if issue == "" {
+		var err error
+		if issue, err = j.findIssue(group, variables); err != nil {
+			return err
+		}
+		if issue == "" && !group.Resolved() {
+			if issue, err = j.createIssue(group, variables); err != nil {
+				return err
+			}
+			created = true
+		}
+		group.Refs[jiraIssueRef] = issue
+	}
+	if issue == "" {
+		return nil
+	}
+
+	if group.Resolved() {
+		if group.Refs[jiraResolvedRef] == "" {
+			if err := j.addComment(issue, defaultJiraResolveComment); err != nil {
+				return err
+			}
+			group.Refs[jiraResolvedRef] = "true"
+		}
+		return j.transition(issue)
+	}
+	delete(group.Refs, jiraResolvedRef)
+	if created || len(newAlerts) == 0 {
+		return nil
+	}
+	newVariables := variables
+	newVariables.FiringAlerts = newAlerts
+	return j.addComment(issue, sharedtools.MustTemplateString(j.comment, newVariables, "error while parsing comment"))
+}
+
+// dedupLabel is jira label of the group, labels can't contain spaces so hash of the key is used
+func (j *JiraSink) dedupLabel(group *AlertGroup) string {
+	hash := sha256.Sum256([]byte(group.Key))
+	return fmt.Sprintf("alertsforge-%x", hash[:6])
+}
+
+func (j *JiraSink) findIssue(group *AlertGroup, variables AlertTemplate) (string, error) {
+	jql := fmt.Sprintf(`project = "%s" AND labels = "%s" AND statusCategory != Done ORDER BY created DESC`, j.project, j.dedupLabel(group))
+	if j.jql != "" {
+		jql = sharedtools.MustTemplateString(j.jql, variables, jql)
+	}
+	response := struct {
+		Issues []jiraIssue `json:"issues"`
+	}{}
+	query := url.Values{"jql": {jql}, "maxResults": {"1"}, "fields": {"summary"}}
+	if err := j.call(http.MethodGet, "/rest/api/2/search?"+query.Encode(), nil, &response); err != nil {
+		return "", fmt.Errorf("can't search jira issue: %w", err)
+	}
+	if len(response.Issues) == 0 {
+		return "", nil
+	}
+	zap.S().Infof("found open jira issue %s for alert group %s", response.Issues[0].Key, group.Title)
+	return response.Issues[0].Key, nil
+}
+
+func (j *JiraSink) createIssue(group *AlertGroup, variables AlertTemplate) (string, error) {
+	labels := append(splitList(sharedtools.MustTemplateString(j.labels, variables, "")), j.dedupLabel(group))
+	for i, label := range labels {
+		labels[i] = strings.ReplaceAll(label, " ", "_")
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": j.project},
+		"issuetype":   map[string]string{"name": j.issueType},
+		"summary":     truncate(strings.TrimSpace(sharedtools.MustTemplateString(j.summary, variables, group.Title)), 255),
+		"description": sharedtools.MustTemplateString(j.description, variables, "error while parsing description"),
+		"labels":      labels,
+	}
+	if priority := strings.TrimSpace(sharedtools.MustTemplateString(j.priority, variables, "")); priority != "" {
+		fields["priority"] = map[string]string{"name": priority}
+	}
+	response := jiraIssue{}
+	if err := j.call(http.MethodPost, "/rest/api/2/issue", map[string]any{"fields": fields}, &response); err != nil {
+		return "", fmt.Errorf("can't create jira issue: %w", err)
+	}
+	zap.S().Infof("created jira issue %s for alert group %s", response.Key, group.Title)
+	return response.Key, nil
+}
+
+func (j *JiraSink) addComment(issue, comment string) error {
+	if err := j.call(http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(issue)+"/comment", map[string]string{"body": comment}, nil); err != nil {
+		return fmt.Errorf("can't comment jira issue %s: %w", issue, err)
+	}
+	return nil
+}
+
+// transition moves issue with transition which name or target status is closeTransition
+func (j *JiraSink) transition(issue string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(issue) + "/transitions"
+	response := struct {
+		Transitions []jiraTransition `json:"transitions"`
+	}{}
+	if err := j.call(http.MethodGet, path, nil, &response); err != nil {
+		return fmt.Errorf("can't get transitions of jira issue %s: %w", issue, err)
+	}
+	for _, transition := range response.Transitions {
+		if strings.EqualFold(transition.Name, j.closeTransition) || strings.EqualFold(transition.To.Name, j.closeTransition) {
+			if err := j.call(http.MethodPost, path, map[string]any{"transition": map[string]string{"id": transition.ID}}, nil); err != nil {
+				return fmt.Errorf("can't transition jira issue %s: %w", issue, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("jira issue %s has no transition %q", issue, j.closeTransition)
+}
+
+func (j *JiraSink) call(method, path string, payload any, result any) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	response, err := sendWithRetry(j.client, j.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, j.url+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Accept", "application/json")
+		if payload != nil {
+			req.Header.Add("Content-Type", "application/json")
+		}
+		if j.user != "" {
+			req.SetBasicAuth(j.user, j.token)
+		} else {
+			req.Header.Add("Authorization", "Bearer "+j.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	if result == nil || len(response.Body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(response.Body, result)
+}
@@ -0,0 +1,178 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeJira struct {
+	server   *httptest.Server
+	open     map[string]string
+	created  []map[string]any
+	comments map[string][]string
+	closed   []string
+	jql      []string
+}
+
+func newFakeJira(t *testing.T) *fakeJira {
+	f := &fakeJira{open: map[string]string{}, comments: map[string][]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/2/search", func(w http.ResponseWriter, r *http.Request) {
+		jql := r.URL.Query().Get("jql")
+		f.jql = append(f.jql, jql)
+		issues := []map[string]any{}
+		if key, ok := f.open[jql]; ok {
+			issues = append(issues, map[string]any{"key": key})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"issues": issues})
+	})
+	mux.HandleFunc("/rest/api/2/issue", func(w http.ResponseWriter, r *http.Request) {
+		issue := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&issue))
+		f.created = append(f.created, issue["fields"].(map[string]any))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"10001","key":"OPS-1"}`))
+	})
+	mux.HandleFunc("/rest/api/2/issue/OPS-1/comment", func(w http.ResponseWriter, r *http.Request) {
+		comment := map[string]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&comment))
+		f.comments["OPS-1"] = append(f.comments["OPS-1"], comment["body"])
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/rest/api/2/issue/OPS-1/transitions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"transitions":[{"id":"11","name":"In Progress","to":{"name":"In Progress"}},{"id":"31","name":"Close","to":{"name":"Done"}}]}`))
+			return
+		}
+		transition := map[string]map[string]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&transition))
+		f.closed = append(f.closed, transition["transition"]["id"])
+		w.WriteHeader(http.StatusNoContent)
+	})
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "bot@example.com", user)
+		assert.Equal(t, "jira-token", token)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func newTestJiraSink(t *testing.T, jira *fakeJira) SinkInterface {
+	sink, err := NewAlertSink(config.Sink{Name: "jira", Type: Jira, Config: map[string]string{
+		"url":      jira.server.URL,
+		"user":     "bot@example.com",
+		"token":    "jira-token",
+		"project":  "OPS",
+		"labels":   "alerts, {{ .Labels.namespace }}",
+		"priority": "{{ if eq .Labels.severity \"warning\" }}Low{{ end }}",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+	return sink
+}
+
+func TestJiraSink_SendAlerts(t *testing.T) {
+	jira := newFakeJira(t)
+	sink := newTestJiraSink(t, jira)
+
+	labels := map[string]string{"alertname": "KubePersistentVolumeFillingUp", "namespace": "prod", "severity": "warning"}
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Firing, Labels: labels, Annotations: map[string]string{"description": "pvc data-0 is 90% full"}},
+	})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	require.Len(t, jira.created, 1)
+	dedupLabel := sink.(*JiraSink).dedupLabel(&AlertGroup{Key: "KubePersistentVolumeFillingUp"})
+	assert.Equal(t, map[string]any{
+		"project":     map[string]any{"key": "OPS"},
+		"issuetype":   map[string]any{"name": "Task"},
+		"summary":     "KubePersistentVolumeFillingUp",
+		"description": "\n* KubePersistentVolumeFillingUp pvc data-0 is 90% full",
+		"labels":      []any{"alerts", "prod", dedupLabel},
+		"priority":    map[string]any{"name": "Low"},
+	}, jira.created[0])
+	assert.Equal(t, []string{`project = "OPS" AND labels = "` + dedupLabel + `" AND statusCategory != Done ORDER BY created DESC`}, jira.jql)
+	assert.Empty(t, jira.comments)
+
+	// new alert of the group is commented, known one is not
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Firing, Labels: labels},
+		{Fingerprint: "2", Status: sharedtools.Firing, Labels: labels, Annotations: map[string]string{"description": "pvc data-1 is 91% full"}},
+	})
+	assert.Empty(t, errs)
+	assert.Len(t, jira.created, 1)
+	assert.Equal(t, []string{"New alerts:\n* KubePersistentVolumeFillingUp pvc data-1 is 91% full"}, jira.comments["OPS-1"])
+
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels},
+		{Fingerprint: "2", Status: sharedtools.Resolved, Labels: labels},
+	})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, resolved)
+	assert.Equal(t, []string{"31"}, jira.closed)
+	assert.Equal(t, defaultJiraResolveComment, jira.comments["OPS-1"][1])
+	assert.Empty(t, sink.(*JiraSink).groups.groups)
+}
+
+func TestJiraSink_ExistingIssue(t *testing.T) {
+	jira := newFakeJira(t)
+	sink := newTestJiraSink(t, jira)
+	dedupLabel := sink.(*JiraSink).dedupLabel(&AlertGroup{Key: "DiskFull"})
+	jira.open[`project = "OPS" AND labels = "`+dedupLabel+`" AND statusCategory != Done ORDER BY created DESC`] = "OPS-1"
+
+	// issue created before restart gets comment instead of duplicate
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, errs)
+	assert.Empty(t, jira.created)
+	assert.Len(t, jira.comments["OPS-1"], 1)
+
+	// resolved group without issue does nothing
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "3", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"3"}, resolved)
+	assert.Empty(t, jira.created)
+	assert.Empty(t, jira.closed)
+
+	// issue of group unknown after restart is found by dedup label and closed
+	_, resolved, errs = newTestJiraSink(t, jira).SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	assert.Equal(t, []string{"31"}, jira.closed)
+
+	_, err := NewJiraSink(config.Sink{Name: "jira", Type: Jira, Config: map[string]string{"url": "https://jira"}}, &slackRunbooks)
+	assert.Error(t, err)
+}
+
+func TestJiraSink_FailedTransition(t *testing.T) {
+	jira := newFakeJira(t)
+	sink := newTestJiraSink(t, jira)
+	labels := map[string]string{"alertname": "DiskFull"}
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: labels}})
+	require.Empty(t, errs)
+
+	// resolve comment is posted once while transition fails
+	sink.(*JiraSink).closeTransition = "Resolved"
+	for i := 0; i < 2; i++ {
+		_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels}})
+		assert.Empty(t, resolved)
+		assert.Len(t, errs, 1)
+	}
+	assert.Equal(t, []string{defaultJiraResolveComment}, jira.comments["OPS-1"])
+	assert.Empty(t, jira.closed)
+
+	sink.(*JiraSink).closeTransition = defaultJiraCloseTransition
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	assert.Equal(t, []string{defaultJiraResolveComment}, jira.comments["OPS-1"])
+	assert.Equal(t, []string{"31"}, jira.closed)
+}
@@ -2,19 +2,24 @@ package alertsink
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"io"
-	"log"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/buger/jsonparser"
 	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/oncall"
 	"github.com/mobalyticshq/alertsforge/sharedtools"
 	"go.uber.org/zap"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 type OncallRequest struct {
@@ -28,288 +33,375 @@ type OncallRequest struct {
 	AlertmanagerOriginAlerts []sharedtools.Alert `json:"alertmanager_messages,omitempty"`
 }
 
-type OncallGetterInterface interface {
-	getAlertgroups(groups *[][]byte, state string, page string, pagenum int) error
-	getActiveAlertgroups() ([][]byte, error)
-	getAlertgroupAlertsByGroupID(alertGroupID string) ([][]byte, error)
-}
-
 type OncallSetterInterface interface {
-	doOncallIncident(oncall OncallRequest) error
+	doOncallIncident(integrationURL string, oncall OncallRequest) error
 }
 
 type OncallSink struct {
+	name      string
 	runbooks  *config.RunbooksConfig
-	oncallGet OncallGetterInterface
+	api       *oncall.Client
 	oncallSet OncallSetterInterface
+	// integration is template of integration name, integrations maps names to urls, the first one is default
+	integration        string
+	integrations       map[string]string
+	defaultIntegration string
+	index              *oncallIndex
+	deadLetters        *deadLetterQueue
+	localSilence       bool
 }
 
-type OncallGetter struct {
-}
-
+// OncallSetter posts requests to integration, 429, 5xx and network errors are retried with policy
 type OncallSetter struct {
+	client *http.Client
+	retry  RetryPolicy
 }
 
-func NewOncallSink(runbooks *config.RunbooksConfig) *OncallSink {
-	return &OncallSink{runbooks: runbooks, oncallGet: &OncallGetter{}, oncallSet: &OncallSetter{}}
-}
-
-func (o *OncallSetter) doOncallIncident(oncall OncallRequest) error {
-
-	jsonBody, _ := json.Marshal(oncall)
-	bodyReader := bytes.NewReader(jsonBody)
-
-	req, err := http.NewRequest(http.MethodPost, os.Getenv("AF_ONCALL_API_URL")+"/integrations/v1/formatted_webhook/<place>/", bodyReader)
+// NewOncallSink creates oncall sink, integration of alert group is selected by integration template of sink config
+// or oncall_message.integration among oncall_integrations, AF_ONCALL_INTEGRATION_URL is used if there are none.
+// Oncall alert groups are remembered in index saved to statePath and refreshed after indexTTL.
+// Requests failed after all retries are kept in dead letter queue saved to deadLetterPath, which is next to
+// AF_BUFFER_PATH by default.
+// Alert groups acknowledged, resolved or silenced in oncall are not resinked, with localSilence alerts of
+// silenced groups are not resinked to other sinks too. Oncall api is called with apiUrl, apiToken and apiTimeout
+// of sink config which default to AF_ONCALL_API_URL, AF_ONCALL_BEARER and AF_ONCALL_TIMEOUT
+func NewOncallSink(sink config.Sink, runbooks *config.RunbooksConfig) (*OncallSink, error) {
+	indexTTL, err := time.ParseDuration(sink.Config["indexTTL"])
 	if err != nil {
-		zap.S().Errorf("client: could not create request: %s\n", err)
-		return err
+		indexTTL = defaultOncallIndexTTL
 	}
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
+	deadLetterSize, _ := strconv.Atoi(sink.Config["deadLetterSize"])
+	api, err := newOncallClient(sink.Config)
 	if err != nil {
-		zap.S().Errorf("client: error making http request: %s\n", err)
-		return err
+		return nil, fmt.Errorf("oncall sink %s: %w", sink.Name, err)
 	}
-	defer res.Body.Close()
-	// log.Printf("client: status code: %d\n", res.StatusCode)
-
-	resBody, err := io.ReadAll(res.Body)
-	if err != nil {
-		zap.S().Errorf("client: could not read response body: %s\n", err)
-		return err
+	o := &OncallSink{
+		name:         sink.Name,
+		runbooks:     runbooks,
+		api:          api,
+		oncallSet:    &OncallSetter{client: &http.Client{Timeout: 10 * time.Second}, retry: retryPolicyFromConfig(sink.Config)},
+		integration:  sink.Config["integration"],
+		integrations: map[string]string{},
+		index:        newOncallIndex(sink.Config["statePath"], indexTTL),
+		deadLetters:  newDeadLetterQueue(sinkStatePath(sink, "deadLetterPath", "deadletters"), deadLetterSize),
+		localSilence: sink.Config["localSilence"] == "true",
 	}
-	zap.S().Debugf("client: response body: %s\n", resBody)
-
-	return nil
-}
-
-func (o *OncallGetter) getActiveAlertgroups() ([][]byte, error) {
-	var groups [][]byte
-	alertgroupURL := os.Getenv("AF_ONCALL_API_URL") + "/api/v1/alert_groups/"
-	if err := o.getAlertgroups(&groups, "new", alertgroupURL, 0); err != nil {
-		return nil, err
+	if o.integration == "" {
+		o.integration = runbooks.OncallMessage.Integration
+	}
+	for _, integration := range runbooks.OncallIntegrations {
+		if integration.Name == "" || integration.URL == "" {
+			return nil, fmt.Errorf("oncall integration %q requires name and url", integration.Name)
+		}
+		if _, ok := o.integrations[integration.Name]; ok {
+			return nil, fmt.Errorf("duplicate oncall integration %s", integration.Name)
+		}
+		o.integrations[integration.Name] = oncallIntegrationURL(api.BaseURL(), sharedtools.MustTemplateString(integration.URL, nil, ""))
+		if o.defaultIntegration == "" {
+			o.defaultIntegration = integration.Name
+		}
 	}
-	if err := o.getAlertgroups(&groups, "acknowledged", alertgroupURL, 0); err != nil {
-		return nil, err
+	if len(o.integrations) == 0 {
+		url := os.Getenv("AF_ONCALL_INTEGRATION_URL")
+		if url == "" {
+			zap.S().Warnf("no oncall_integrations and AF_ONCALL_INTEGRATION_URL for oncall sink %s", sink.Name)
+		}
+		o.integrations[""] = oncallIntegrationURL(api.BaseURL(), url)
 	}
-	return groups, nil
+	return o, nil
 }
 
-func (o *OncallGetter) getAlertgroups(groups *[][]byte, state string, page string, pagenum int) error {
-	if pagenum > 50 {
-		return errors.New("too many pages in result")
-	}
-
-	req, err := http.NewRequest(http.MethodGet, page, nil)
-	if err != nil {
-		zap.S().Info("client: could not create request: %s\n", err)
-		return err
+func newOncallClient(sinkConfig map[string]string) (*oncall.Client, error) {
+	apiURL := sharedtools.MustTemplateString(sinkConfig["apiUrl"], nil, "")
+	if apiURL == "" {
+		apiURL = os.Getenv("AF_ONCALL_API_URL")
 	}
-	if pagenum == 0 {
-		q := req.URL.Query()
-		q.Add("state", state)
-		req.URL.RawQuery = q.Encode()
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", os.Getenv("AF_ONCALL_BEARER"))
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		zap.S().Errorf("client: error making http request: %s\n", err)
-		return err
+	token := sharedtools.MustTemplateString(sinkConfig["apiToken"], nil, "")
+	if token == "" {
+		token = os.Getenv("AF_ONCALL_BEARER")
 	}
-	defer res.Body.Close()
-
-	resBody, err := io.ReadAll(res.Body)
+	timeout, err := time.ParseDuration(sinkConfig["apiTimeout"])
 	if err != nil {
-		zap.S().Errorf("client: could not read response body: %s\n", err)
-		return err
-	}
-	alertgroups, _, _, agerr := jsonparser.Get(resBody, "results")
-	if agerr != nil {
-		zap.S().Errorf("could not unmarshal json: %s", agerr)
-		return agerr
+		timeout, _ = time.ParseDuration(os.Getenv("AF_ONCALL_TIMEOUT"))
 	}
+	return oncall.NewClient(apiURL, token, timeout)
+}
 
-	if len(alertgroups) > 0 {
-		*groups = append(*groups, alertgroups)
+// oncallIntegrationURL returns integration url as is or builds formatted webhook url of oncall at apiURL from integration token
+func oncallIntegrationURL(apiURL, url string) string {
+	if url == "" || strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url
 	}
+	return apiURL + "/integrations/v1/formatted_webhook/" + strings.Trim(url, "/") + "/"
+}
 
-	next, nexterr := jsonparser.GetString(resBody, "next")
-	if nexterr != nil {
-		return nil //nolint:nilerr
-		// When next page does not exists means we are on the last page
+// integrationURL renders integration name for the group, default integration is used for empty or unknown name
+func (o OncallSink) integrationURL(title string, alerts []sharedtools.Alert) (string, error) {
+	name := ""
+	if o.integration != "" && len(alerts) > 0 {
+		latest := sharedtools.AlertsSlice(slices.Clone(alerts))
+		sort.Sort(latest)
+		variables := AlertTemplate{Title: title, Labels: latest[0].Labels, Annotations: latest[0].Annotations}
+		name = strings.TrimSpace(sharedtools.MustTemplateString(o.integration, variables, ""))
 	}
-
-	if next != "" {
-		pagenum++
-		err := o.getAlertgroups(groups, state, next, pagenum)
-		if err != nil {
-			return err
+	url, ok := o.integrations[name]
+	if !ok {
+		if name != "" {
+			zap.S().Warnf("unknown oncall integration %q, using %q", name, o.defaultIntegration)
 		}
+		url = o.integrations[o.defaultIntegration]
 	}
-	return nil
-}
-
-func (o *OncallGetter) getAlertgroupAlertsByGroupID(alertGroupID string) ([][]byte, error) {
-	var alerts [][]byte
-	err := o.getAlertgroupDetails(&alerts, alertGroupID, os.Getenv("AF_ONCALL_API_URL")+"/api/v1/alerts/", 0)
-	if err != nil {
-		return nil, err
+	if url == "" {
+		return "", errors.New("oncall integration url is not configured")
 	}
-	return alerts, nil
+	return url, nil
 }
 
-func (o *OncallGetter) getAlertgroupDetails(alerts *[][]byte, alertGroupID string, page string, pagenum int) error {
-	if pagenum > 50 {
-		return errors.New("too many pages in result")
+// groupIntegrationURL returns integration the group was sent to until the group is resolved, so resolve is
+// posted to the same integration even if the latest alert selects other one
+func (o OncallSink) groupIntegrationURL(title string, alerts []sharedtools.Alert) (string, error) {
+	if entry, ok, _ := o.index.get(title); ok && entry.IntegrationURL != "" && slices.Contains(maps.Values(o.integrations), entry.IntegrationURL) {
+		return entry.IntegrationURL, nil
 	}
+	return o.integrationURL(title, alerts)
+}
 
-	req, err := http.NewRequest(http.MethodGet, page, nil)
-	if err != nil {
-		log.Printf("client: could not create request: %s\n", err)
-		return err
-	}
-	if pagenum == 0 {
-		q := req.URL.Query()
-		q.Add("alert_group_id", alertGroupID)
-		req.URL.RawQuery = q.Encode()
-	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", os.Getenv("AF_ONCALL_BEARER"))
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		zap.S().Errorf("client: error making http request: %s\n", err)
-		return err
-	}
-	defer res.Body.Close()
-
-	resBody, err := io.ReadAll(res.Body)
+func (o *OncallSetter) doOncallIncident(integrationURL string, oncall OncallRequest) error {
+	jsonBody, err := json.Marshal(oncall)
 	if err != nil {
-		zap.S().Errorf("client: could not read response body: %s\n", err)
 		return err
 	}
-	resalerts, _, _, alerr := jsonparser.Get(resBody, "results")
-	if alerr != nil {
-		zap.S().Errorf("could not unmarshal json: %s", alerr)
-		return alerr
-	}
-
-	if len(resalerts) > 0 {
-		*alerts = append(*alerts, resalerts)
-	}
-
-	next, nexterr := jsonparser.GetString(resBody, "next")
-	if nexterr != nil {
-		return nexterr
+	client := o.client
+	if client == nil {
+		client = http.DefaultClient
 	}
-
-	if next != "" {
-		pagenum++
-		err := o.getAlertgroups(alerts, alertGroupID, next, pagenum)
+	res, err := sendWithRetry(client, o.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, integrationURL, bytes.NewReader(jsonBody))
 		if err != nil {
-			return err
+			return nil, err
 		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
 	}
+	zap.S().Debugf("client: response body: %s\n", res.Body)
 	return nil
-
 }
 
 func (o OncallSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
 	log := zap.L().Sugar()
-	groupedAlerts := map[string][]sharedtools.Alert{}
+	groupedAlerts := groupAlertsByTitle(o.runbooks, alerts)
+	ctx := context.Background()
+	scan := &oncallScan{api: o.api}
 
-	for _, alert := range alerts {
+	for title, alertsInGroup := range groupedAlerts {
+		request := OncallRequest{}
+		request.Title = title
 
-		variables := AlertTemplate{
-			Labels:      alert.Labels,
-			Annotations: alert.Annotations,
+		integrationURL, err := o.groupIntegrationURL(title, alertsInGroup)
+		if err != nil {
+			log.Errorf("can't select oncall integration for %s: %s", title, err)
+			errors = append(errors, err)
+			continue
 		}
-		title := sharedtools.MustTemplateString(o.runbooks.OncallMessage.Title, variables, "error while parsing title")
-		if _, ok := groupedAlerts[title]; !ok {
-			groupedAlerts[title] = []sharedtools.Alert{alert}
-		} else {
-			groupedAlerts[title] = append(groupedAlerts[title], alert)
+		entry, err := o.lookupAlertgroup(ctx, title, integrationURL, scan)
+		if err != nil {
+			log.Errorf("can't get alertgroups: %s", err)
+			errors = append(errors, err)
+			continue
+		}
+		if len(entry.Alerts) > 0 {
+			request.AlertmanagerOriginAlerts = entry.Alerts
+		}
+		if suppressResink(entry, alertsInGroup) {
+			log.Debugf("alertgroup %s is %s in oncall, skipping resink", title, entry.State)
+			acceptedInGroup, _ := batchResult(alertsInGroup)
+			accepted = append(accepted, acceptedInGroup...)
+			continue
 		}
 
-	}
+		if acceptedInGroup, resolvedInGroup, ok := o.prepareOncallMessage(&request, alertsInGroup); ok {
 
-	alertgroupsInOncall, err := o.oncallGet.getActiveAlertgroups()
-	if err != nil {
-		log.Errorf("can't get alertgroups: %s", err)
-		return
+			if err := o.oncallSet.doOncallIncident(integrationURL, request); err != nil {
+				log.Errorf("Can't create oncall incident: \n%s", err.Error())
+				o.deadLetters.add(integrationURL, request, err)
+				errors = append(errors, err)
+			} else {
+				o.deadLetters.remove(integrationURL, title)
+				if request.State == sharedtools.Firing {
+					if entry.State == oncall.StateResolved {
+						// oncall creates new group for alerts of resolved one, it will be found by scan
+						entry.ID, entry.State = "", ""
+					}
+					entry.Alerts = request.AlertmanagerOriginAlerts
+					entry.IntegrationURL = integrationURL
+					o.index.put(title, entry)
+				} else {
+					o.index.delete(title)
+				}
+				accepted = append(accepted, acceptedInGroup...)
+				resolved = append(resolved, resolvedInGroup...)
+			}
+		}
 	}
 
-	for title, alertsInGroup := range groupedAlerts {
-		oncall := OncallRequest{}
-		var latestOncallAlert []byte
-		oncall.Title = title
-
-		for _, oncallAlertgroup := range alertgroupsInOncall {
-			_, err := jsonparser.ArrayEach(oncallAlertgroup, func(alertgroup []byte, dataType jsonparser.ValueType, offset int, eachErr error) {
-				agtitle, err := jsonparser.GetString(alertgroup, "title")
-				if err != nil {
-					log.Warnf("can't get title of alertgroup: %s", err)
-				}
-				if agtitle == oncall.Title {
+	return
+}
 
-					agid, err := jsonparser.GetString(alertgroup, "id")
-					if err != nil {
-						log.Warnf("can't get id: %s", err)
-					}
-					agDetails, err := o.oncallGet.getAlertgroupAlertsByGroupID(agid)
-					if err == nil && len(agDetails) > 0 {
-						_, err := jsonparser.ArrayEach(agDetails[len(agDetails)-1], func(value []byte, dataType jsonparser.ValueType, offset int, eachErr error) {
-							latestOncallAlert = value
-						})
-						if err != nil {
-							log.Warnf("can't iterate alertgroup details: %s", err)
-						}
+func (o OncallSink) DeadLetters() []DeadLetter {
+	return o.deadLetters.list()
+}
 
-					}
+// ReplayDeadLetters posts dead letters again, delivered letters are removed and failed ones stay in queue
+func (o OncallSink) ReplayDeadLetters(ids []string) (replayed []string, errors []error) {
+	for _, letter := range o.deadLetters.list() {
+		if len(ids) > 0 && !slices.Contains(ids, letter.ID) {
+			continue
+		}
+		if err := o.oncallSet.doOncallIncident(letter.IntegrationURL, letter.Request); err != nil {
+			zap.S().Errorf("can't replay dead letter %s of oncall sink %s: %s", letter.ID, o.name, err)
+			o.deadLetters.replayFailed(letter, err)
+			errors = append(errors, fmt.Errorf("dead letter %s: %w", letter.ID, err))
+			continue
+		}
+		zap.S().Infof("replayed dead letter %s of oncall sink %s", letter.ID, o.name)
+		o.deadLetters.removeReplayed(letter)
+		replayed = append(replayed, letter.ID)
+	}
+	return
+}
 
-				}
-			})
+// oncallScan loads active oncall alert groups of integration once per processing and only if some title
+// is not in index, groups are filtered by integration so sinks with the same titles don't take each other's groups
+type oncallScan struct {
+	api            *oncall.Client
+	groups         map[string][]oncall.AlertGroup
+	integrationIDs map[string]string
+}
+
+func (s *oncallScan) alertgroupID(ctx context.Context, integrationURL, title string) (string, error) {
+	integrationID, err := s.integrationID(ctx, integrationURL)
+	if err != nil {
+		return "", err
+	}
+	if s.groups == nil {
+		s.groups = map[string][]oncall.AlertGroup{}
+	}
+	groups, loaded := s.groups[integrationID]
+	if !loaded {
+		for _, state := range []string{oncall.StateNew, oncall.StateAcknowledged} {
+			stateGroups, err := s.api.AlertGroups(ctx, oncall.AlertGroupsQuery{State: state, IntegrationID: integrationID}).All()
 			if err != nil {
-				log.Warnf("can't iterate alertgroup: %s", err)
+				return "", err
 			}
+			groups = append(groups, stateGroups...)
+		}
+		s.groups[integrationID] = groups
+	}
+	for _, group := range groups {
+		if group.Title == title {
+			return group.ID, nil
+		}
+	}
+	return "", nil
+}
 
+// integrationID finds oncall integration by path of its url as oncall can return other public host in link,
+// alert groups of all integrations are scanned if integration is not found
+func (s *oncallScan) integrationID(ctx context.Context, integrationURL string) (string, error) {
+	if s.integrationIDs == nil {
+		integrations, err := s.api.Integrations(ctx).All()
+		if err != nil {
+			return "", fmt.Errorf("can't get oncall integrations: %w", err)
 		}
+		s.integrationIDs = map[string]string{}
+		for _, integration := range integrations {
+			s.integrationIDs[integrationPath(integration.Link)] = integration.ID
+		}
+	}
+	path := integrationPath(integrationURL)
+	id, ok := s.integrationIDs[path]
+	if !ok {
+		zap.S().Warnf("oncall integration %s is not found, alert groups of all integrations are scanned", path)
+		s.integrationIDs[path] = ""
+	}
+	return id, nil
+}
 
-		if len(latestOncallAlert) > 0 {
-			latestAlertPayload, _, _, err := jsonparser.Get(latestOncallAlert, "payload")
-			if err != nil {
-				log.Warnf("can't get latest alert payload: %s", err)
-			} else {
-				latestOncallAlertObject := OncallRequest{}
-				if len(latestOncallAlert) > 0 {
-					err := json.Unmarshal(latestAlertPayload, &latestOncallAlertObject)
-					if err != nil {
-						log.Warnf("can't unmarshal latest oncall alert: %s", err)
-					} else if len(latestOncallAlertObject.AlertmanagerOriginAlerts) > 0 {
-						oncall.AlertmanagerOriginAlerts = latestOncallAlertObject.AlertmanagerOriginAlerts
-					}
+func integrationPath(integrationURL string) string {
+	parsed, err := url.Parse(integrationURL)
+	if err != nil {
+		return integrationURL
+	}
+	return strings.TrimSuffix(parsed.Path, "/")
+}
 
+// lookupAlertgroup returns oncall alert group of the title from index, stale entry of known group is refreshed
+// by its id, active alert groups are scanned only for unknown titles or groups which don't exist anymore.
+// Group resolved in oncall is kept in index so its alerts are not resinked
+func (o OncallSink) lookupAlertgroup(ctx context.Context, title, integrationURL string, scan *oncallScan) (oncallIndexEntry, error) {
+	entry, ok, fresh := o.index.get(title)
+	if fresh {
+		return entry, nil
+	}
+	if ok && entry.ID != "" {
+		group, err := o.api.AlertGroup(ctx, entry.ID)
+		if err != nil && !errors.Is(err, oncall.ErrNotFound) {
+			zap.S().Warnf("can't get state of alertgroup %s: %s", entry.ID, err)
+		} else if err == nil {
+			if group.State != oncall.StateResolved {
+				if entry.Alerts, err = o.latestOriginAlerts(ctx, entry.ID); err != nil {
+					return oncallIndexEntry{}, err
 				}
 			}
+			entry.State = group.State
+			entry.RefreshedAt = time.Now()
+			o.index.put(title, entry)
+			return entry, nil
 		}
+	}
 
-		if acceptedInGroup, resolvedInGroup, ok := o.prepareOncallMessage(&oncall, alertsInGroup); ok {
-
-			if err := o.oncallSet.doOncallIncident(oncall); err != nil {
-				log.Errorf("Can't create oncall incident: \n%s", err.Error())
-				errors = append(errors, err)
-			} else {
-				accepted = append(accepted, acceptedInGroup...)
-				resolved = append(resolved, resolvedInGroup...)
-			}
+	id, err := scan.alertgroupID(ctx, integrationURL, title)
+	if err != nil {
+		return oncallIndexEntry{}, err
+	}
+	entry = oncallIndexEntry{ID: id, IntegrationURL: entry.IntegrationURL, RefreshedAt: time.Now()}
+	if id != "" {
+		if entry.Alerts, err = o.latestOriginAlerts(ctx, id); err != nil {
+			return oncallIndexEntry{}, err
 		}
 	}
+	o.index.put(title, entry)
+	return entry, nil
+}
 
-	return
+// latestOriginAlerts returns alertmanager_origin_alerts of the latest alert of oncall alert group, error of
+// alerts request is returned so group is not indexed without its alerts, otherwise next payload would drop them
+func (o OncallSink) latestOriginAlerts(ctx context.Context, alertGroupID string) ([]sharedtools.Alert, error) {
+	var latest *oncall.Alert
+	alerts := o.api.Alerts(ctx, alertGroupID)
+	for alerts.Next() {
+		alert := alerts.Item()
+		latest = &alert
+	}
+	if err := alerts.Err(); err != nil {
+		return nil, fmt.Errorf("can't get alerts of alertgroup %s: %w", alertGroupID, err)
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	payload := OncallRequest{}
+	if err := json.Unmarshal(latest.Payload, &payload); err != nil {
+		zap.S().Warnf("can't unmarshal latest oncall alert: %s", err)
+		return nil, nil
+	}
+	return payload.AlertmanagerOriginAlerts, nil
 }
 
 type AlertTemplate struct {
+	Title          string
 	Labels         map[string]string
 	Annotations    map[string]string
 	FiringAlerts   []sharedtools.Alert
@@ -5,8 +5,11 @@ import (
 	"time"
 
 	"github.com/mobalyticshq/alertsforge/config"
+	oncallapi "github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/oncall/oncalltest"
 	"github.com/mobalyticshq/alertsforge/sharedtools"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var template = `{{- $last_commits := list }}
@@ -156,44 +159,31 @@ func TestPrepareOncallMessage_Resolved(t *testing.T) {
 
 }
 
-type OncallGetTest struct {
-}
-
 type OncallSetTest struct {
 }
 
-func (o *OncallGetTest) getAlertgroups(groups *[][]byte, state string, page string, pagenum int) error {
+func (o *OncallSetTest) doOncallIncident(integrationURL string, oncall OncallRequest) error {
 	return nil
 }
 
-func (o *OncallGetTest) getActiveAlertgroups() ([][]byte, error) {
-	return [][]byte{
-		[]byte(`[
-		{"id":"1234","title":"Test Alert","alert_ids":["1","2","3"]}
-		]`),
-	}, nil
-}
-
-func (o *OncallGetTest) getAlertgroupAlertsByGroupID(alertGroupID string) ([][]byte, error) {
-	return [][]byte{
-		[]byte(`
-		[{"id":"1","payload": "{\"alertmanager_origin_alerts\":[]}"}]
-		`),
-		[]byte(`
-		[{"id":"2","payload": "{\"alertmanager_origin_alerts\":[]}"}]
-		`),
-		[]byte(`
-		[{"id":"3","payload": "{\"alertmanager_origin_alerts\":[{\"fingerprint"\:\"1\",\"labels\":{\"alertname\":\"Test Alert\"},\"annotations\":{}}]}"}]
-		`),
-	}, nil
-}
-
-func (o *OncallSetTest) doOncallIncident(oncall OncallRequest) error {
-	return nil
+// newFakeOncall starts fake oncall and points AF_ONCALL_API_URL to it
+func newFakeOncall(t *testing.T) *oncalltest.Server {
+	server := oncalltest.NewServer("token")
+	t.Cleanup(server.Close)
+	t.Setenv("AF_ONCALL_API_URL", server.URL)
+	t.Setenv("AF_ONCALL_BEARER", "token")
+	return server
 }
 
 func TestSendAlerts(t *testing.T) {
-	o := OncallSink{runbooks: &runbooks, oncallGet: &OncallGetTest{}, oncallSet: &OncallSetTest{}}
+	server := newFakeOncall(t)
+	server.AddAlertGroup("Test Alert", oncallapi.StateNew,
+		OncallRequest{Title: "Test Alert"},
+		OncallRequest{Title: "Test Alert", AlertmanagerOriginAlerts: []sharedtools.Alert{{Fingerprint: "0", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "Test Alert"}, Annotations: map[string]string{}}}},
+	)
+	api, err := oncallapi.NewClient(server.URL, "token", 0)
+	assert.NoError(t, err)
+	o := OncallSink{runbooks: &runbooks, api: api, oncallSet: &OncallSetTest{}, integrations: map[string]string{"": "http://oncall/integrations/v1/formatted_webhook/test/"}, index: newOncallIndex("", 0), deadLetters: newDeadLetterQueue("", 0)}
 	o.runbooks.OncallMessage.Title = "{{.Labels.alertname}}"
 
 	alerts := []sharedtools.Alert{
@@ -237,3 +227,114 @@ func TestSendAlerts(t *testing.T) {
 		t.Errorf("expected no errors, got %d", len(errors))
 	}
 }
+
+type recordingOncallSetter struct {
+	urls map[string]string
+}
+
+func (o *recordingOncallSetter) doOncallIncident(integrationURL string, oncall OncallRequest) error {
+	o.urls[oncall.Title] = integrationURL
+	return nil
+}
+
+func TestOncallSink_Integrations(t *testing.T) {
+	server := newFakeOncall(t)
+	t.Setenv("AF_ONCALL_DEVOPS_INTEGRATION", "https://oncall/integrations/v1/formatted_webhook/devops/")
+	integrationRunbooks := config.RunbooksConfig{
+		OncallMessage: config.OncallMessage{
+			Title:       "{{ .Labels.alertname }}",
+			Integration: "{{ .Labels.team }}",
+		},
+		OncallIntegrations: []config.OncallIntegration{
+			{Name: "devops", URL: `{{ env "AF_ONCALL_DEVOPS_INTEGRATION" }}`},
+			{Name: "backend", URL: "b4ck3nd"},
+		},
+	}
+	sink, err := NewOncallSink(config.Sink{Name: "oncall", Type: Oncall}, &integrationRunbooks)
+	assert.NoError(t, err)
+	setter := &recordingOncallSetter{urls: map[string]string{}}
+	sink.oncallSet = setter
+
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Labels: map[string]string{"alertname": "HighCPU", "team": "backend"}, Annotations: map[string]string{}},
+		{Fingerprint: "2", Labels: map[string]string{"alertname": "DiskFull", "team": "devops"}, Annotations: map[string]string{}},
+		{Fingerprint: "3", Labels: map[string]string{"alertname": "Unknown", "team": "frontend"}, Annotations: map[string]string{}},
+	})
+	assert.Empty(t, errs)
+	assert.Equal(t, map[string]string{
+		"HighCPU":  server.IntegrationURL("b4ck3nd"),
+		"DiskFull": "https://oncall/integrations/v1/formatted_webhook/devops/",
+		"Unknown":  "https://oncall/integrations/v1/formatted_webhook/devops/",
+	}, setter.urls)
+
+	// sink of route can pin integration
+	sink, err = NewOncallSink(config.Sink{Name: "oncall-backend", Type: Oncall, Config: map[string]string{"integration": "backend"}}, &integrationRunbooks)
+	assert.NoError(t, err)
+	setter = &recordingOncallSetter{urls: map[string]string{}}
+	sink.oncallSet = setter
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "2", Labels: map[string]string{"alertname": "DiskFull", "team": "devops"}, Annotations: map[string]string{}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, server.IntegrationURL("b4ck3nd"), setter.urls["DiskFull"])
+
+	integrationRunbooks.OncallIntegrations = append(integrationRunbooks.OncallIntegrations, config.OncallIntegration{Name: "devops", URL: "x"})
+	_, err = NewOncallSink(config.Sink{Name: "oncall", Type: Oncall}, &integrationRunbooks)
+	assert.Error(t, err)
+}
+
+func TestOncallSink_GroupIntegration(t *testing.T) {
+	server := newFakeOncall(t)
+	integrationRunbooks := config.RunbooksConfig{
+		OncallMessage: config.OncallMessage{Title: "{{ .Labels.alertname }}", Integration: "{{ .Labels.team }}"},
+		OncallIntegrations: []config.OncallIntegration{
+			{Name: "backend", URL: "b4ck3nd"},
+			{Name: "devops", URL: "d3v0ps"},
+		},
+	}
+	previous := server.AddIntegrationAlertGroup("b4ck3nd", "HighCPU", oncallapi.StateResolved)
+	// group with the same title in other integration is not taken
+	devops := server.AddIntegrationAlertGroup("d3v0ps", "HighCPU", oncallapi.StateNew)
+	sink, err := NewOncallSink(config.Sink{Name: "oncall", Type: Oncall}, &integrationRunbooks)
+	require.NoError(t, err)
+
+	backendAlert := sharedtools.Alert{Fingerprint: "1", Status: sharedtools.Firing, StartsAt: time.Now().Add(-time.Hour), Labels: map[string]string{"alertname": "HighCPU", "team": "backend"}, Annotations: map[string]string{}}
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{backendAlert})
+	assert.Empty(t, errs)
+	entry, ok, _ := sink.index.get("HighCPU")
+	require.True(t, ok)
+	assert.Empty(t, entry.ID)
+	assert.Equal(t, server.IntegrationURL("b4ck3nd"), entry.IntegrationURL)
+
+	// the latest alert selects other integration but the group stays in the first one until it's resolved
+	devopsAlert := sharedtools.Alert{Fingerprint: "2", Status: sharedtools.Firing, StartsAt: time.Now(), Labels: map[string]string{"alertname": "HighCPU", "team": "devops"}, Annotations: map[string]string{}}
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{devopsAlert})
+	assert.Empty(t, errs)
+	backendAlert.Status, devopsAlert.Status = sharedtools.Resolved, sharedtools.Resolved
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{backendAlert, devopsAlert})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, resolved)
+
+	groups := server.AlertGroups()
+	require.Len(t, groups, 3)
+	assert.Equal(t, []string{previous.ID, devops.ID}, []string{groups[0].ID, groups[1].ID})
+	assert.Equal(t, 0, groups[1].AlertsCount)
+	assert.Equal(t, oncallapi.StateNew, groups[1].State)
+	assert.Equal(t, previous.IntegrationID, groups[2].IntegrationID)
+	assert.Equal(t, oncallapi.StateResolved, groups[2].State)
+	assert.Len(t, server.Alerts(groups[2].ID), 3)
+}
+
+func TestOncallSink_IntegrationFromEnv(t *testing.T) {
+	newFakeOncall(t)
+	t.Setenv("AF_ONCALL_INTEGRATION_URL", "")
+	sink, err := NewOncallSink(config.Sink{Name: "oncall", Type: Oncall}, &runbooks)
+	assert.NoError(t, err)
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Labels: map[string]string{"alertname": "HighCPU"}, Annotations: map[string]string{}}})
+	assert.Len(t, errs, 1)
+
+	t.Setenv("AF_ONCALL_INTEGRATION_URL", "https://oncall/integrations/v1/formatted_webhook/abc/")
+	sink, err = NewOncallSink(config.Sink{Name: "oncall", Type: Oncall}, &runbooks)
+	assert.NoError(t, err)
+	url, err := sink.integrationURL("HighCPU", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://oncall/integrations/v1/formatted_webhook/abc/", url)
+}
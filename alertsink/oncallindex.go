@@ -0,0 +1,115 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const defaultOncallIndexTTL = 10 * time.Minute
+
+// oncallIndexEntry is known state of oncall alert group with the title, ID is empty if group was created by us
+// and not found in oncall yet, Alerts are alertmanager_origin_alerts of the last payload, State is set when
+// the group is acknowledged, resolved or silenced in oncall, IntegrationURL is integration the group is sent to
+type oncallIndexEntry struct {
+	ID             string              `json:"id,omitempty"`
+	State          string              `json:"state,omitempty"`
+	Alerts         []sharedtools.Alert `json:"alerts,omitempty"`
+	IntegrationURL string              `json:"integrationUrl,omitempty"`
+	RefreshedAt    time.Time           `json:"refreshedAt"`
+}
+
+// oncallIndex maps alert group titles to oncall alert groups so oncall api is not scanned on every processing,
+// entry is refreshed from oncall when it's older than ttl, index is saved to json file if path is set
+type oncallIndex struct {
+	path    string
+	ttl     time.Duration
+	entries map[string]oncallIndexEntry
+	mutex   sync.Mutex
+}
+
+func newOncallIndex(path string, ttl time.Duration) *oncallIndex {
+	index := &oncallIndex{path: path, ttl: ttl, entries: map[string]oncallIndexEntry{}}
+	if path == "" {
+		return index
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			zap.S().Errorf("can't read oncall index from %s: %s", path, err)
+		}
+		return index
+	}
+	if err := json.Unmarshal(data, &index.entries); err != nil {
+		zap.S().Errorf("can't parse oncall index from %s: %s", path, err)
+		index.entries = map[string]oncallIndexEntry{}
+	}
+	return index
+}
+
+// get returns copy of the entry and whether it's fresh
+func (i *oncallIndex) get(title string) (entry oncallIndexEntry, ok bool, fresh bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	entry, ok = i.entries[title]
+	entry.Alerts = copyAlerts(entry.Alerts)
+	return entry, ok, ok && time.Since(entry.RefreshedAt) < i.ttl
+}
+
+func (i *oncallIndex) put(title string, entry oncallIndexEntry) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	entry.Alerts = copyAlerts(entry.Alerts)
+	i.entries[title] = entry
+	i.save()
+}
+
+func (i *oncallIndex) delete(title string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	delete(i.entries, title)
+	i.save()
+}
+
+// list returns copy of all entries
+func (i *oncallIndex) list() map[string]oncallIndexEntry {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	entries := make(map[string]oncallIndexEntry, len(i.entries))
+	for title, entry := range i.entries {
+		entry.Alerts = copyAlerts(entry.Alerts)
+		entries[title] = entry
+	}
+	return entries
+}
+
+func (i *oncallIndex) save() {
+	if i.path == "" {
+		return
+	}
+	data, err := json.Marshal(i.entries)
+	if err != nil {
+		zap.S().Errorf("can't marshal oncall index: %s", err)
+		return
+	}
+	if err := writeFileAtomic(i.path, data); err != nil {
+		zap.S().Errorf("can't write oncall index: %s", err)
+	}
+}
+
+func copyAlerts(alerts []sharedtools.Alert) []sharedtools.Alert {
+	if alerts == nil {
+		return nil
+	}
+	result := make([]sharedtools.Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		result = append(result, sharedtools.CopyAlert(&alert))
+	}
+	return result
+}
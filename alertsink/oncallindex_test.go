@@ -0,0 +1,149 @@
+package alertsink
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/oncall/oncalltest"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type capturingOncallSetter struct {
+	requests []OncallRequest
+}
+
+func (o *capturingOncallSetter) doOncallIncident(integrationURL string, oncall OncallRequest) error {
+	o.requests = append(o.requests, oncall)
+	return nil
+}
+
+// addHighCPUGroup adds active alert group "HighCPU" with alert of fingerprint "0" to integration "test"
+func addHighCPUGroup(server *oncalltest.Server) oncall.AlertGroup {
+	return server.AddIntegrationAlertGroup("test", "HighCPU", oncall.StateNew, OncallRequest{
+		Title:                    "HighCPU",
+		AlertmanagerOriginAlerts: []sharedtools.Alert{{Fingerprint: "0", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}},
+	})
+}
+
+func newIndexedOncallSink(t *testing.T, statePath string, setter OncallSetterInterface) *OncallSink {
+	t.Setenv("AF_ONCALL_INTEGRATION_URL", "http://oncall/integrations/v1/formatted_webhook/test/")
+	indexRunbooks := config.RunbooksConfig{OncallMessage: config.OncallMessage{Title: "{{ .Labels.alertname }}"}}
+	sink, err := NewOncallSink(config.Sink{Name: "oncall", Type: Oncall, Config: map[string]string{"statePath": statePath, "indexTTL": "1h"}}, &indexRunbooks)
+	require.NoError(t, err)
+	sink.oncallSet = setter
+	return sink
+}
+
+func TestOncallSink_Index(t *testing.T) {
+	server := newFakeOncall(t)
+	group := addHighCPUGroup(server)
+	scans := func() int { return server.Requests("/api/v1/alert_groups/") }
+	details := func() int { return server.Requests("/api/v1/alerts/") }
+	statePath := filepath.Join(t.TempDir(), "oncall.json")
+	setter := &capturingOncallSetter{}
+	sink := newIndexedOncallSink(t, statePath, setter)
+
+	firing := func(fingerprint, alertname string) sharedtools.Alert {
+		return sharedtools.Alert{Fingerprint: fingerprint, Status: sharedtools.Firing, Labels: map[string]string{"alertname": alertname}, Annotations: map[string]string{}}
+	}
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{firing("1", "HighCPU"), firing("2", "DiskFull")})
+	assert.Empty(t, errs)
+	// new and acknowledged groups are scanned once for both titles, details are loaded for existing group only
+	assert.Equal(t, 2, scans())
+	assert.Equal(t, 1, details())
+	for _, request := range setter.requests {
+		if request.Title == "HighCPU" {
+			assert.Len(t, request.AlertmanagerOriginAlerts, 2)
+		}
+	}
+
+	// fresh index is used without oncall api, payload of the last send is remembered
+	setter.requests = nil
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{firing("3", "HighCPU")})
+	assert.Empty(t, errs)
+	assert.Equal(t, 2, scans())
+	assert.Equal(t, 1, details())
+	require.Len(t, setter.requests, 1)
+	assert.Len(t, setter.requests[0].AlertmanagerOriginAlerts, 3)
+
+	// index survives restart, stale entry of known group is refreshed by id without scan
+	sink = newIndexedOncallSink(t, statePath, setter)
+	entry, ok, fresh := sink.index.get("HighCPU")
+	require.True(t, ok)
+	assert.True(t, fresh)
+	assert.Equal(t, group.ID, entry.ID)
+	sink.index.ttl = 0
+	server.SetState(group.ID, oncall.StateAcknowledged)
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{firing("3", "HighCPU")})
+	assert.Empty(t, errs)
+	assert.Equal(t, 2, scans())
+	assert.Equal(t, 2, details())
+	assert.Equal(t, 1, server.Requests("/api/v1/alert_groups/"+group.ID+"/"))
+
+	// group deleted in oncall falls back to scan
+	server.DeleteAlertGroup(group.ID)
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{firing("3", "HighCPU")})
+	assert.Empty(t, errs)
+	assert.Equal(t, 4, scans())
+
+	// resolved group is removed from index
+	sink.index.ttl = time.Hour
+	resolvedAlert := firing("2", "DiskFull")
+	resolvedAlert.Status = sharedtools.Resolved
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{resolvedAlert})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"2"}, resolved)
+	_, ok, _ = sink.index.get("DiskFull")
+	assert.False(t, ok)
+}
+
+func TestOncallSink_LookupError(t *testing.T) {
+	newFakeOncall(t)
+	t.Setenv("AF_ONCALL_BEARER", "wrong")
+	setter := &capturingOncallSetter{}
+	sink := newIndexedOncallSink(t, "", setter)
+	sink.index.put("HighCPU", oncallIndexEntry{ID: "I1", RefreshedAt: time.Now()})
+
+	// group known from index is sent even if oncall api fails for other groups
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}, Annotations: map[string]string{}},
+		{Fingerprint: "2", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}, Annotations: map[string]string{}},
+	})
+	assert.Equal(t, []string{"1"}, accepted)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "401")
+	require.Len(t, setter.requests, 1)
+	assert.Equal(t, "HighCPU", setter.requests[0].Title)
+}
+
+func TestOncallSink_OriginAlertsError(t *testing.T) {
+	server := newFakeOncall(t)
+	addHighCPUGroup(server)
+	setter := &capturingOncallSetter{}
+	sink := newIndexedOncallSink(t, "", setter)
+	server.PathStatus = map[string]int{"/api/v1/alerts/": http.StatusBadGateway}
+
+	// group isn't posted without alerts of oncall group, otherwise resolve of the only alert in batch resolves the group
+	resolvedAlert := sharedtools.Alert{Fingerprint: "1", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "HighCPU"}, Annotations: map[string]string{}}
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{resolvedAlert})
+	assert.Empty(t, resolved)
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "502")
+	assert.Empty(t, setter.requests)
+	_, ok, _ := sink.index.get("HighCPU")
+	assert.False(t, ok)
+
+	server.PathStatus = nil
+	_, resolved, errs = sink.SendAlerts([]sharedtools.Alert{resolvedAlert})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, setter.requests, 1)
+	assert.Equal(t, sharedtools.Firing, setter.requests[0].State)
+	assert.Len(t, setter.requests[0].AlertmanagerOriginAlerts, 2)
+}
@@ -0,0 +1,99 @@
+package alertsink
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+// AlertState is state of alert changed by people in the sink, Silenced alerts are not resinked to any sink
+type AlertState struct {
+	State    string
+	Silenced bool
+}
+
+// AlertStateReporter is implemented by sinks which know that people acknowledged, resolved or silenced alerts,
+// SyncAlertStates returns states of firing alerts by fingerprint
+type AlertStateReporter interface {
+	SyncAlertStates() map[string]AlertState
+}
+
+// AlertgroupStateReceiver is implemented by sinks which accept alert group state from oncall outgoing webhook
+type AlertgroupStateReceiver interface {
+	SetAlertgroupState(id, title, state string) bool
+}
+
+// handledOncallState is true for states set by people, alert groups in them are not resinked
+func handledOncallState(state string) bool {
+	return state == oncall.StateAcknowledged || state == oncall.StateResolved || state == oncall.StateSilenced
+}
+
+// suppressResink is true if group is handled in oncall and all alerts were already sent to it as firing,
+// new and resolved alerts are still sent
+func suppressResink(entry oncallIndexEntry, alerts []sharedtools.Alert) bool {
+	if !handledOncallState(entry.State) {
+		return false
+	}
+	sent := map[string]bool{}
+	for _, alert := range entry.Alerts {
+		if alert.Status != sharedtools.Resolved {
+			sent[alert.Fingerprint] = true
+		}
+	}
+	for _, alert := range alerts {
+		if alert.Status == sharedtools.Resolved || !sent[alert.Fingerprint] {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncAlertStates refreshes stale handled alert groups from oncall and returns states of their firing alerts,
+// silenced alerts are silenced locally if localSilence is set in sink config
+func (o OncallSink) SyncAlertStates() map[string]AlertState {
+	states := map[string]AlertState{}
+	for title, entry := range o.index.list() {
+		if !handledOncallState(entry.State) {
+			continue
+		}
+		if _, _, fresh := o.index.get(title); !fresh && entry.ID != "" {
+			group, err := o.api.AlertGroup(context.Background(), entry.ID)
+			if err != nil && !errors.Is(err, oncall.ErrNotFound) {
+				zap.S().Warnf("can't get state of alertgroup %s: %s", entry.ID, err)
+			} else {
+				entry.State = group.State
+				entry.RefreshedAt = time.Now()
+				o.index.put(title, entry)
+			}
+		}
+		if !handledOncallState(entry.State) {
+			continue
+		}
+		for _, alert := range entry.Alerts {
+			if alert.Status != sharedtools.Resolved {
+				states[alert.Fingerprint] = AlertState{State: entry.State, Silenced: o.localSilence && entry.State == oncall.StateSilenced}
+			}
+		}
+	}
+	return states
+}
+
+// SetAlertgroupState updates state of alert group sent by this sink, unknown groups are ignored
+func (o OncallSink) SetAlertgroupState(id, title, state string) bool {
+	entry, ok, _ := o.index.get(title)
+	if !ok || (entry.ID != "" && id != "" && entry.ID != id) {
+		return false
+	}
+	if entry.ID == "" {
+		entry.ID = id
+	}
+	zap.S().Infof("alertgroup %s of oncall sink %s is %s", title, o.name, state)
+	entry.State = state
+	entry.RefreshedAt = time.Now()
+	o.index.put(title, entry)
+	return true
+}
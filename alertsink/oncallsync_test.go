@@ -0,0 +1,59 @@
+package alertsink
+
+import (
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOncallSink_AlertgroupState(t *testing.T) {
+	server := newFakeOncall(t)
+	group := addHighCPUGroup(server)
+	setter := &capturingOncallSetter{}
+	sink := newIndexedOncallSink(t, "", setter)
+	firing := func(fingerprint string) sharedtools.Alert {
+		return sharedtools.Alert{Fingerprint: fingerprint, Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}, Annotations: map[string]string{}}
+	}
+
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{firing("1")})
+	require.Empty(t, errs)
+	require.Len(t, setter.requests, 1)
+	assert.Empty(t, sink.SyncAlertStates())
+
+	assert.False(t, sink.SetAlertgroupState(group.ID, "Unknown", oncall.StateResolved))
+	assert.False(t, sink.SetAlertgroupState("999", "HighCPU", oncall.StateResolved))
+	assert.True(t, sink.SetAlertgroupState(group.ID, "HighCPU", oncall.StateResolved))
+	assert.Equal(t, AlertState{State: oncall.StateResolved}, sink.SyncAlertStates()["1"])
+
+	// resink of group resolved in oncall is skipped, but alerts are accepted
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{firing("1")})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	assert.Len(t, setter.requests, 1)
+
+	// new alert is sent to new oncall group
+	accepted, _, errs = sink.SendAlerts([]sharedtools.Alert{firing("1"), firing("2")})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, accepted)
+	assert.Len(t, setter.requests, 2)
+	assert.Empty(t, sink.SyncAlertStates())
+
+	// silenced group is silenced locally only with localSilence
+	silenced := server.AddAlertGroup("HighCPU", oncall.StateSilenced)
+	assert.True(t, sink.SetAlertgroupState(silenced.ID, "HighCPU", oncall.StateSilenced))
+	assert.Equal(t, AlertState{State: oncall.StateSilenced}, sink.SyncAlertStates()["2"])
+	sink.localSilence = true
+	assert.Equal(t, AlertState{State: oncall.StateSilenced, Silenced: true}, sink.SyncAlertStates()["2"])
+
+	// stale state is refreshed from oncall
+	sink.index.ttl = 0
+	assert.Contains(t, sink.SyncAlertStates(), "1")
+	server.SetState(silenced.ID, oncall.StateNew)
+	assert.Empty(t, sink.SyncAlertStates())
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{firing("1")})
+	assert.Empty(t, errs)
+	assert.Len(t, setter.requests, 3)
+}
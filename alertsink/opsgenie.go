@@ -0,0 +1,236 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	Opsgenie = "opsgenie"
+
+	defaultOpsgenieURL         = "https://api.opsgenie.com"
+	defaultOpsgeniePriority    = "P3"
+	defaultOpsgenieResponders  = "{{ .Labels.alertsforge_escalation_chain }}"
+	defaultOpsgenieDescription = `{{- range .FiringAlerts }}
+{{ .Annotations.description }}
+{{- end }}
+{{- if .ResolvedAlerts }}
+Resolved:
+{{- range .ResolvedAlerts }}
+{{ .Annotations.description }}
+{{- end }}
+{{- end }}`
+
+	opsgenieCreatedRef = "opsgenie_created"
+)
+
+var opsgeniePriorities = []string{"P1", "P2", "P3", "P4", "P5"}
+
+// OpsgenieSink creates opsgenie alert per alias (title by default), updates its description and priority
+// when alerts join or leave the group and closes it when all alerts are resolved
+type OpsgenieSink struct {
+	runbooks      *config.RunbooksConfig
+	name          string
+	apiKey        string
+	url           string
+	alias         string
+	message       string
+	description   string
+	priority      string
+	responders    string
+	responderType string
+	tags          string
+	entity        string
+	client        *http.Client
+	retry         RetryPolicy
+	groups        *groupStore
+}
+
+type OpsgenieResponder struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type OpsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description,omitempty"`
+	Responders  []OpsgenieResponder `json:"responders,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Details     map[string]string   `json:"details,omitempty"`
+	Entity      string              `json:"entity,omitempty"`
+	Source      string              `json:"source,omitempty"`
+	Priority    string              `json:"priority,omitempty"`
+}
+
+// NewOpsgenieSink creates opsgenie sink from sink config: apiKey is required, url defaults to us instance,
+// alias, message, description, priority, responders, tags and entity are templates over AlertTemplate of the group.
+// responders renders to comma separated list of names or type:name pairs, type defaults to responderType (team)
+func NewOpsgenieSink(sink config.Sink, runbooks *config.RunbooksConfig) (*OpsgenieSink, error) {
+	o := &OpsgenieSink{
+		runbooks:      runbooks,
+		name:          sink.Name,
+		apiKey:        sharedtools.MustTemplateString(sink.Config["apiKey"], nil, ""),
+		url:           strings.TrimSuffix(sharedtools.MustTemplateString(sink.Config["url"], nil, ""), "/"),
+		alias:         sink.Config["alias"],
+		message:       sink.Config["message"],
+		description:   sink.Config["description"],
+		priority:      sink.Config["priority"],
+		responders:    sink.Config["responders"],
+		responderType: sink.Config["responderType"],
+		tags:          sink.Config["tags"],
+		entity:        sink.Config["entity"],
+		client:        &http.Client{Timeout: 10 * time.Second},
+		retry:         retryPolicyFromConfig(sink.Config),
+		groups:        newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("opsgenie sink %s requires apiKey", sink.Name)
+	}
+	if o.url == "" {
+		o.url = defaultOpsgenieURL
+	}
+	if o.alias == "" {
+		o.alias = "{{ .Title }}"
+	}
+	if o.message == "" {
+		o.message = "{{ .Title }}"
+	}
+	if o.description == "" {
+		o.description = defaultOpsgenieDescription
+		if runbooks.OncallMessage.SimpleMessage != "" {
+			o.description = runbooks.OncallMessage.SimpleMessage
+		}
+	}
+	if o.priority == "" {
+		o.priority = defaultOpsgeniePriority
+	}
+	if o.responders == "" {
+		o.responders = defaultOpsgenieResponders
+	}
+	if o.responderType == "" {
+		o.responderType = "team"
+	}
+	return o, nil
+}
+
+func (o *OpsgenieSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(o.runbooks, alerts, o.alias) {
+		group := o.groups.get(truncate(batch.Key, 512), batch.Title)
+		group.merge(batch.Alerts)
+		if o.groups.unknownResolved(group) {
+			log.Infof("resolved alert group %s is unknown to opsgenie sink %s, closing it by alias", group.Key, o.name)
+		}
+
+		if err := o.sendGroup(group); err != nil {
+			log.Errorf("can't send alert group %s to opsgenie sink %s: %s", group.Key, o.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		o.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (o *OpsgenieSink) sendGroup(group *AlertGroup) error {
+	alertPath := "/v2/alerts/" + url.PathEscape(group.Key)
+	if group.Resolved() {
+		return o.send(http.MethodPost, alertPath+"/close", map[string]string{"source": "alertsforge", "note": "all alerts are resolved"})
+	}
+
+	alert := o.alert(group)
+	if group.Refs[opsgenieCreatedRef] == "" {
+		if err := o.send(http.MethodPost, "/v2/alerts", alert); err != nil {
+			return err
+		}
+		group.Refs[opsgenieCreatedRef] = "true"
+		return nil
+	}
+	if err := o.send(http.MethodPut, alertPath+"/description", map[string]string{"description": alert.Description}); err != nil {
+		return err
+	}
+	if err := o.send(http.MethodPut, alertPath+"/priority", map[string]string{"priority": alert.Priority}); err != nil {
+		return err
+	}
+	return o.send(http.MethodPost, alertPath+"/details", map[string]any{"details": alert.Details})
+}
+
+func (o *OpsgenieSink) alert(group *AlertGroup) OpsgenieAlert {
+	variables := group.Template()
+	priority := strings.ToUpper(sharedtools.MustTemplateString(o.priority, variables, defaultOpsgeniePriority))
+	if !slices.Contains(opsgeniePriorities, priority) {
+		zap.S().Warnf("unknown opsgenie priority %q of %s, using %s", priority, group.Key, defaultOpsgeniePriority)
+		priority = defaultOpsgeniePriority
+	}
+
+	responders := []OpsgenieResponder{}
+	for _, responder := range splitList(sharedtools.MustTemplateString(o.responders, variables, "")) {
+		responderType, name, found := strings.Cut(responder, ":")
+		if !found {
+			responderType, name = o.responderType, responder
+		}
+		responders = append(responders, OpsgenieResponder{Type: responderType, Name: name})
+	}
+
+	details := map[string]string{}
+	for key, value := range variables.Labels {
+		details[key] = truncate(value, 8000)
+	}
+
+	return OpsgenieAlert{
+		Message:     truncate(sharedtools.MustTemplateString(o.message, variables, group.Title), 130),
+		Alias:       group.Key,
+		Description: truncate(sharedtools.MustTemplateString(o.description, variables, "error while parsing description"), 15000),
+		Responders:  responders,
+		Tags:        splitList(sharedtools.MustTemplateString(o.tags, variables, "")),
+		Details:     details,
+		Entity:      sharedtools.MustTemplateString(o.entity, variables, ""),
+		Source:      "alertsforge",
+		Priority:    priority,
+	}
+}
+
+func (o *OpsgenieSink) send(method, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	requestURL := o.url + path
+	if path != "/v2/alerts" {
+		requestURL += "?identifierType=alias"
+	}
+	_, err = sendWithRetry(o.client, o.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Authorization", "GenieKey "+o.apiKey)
+		return req, nil
+	})
+	return err
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
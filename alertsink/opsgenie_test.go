@@ -0,0 +1,124 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type opsgenieRequest struct {
+	Method string
+	URL    string
+	Body   map[string]any
+}
+
+func TestOpsgenieSink_SendAlerts(t *testing.T) {
+	requests := []opsgenieRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GenieKey api-key", r.Header.Get("Authorization"))
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, opsgenieRequest{Method: r.Method, URL: r.URL.String(), Body: body})
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"result":"Request will be processed","took":0.1,"requestId":"43a29c5c"}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewAlertSink(config.Sink{Name: "opsgenie", Type: Opsgenie, Config: map[string]string{
+		"apiKey":     "api-key",
+		"url":        server.URL,
+		"priority":   `{{ if eq .Labels.severity "critical" }}p1{{ else }}P4{{ end }}`,
+		"responders": "{{ .Labels.alertsforge_escalation_chain }}, escalation:infra-escalation",
+		"tags":       "{{ .Labels.namespace }},alertsforge",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	labels := map[string]string{"alertname": "HighCPU", "severity": "critical", "namespace": "prod", "alertsforge_escalation_chain": "devops"}
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Pending, Labels: labels, Annotations: map[string]string{"description": "cpu is high"}},
+	})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "/v2/alerts", requests[0].URL)
+	assert.Equal(t, map[string]any{
+		"message":     "HighCPU",
+		"alias":       "HighCPU",
+		"description": "\ncpu is high",
+		"responders": []any{
+			map[string]any{"type": "team", "name": "devops"},
+			map[string]any{"type": "escalation", "name": "infra-escalation"},
+		},
+		"tags": []any{"prod", "alertsforge"},
+		"details": map[string]any{
+			"alertname":                    "HighCPU",
+			"severity":                     "critical",
+			"namespace":                    "prod",
+			"alertsforge_escalation_chain": "devops",
+		},
+		"source":   "alertsforge",
+		"priority": "P1",
+	}, requests[0].Body)
+
+	// existing alert is updated
+	requests = nil
+	accepted, _, errs = sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "2", Status: sharedtools.Firing, StartsAt: time.Now(), Labels: map[string]string{"alertname": "HighCPU", "severity": "warning"}},
+	})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"2"}, accepted)
+	require.Len(t, requests, 3)
+	assert.Equal(t, "/v2/alerts/HighCPU/description?identifierType=alias", requests[0].URL)
+	assert.Equal(t, http.MethodPut, requests[0].Method)
+	assert.Equal(t, "/v2/alerts/HighCPU/priority?identifierType=alias", requests[1].URL)
+	assert.Equal(t, map[string]any{"priority": "P4"}, requests[1].Body)
+	assert.Equal(t, "/v2/alerts/HighCPU/details?identifierType=alias", requests[2].URL)
+
+	// alert is closed when the whole group is resolved
+	requests = nil
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels},
+		{Fingerprint: "2", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "HighCPU"}},
+	})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, resolved)
+	require.Len(t, requests, 1)
+	assert.Equal(t, http.MethodPost, requests[0].Method)
+	assert.Equal(t, "/v2/alerts/HighCPU/close?identifierType=alias", requests[0].URL)
+	assert.Empty(t, sink.(*OpsgenieSink).groups.groups)
+
+	// group unknown after restart is closed by alias
+	requests = nil
+	sink, err = NewAlertSink(config.Sink{Name: "opsgenie", Type: Opsgenie, Config: map[string]string{"apiKey": "api-key", "url": server.URL}}, &slackRunbooks)
+	require.NoError(t, err)
+	_, resolved, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "3", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"3"}, resolved)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/v2/alerts/DiskFull/close?identifierType=alias", requests[0].URL)
+}
+
+func TestOpsgenieSink_Errors(t *testing.T) {
+	_, err := NewOpsgenieSink(config.Sink{Name: "opsgenie", Type: Opsgenie}, &slackRunbooks)
+	assert.Error(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message":"Request body is not processable"}`))
+	}))
+	defer server.Close()
+	sink, err := NewOpsgenieSink(config.Sink{Name: "opsgenie", Type: Opsgenie, Config: map[string]string{"apiKey": "key", "url": server.URL}}, &slackRunbooks)
+	require.NoError(t, err)
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "422")
+}
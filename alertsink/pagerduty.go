@@ -0,0 +1,201 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	PagerDuty = "pagerduty"
+
+	defaultPagerDutyURL      = "https://events.pagerduty.com/v2/enqueue"
+	defaultPagerDutySeverity = "critical"
+
+	pagerDutyTrigger = "trigger"
+	pagerDutyResolve = "resolve"
+)
+
+var pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+
+// PagerDutySink sends events api v2 events, alerts with the same dedup key form one pagerduty alert which is
+// triggered again on every change and resolved when all alerts with the key are resolved
+type PagerDutySink struct {
+	runbooks     *config.RunbooksConfig
+	name         string
+	routingKey   string
+	url          string
+	dedupKey     string
+	severity     string
+	summary      string
+	source       string
+	component    string
+	group        string
+	class        string
+	artifactsURL string
+	client       *http.Client
+	retry        RetryPolicy
+	groups       *groupStore
+}
+
+type PagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *PagerDutyPayload `json:"payload,omitempty"`
+	Client      string            `json:"client,omitempty"`
+	Links       []Link            `json:"links,omitempty"`
+	Images      []Image           `json:"images,omitempty"`
+}
+
+type PagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     string         `json:"timestamp,omitempty"`
+	Component     string         `json:"component,omitempty"`
+	Group         string         `json:"group,omitempty"`
+	Class         string         `json:"class,omitempty"`
+	CustomDetails map[string]any `json:"custom_details,omitempty"`
+}
+
+// NewPagerDutySink creates pagerduty sink from sink config: routingKey is required, dedupKey defaults to title,
+// severity, summary, source, component, group and class are templates over AlertTemplate of the group,
+// artifactsUrl is prefix of enricher files in bucket which are attached as links and images
+func NewPagerDutySink(sink config.Sink, runbooks *config.RunbooksConfig) (*PagerDutySink, error) {
+	p := &PagerDutySink{
+		runbooks:     runbooks,
+		name:         sink.Name,
+		routingKey:   sharedtools.MustTemplateString(sink.Config["routingKey"], nil, ""),
+		url:          sharedtools.MustTemplateString(sink.Config["url"], nil, ""),
+		dedupKey:     sink.Config["dedupKey"],
+		severity:     sink.Config["severity"],
+		summary:      sink.Config["summary"],
+		source:       sink.Config["source"],
+		component:    sink.Config["component"],
+		group:        sink.Config["group"],
+		class:        sink.Config["class"],
+		artifactsURL: sink.Config["artifactsUrl"],
+		client:       &http.Client{Timeout: 10 * time.Second},
+		retry:        retryPolicyFromConfig(sink.Config),
+		groups:       newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if p.routingKey == "" {
+		return nil, fmt.Errorf("pagerduty sink %s requires routingKey", sink.Name)
+	}
+	if p.url == "" {
+		p.url = defaultPagerDutyURL
+	}
+	if p.dedupKey == "" {
+		p.dedupKey = "{{ .Title }}"
+	}
+	if p.severity == "" {
+		p.severity = defaultPagerDutySeverity
+	}
+	if p.summary == "" {
+		p.summary = "{{ .Title }}"
+	}
+	if p.source == "" {
+		p.source = "alertsforge"
+	}
+	return p, nil
+}
+
+func (p *PagerDutySink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(p.runbooks, alerts, p.dedupKey) {
+		group := p.groups.get(batch.Key, batch.Title)
+		group.merge(batch.Alerts)
+		if p.groups.unknownResolved(group) {
+			log.Infof("resolved alert group %s is unknown to pagerduty sink %s, closing it by dedup key", group.Key, p.name)
+		}
+
+		if err := p.send(p.event(group)); err != nil {
+			log.Errorf("can't send alert group %s to pagerduty sink %s: %s", batch.Key, p.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		p.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (p *PagerDutySink) event(group *AlertGroup) PagerDutyEvent {
+	event := PagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: pagerDutyResolve,
+		DedupKey:    group.Key,
+	}
+	if group.Resolved() {
+		return event
+	}
+
+	variables := group.Template()
+	severity := sharedtools.MustTemplateString(p.severity, variables, defaultPagerDutySeverity)
+	if !slices.Contains(pagerDutySeverities, severity) {
+		zap.S().Warnf("unknown pagerduty severity %q of %s, using %s", severity, group.Key, defaultPagerDutySeverity)
+		severity = defaultPagerDutySeverity
+	}
+	firing, resolved := []map[string]any{}, []map[string]any{}
+	for _, alert := range variables.FiringAlerts {
+		firing = append(firing, map[string]any{"labels": alert.Labels, "annotations": alert.Annotations, "startsAt": alert.StartsAt})
+	}
+	for _, alert := range variables.ResolvedAlerts {
+		resolved = append(resolved, map[string]any{"labels": alert.Labels, "endsAt": alert.EndsAt})
+	}
+	startsAt := variables.FiringAlerts[len(variables.FiringAlerts)-1].StartsAt
+
+	event.EventAction = pagerDutyTrigger
+	event.Client = "alertsforge"
+	event.Links, event.Images = groupArtifacts(variables.FiringAlerts, p.artifactsURL)
+	event.Payload = &PagerDutyPayload{
+		Summary:   truncate(sharedtools.MustTemplateString(p.summary, variables, group.Title), 1024),
+		Source:    sharedtools.MustTemplateString(p.source, variables, "alertsforge"),
+		Severity:  severity,
+		Component: sharedtools.MustTemplateString(p.component, variables, ""),
+		Group:     sharedtools.MustTemplateString(p.group, variables, ""),
+		Class:     sharedtools.MustTemplateString(p.class, variables, ""),
+		CustomDetails: map[string]any{
+			"firing":   firing,
+			"resolved": resolved,
+		},
+	}
+	if !startsAt.IsZero() {
+		event.Payload.Timestamp = startsAt.Format(time.RFC3339)
+	}
+	return event
+}
+
+func (p *PagerDutySink) send(event PagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = sendWithRetry(p.client, p.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
+	return err
+}
+
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length-1]) + "…"
+}
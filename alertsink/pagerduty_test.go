@@ -0,0 +1,181 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPagerDutySink_SendAlerts(t *testing.T) {
+	noSleep(t)
+	events := []PagerDutyEvent{}
+	throttle := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if throttle > 0 {
+			throttle--
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		event := PagerDutyEvent{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"success","message":"Event processed"}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewAlertSink(config.Sink{Name: "pd", Type: PagerDuty, Config: map[string]string{
+		"routingKey":   "R0UT1NGK3Y",
+		"url":          server.URL,
+		"severity":     "{{ .Labels.severity }}",
+		"summary":      "{{ .Title }}: {{ len .FiringAlerts }} firing",
+		"component":    "{{ .Labels.namespace }}",
+		"artifactsUrl": "https://alertsforge-static/",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	startsAt := time.Date(2024, 6, 5, 19, 0, 0, 0, time.UTC)
+	alerts := []sharedtools.Alert{
+		{
+			Fingerprint: "1",
+			Status:      sharedtools.Pending,
+			StartsAt:    startsAt,
+			Labels: map[string]string{
+				"alertname":                   "HighCPU",
+				"severity":                    "warning",
+				"namespace":                   "prod",
+				"alertsforge_grafana_pod_cpu": "2024-06-05/abc.png",
+				"alertsforge_grafana_pod_cpu_dashboard_url": "https://grafana/d/cpu",
+				"alertsforge_pod_logs_stdout":               "2024-06-05/abc_stdout.txt",
+			},
+		},
+		{
+			Fingerprint: "2",
+			Status:      sharedtools.Pending,
+			StartsAt:    startsAt.Add(time.Minute),
+			Labels:      map[string]string{"alertname": "HighCPU", "severity": "page"},
+		},
+		{
+			Fingerprint: "3",
+			Status:      sharedtools.Pending,
+			StartsAt:    startsAt,
+			Labels:      map[string]string{"alertname": "DiskFull", "severity": "error"},
+		},
+	}
+	accepted, resolved, errs := sink.SendAlerts(alerts)
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, accepted)
+	assert.Empty(t, resolved)
+	require.Len(t, events, 2)
+
+	disk, cpu := events[0], events[1]
+	assert.Equal(t, "DiskFull", disk.DedupKey)
+	assert.Equal(t, "error", disk.Payload.Severity)
+
+	assert.Equal(t, "R0UT1NGK3Y", cpu.RoutingKey)
+	assert.Equal(t, pagerDutyTrigger, cpu.EventAction)
+	assert.Equal(t, "HighCPU", cpu.DedupKey)
+	assert.Equal(t, "HighCPU: 2 firing", cpu.Payload.Summary)
+	// severity of the latest alert is unknown to pagerduty
+	assert.Equal(t, defaultPagerDutySeverity, cpu.Payload.Severity)
+	assert.Equal(t, "alertsforge", cpu.Payload.Source)
+	assert.Equal(t, "2024-06-05T19:00:00Z", cpu.Payload.Timestamp)
+	assert.Equal(t, []Image{{Src: "https://alertsforge-static/2024-06-05/abc.png", Href: "https://grafana/d/cpu", Alt: "alertsforge_grafana_pod_cpu"}}, cpu.Images)
+	assert.Equal(t, []Link{
+		{Href: "https://grafana/d/cpu", Text: "alertsforge_grafana_pod_cpu_dashboard_url"},
+		{Href: "https://alertsforge-static/2024-06-05/abc_stdout.txt", Text: "alertsforge_pod_logs_stdout"},
+	}, cpu.Links)
+	assert.Len(t, cpu.Payload.CustomDetails["firing"], 2)
+
+	// partially resolved group is triggered again, fully resolved one is resolved
+	events = nil
+	_, resolved, errs = sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Resolved, Labels: alerts[0].Labels},
+		{Fingerprint: "3", Status: sharedtools.Resolved, Labels: alerts[2].Labels},
+	})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "3"}, resolved)
+	require.Len(t, events, 2)
+	assert.Equal(t, PagerDutyEvent{RoutingKey: "R0UT1NGK3Y", EventAction: pagerDutyResolve, DedupKey: "DiskFull"}, events[0])
+	assert.Equal(t, pagerDutyTrigger, events[1].EventAction)
+	assert.Equal(t, "HighCPU: 1 firing", events[1].Payload.Summary)
+	assert.Len(t, events[1].Payload.CustomDetails["resolved"], 1)
+}
+
+func TestPagerDutySink_Errors(t *testing.T) {
+	noSleep(t)
+	_, err := NewPagerDutySink(config.Sink{Name: "pd", Type: PagerDuty}, &slackRunbooks)
+	assert.Error(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"invalid event","errors":["'routing_key' is invalid"]}`))
+	}))
+	defer server.Close()
+	sink, err := NewPagerDutySink(config.Sink{Name: "pd", Type: PagerDuty, Config: map[string]string{
+		"routingKey": "wrong",
+		"url":        server.URL,
+		"dedupKey":   "{{ .Labels.alertname }}-{{ .Labels.namespace }}",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU", "namespace": "prod"}}})
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "routing_key")
+	assert.Empty(t, sink.groups.groups)
+}
+
+func TestPagerDutySink_UnknownResolvedGroup(t *testing.T) {
+	events := []PagerDutyEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := PagerDutyEvent{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	newSink := func(statePath string) SinkInterface {
+		sink, err := NewAlertSink(config.Sink{Name: "pd", Type: PagerDuty, Config: map[string]string{"routingKey": "key", "url": server.URL, "statePath": statePath}}, &slackRunbooks)
+		require.NoError(t, err)
+		return sink
+	}
+	firing := sharedtools.Alert{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}
+	resolvedAlert := sharedtools.Alert{Fingerprint: "2", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "HighCPU"}}
+
+	// after restart with lost state resolved group is closed by dedup key
+	t.Setenv("AF_BUFFER_PATH", "")
+	_, _, errs := newSink("").SendAlerts([]sharedtools.Alert{firing})
+	require.Empty(t, errs)
+	accepted, resolved, errs := newSink("").SendAlerts([]sharedtools.Alert{resolvedAlert})
+	assert.Empty(t, errs)
+	assert.Empty(t, accepted)
+	assert.Equal(t, []string{"2"}, resolved)
+	require.Len(t, events, 2)
+	assert.Equal(t, pagerDutyResolve, events[1].EventAction)
+	assert.Equal(t, "HighCPU", events[1].DedupKey)
+
+	// groups are kept next to AF_BUFFER_PATH by default, so resolved alert doesn't close group of firing siblings
+	t.Setenv("AF_BUFFER_PATH", filepath.Join(t.TempDir(), "buffer.jsonl"))
+	_, _, errs = newSink("").SendAlerts([]sharedtools.Alert{firing, resolvedAlert})
+	require.Empty(t, errs)
+	_, resolved, errs = newSink("").SendAlerts([]sharedtools.Alert{resolvedAlert})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"2"}, resolved)
+	require.Len(t, events, 4)
+	assert.Equal(t, pagerDutyTrigger, events[3].EventAction)
+	firing.Status = sharedtools.Resolved
+	_, resolved, errs = newSink("").SendAlerts([]sharedtools.Alert{firing})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, events, 5)
+	assert.Equal(t, pagerDutyResolve, events[4].EventAction)
+}
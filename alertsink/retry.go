@@ -0,0 +1,178 @@
+package alertsink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy describes how many times request is sent and how long to wait between attempts,
+// backoff grows exponentially with jitter and Retry-After header of response is respected up to MaxBackoff
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 30 * time.Second}
+
+// maxRetryBackoff limits backoff when MaxBackoff of policy is not set
+const maxRetryBackoff = time.Hour
+
+// sleep is replaced in tests
+var sleep = time.Sleep
+
+// retryPolicyFromConfig reads retryAttempts, retryBackoff and retryMaxBackoff of sink config
+func retryPolicyFromConfig(config map[string]string) RetryPolicy {
+	policy := defaultRetryPolicy
+	if attempts, err := strconv.Atoi(config["retryAttempts"]); err == nil && attempts > 0 {
+		policy.Attempts = attempts
+	}
+	if backoff, err := time.ParseDuration(config["retryBackoff"]); err == nil {
+		policy.Backoff = backoff
+	}
+	if maxBackoff, err := time.ParseDuration(config["retryMaxBackoff"]); err == nil {
+		policy.MaxBackoff = maxBackoff
+	}
+	return policy
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status < 300
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// HTTPResponse is the response of the last attempt
+type HTTPResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// sendWithRetry sends request created by newRequest until success predicate is true,
+// network errors, 429 and 5xx responses are retried, other responses are returned as error right away
+func sendWithRetry(client *http.Client, policy RetryPolicy, success func(status int) bool, newRequest func() (*http.Request, error)) (*HTTPResponse, error) {
+	return sendWithRetryAs(client, policy, "", success, newRequest)
+}
+
+// sendWithRetryAs is sendWithRetry which names request with label instead of url in logs and errors,
+// it's used for urls with secrets in path like telegram bot token
+func sendWithRetryAs(client *http.Client, policy RetryPolicy, label string, success func(status int) bool, newRequest func() (*http.Request, error)) (*HTTPResponse, error) {
+	if success == nil {
+		success = isSuccessStatus
+	}
+	attempts := policy.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			sleep(retryDelay(policy, attempt, lastErr))
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		name := label
+		if name == "" {
+			name = req.URL.Redacted()
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				urlErr.URL = name
+			}
+			zap.S().Warnf("request to %s failed, attempt %d/%d: %s", name, attempt+1, attempts, err)
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		response := &HTTPResponse{StatusCode: res.StatusCode, Header: res.Header, Body: body}
+		if success(res.StatusCode) {
+			return response, nil
+		}
+		statusErr := &StatusError{Response: response, URL: name}
+		if !isRetryableStatus(res.StatusCode) {
+			return response, statusErr
+		}
+		zap.S().Warnf("%s, attempt %d/%d", statusErr, attempt+1, attempts)
+		lastErr = statusErr
+	}
+	if statusErr, ok := lastErr.(*StatusError); ok {
+		return statusErr.Response, statusErr
+	}
+	return nil, lastErr
+}
+
+// StatusError is returned when response status is not successful
+type StatusError struct {
+	Response *HTTPResponse
+	URL      string
+}
+
+func (e *StatusError) Error() string {
+	body := string(e.Response.Body)
+	if len(body) > 512 {
+		body = body[:512]
+	}
+	return fmt.Sprintf("unexpected status code %d from %s: %s", e.Response.StatusCode, e.URL, body)
+}
+
+func retryDelay(policy RetryPolicy, attempt int, lastErr error) time.Duration {
+	if statusErr, ok := lastErr.(*StatusError); ok {
+		if retryAfter := parseRetryAfter(statusErr.Response.Header.Get("Retry-After")); retryAfter > 0 {
+			if policy.MaxBackoff > 0 && retryAfter > policy.MaxBackoff {
+				return policy.MaxBackoff
+			}
+			return retryAfter
+		}
+	}
+	if policy.Backoff <= 0 {
+		return 0
+	}
+	maxBackoff := policy.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = maxRetryBackoff
+	}
+	// doubling stops at maxBackoff, shift by attempt would overflow with many attempts
+	delay := policy.Backoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff || delay <= 0 {
+		delay = maxBackoff
+	}
+	// full jitter in upper half of delay, so replicas retrying together spread out
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter supports both seconds and http date forms
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package alertsink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noSleep disables waiting between retries and returns delays which would be used
+func noSleep(t *testing.T) *[]time.Duration {
+	delays := []time.Duration{}
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+	return &delays
+}
+
+func TestSendWithRetry(t *testing.T) {
+	delays := noSleep(t)
+	statuses := []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusOK}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := statuses[requests]
+		requests++
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	newRequest := func() (*http.Request, error) { return http.NewRequest(http.MethodPost, server.URL, nil) }
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	response, err := sendWithRetry(server.Client(), policy, nil, newRequest)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "body", string(response.Body))
+	assert.Equal(t, 3, requests)
+	require.Len(t, *delays, 2)
+	assert.Equal(t, 7*time.Second, (*delays)[0])
+	assert.GreaterOrEqual(t, (*delays)[1], time.Second)
+	assert.LessOrEqual(t, (*delays)[1], 2*time.Second)
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		statuses = []int{http.StatusBadRequest}
+		requests = 0
+		response, err := sendWithRetry(server.Client(), policy, nil, newRequest)
+		assert.Error(t, err)
+		assert.IsType(t, &StatusError{}, err)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("attempts are exhausted", func(t *testing.T) {
+		statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}
+		requests = 0
+		_, err := sendWithRetry(server.Client(), policy, nil, newRequest)
+		assert.ErrorContains(t, err, "unexpected status code 503")
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("custom success predicate", func(t *testing.T) {
+		statuses = []int{http.StatusConflict}
+		requests = 0
+		_, err := sendWithRetry(server.Client(), policy, func(status int) bool { return status == http.StatusConflict }, newRequest)
+		assert.NoError(t, err)
+	})
+}
+
+func TestRetryPolicyFromConfig(t *testing.T) {
+	assert.Equal(t, defaultRetryPolicy, retryPolicyFromConfig(nil))
+	assert.Equal(t, RetryPolicy{Attempts: 5, Backoff: time.Second, MaxBackoff: time.Minute}, retryPolicyFromConfig(map[string]string{
+		"retryAttempts":   "5",
+		"retryBackoff":    "1s",
+		"retryMaxBackoff": "1m",
+	}))
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{Attempts: 100, Backoff: time.Second}
+	for _, attempt := range []int{1, 2, 40, 64, 99} {
+		delay := retryDelay(policy, attempt, nil)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.LessOrEqual(t, delay, maxRetryBackoff)
+	}
+	assert.GreaterOrEqual(t, retryDelay(policy, 99, nil), maxRetryBackoff/2)
+
+	policy.MaxBackoff = 10 * time.Second
+	assert.LessOrEqual(t, retryDelay(policy, 70, nil), 10*time.Second)
+	assert.Equal(t, time.Duration(0), retryDelay(RetryPolicy{Attempts: 3}, 2, nil))
+}
+
+func TestSendWithRetryAs(t *testing.T) {
+	noSleep(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	secretURL := server.URL + "/botS3CR3T/sendMessage"
+	newRequest := func() (*http.Request, error) { return http.NewRequest(http.MethodPost, secretURL, nil) }
+	policy := RetryPolicy{Attempts: 2}
+
+	_, err := sendWithRetryAs(server.Client(), policy, "telegram sendMessage", nil, newRequest)
+	assert.ErrorContains(t, err, "unexpected status code 502 from telegram sendMessage")
+	assert.NotContains(t, err.Error(), "S3CR3T")
+
+	server.Close()
+	_, err = sendWithRetryAs(server.Client(), policy, "telegram sendMessage", nil, newRequest)
+	assert.ErrorContains(t, err, "telegram sendMessage")
+	assert.NotContains(t, err.Error(), "S3CR3T")
+}
@@ -0,0 +1,124 @@
+package alertsink
+
+import (
+	"fmt"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+type RouterInterface interface {
+	Route(labels map[string]string) []string
+	Sink(name string) (SinkInterface, bool)
+	SinkNames() []string
+}
+
+// Router selects sinks for alert with routing tree
+type Router struct {
+	route config.Route
+	sinks map[string]SinkInterface
+}
+
+// NewRouter creates sinks and routing tree from runbooks, oncall sink is used if no sinks are configured
+// and all sinks get every alert if route is absent
+func NewRouter(runbooks *config.RunbooksConfig) (*Router, error) {
+	sinksConfig := runbooks.Sinks
+	if len(sinksConfig) == 0 {
+		sinksConfig = []config.Sink{{Name: Oncall, Type: Oncall}}
+	}
+	sinks := map[string]SinkInterface{}
+	names := []string{}
+	for _, sinkConfig := range sinksConfig {
+		if sinkConfig.Name == "" {
+			return nil, fmt.Errorf("sink of type %s has no name", sinkConfig.Type)
+		}
+		if _, ok := sinks[sinkConfig.Name]; ok {
+			return nil, fmt.Errorf("duplicate sink name %s", sinkConfig.Name)
+		}
+		sink, err := NewAlertSink(sinkConfig, runbooks)
+		if err != nil {
+			return nil, err
+		}
+		sinks[sinkConfig.Name] = sink
+		names = append(names, sinkConfig.Name)
+	}
+
+	route := config.Route{Sinks: names}
+	if runbooks.Route != nil {
+		route = *runbooks.Route
+	}
+	return NewRouterWithSinks(route, sinks)
+}
+
+// NewRouterWithSinks creates router over already created sinks
+func NewRouterWithSinks(route config.Route, sinks map[string]SinkInterface) (*Router, error) {
+	if err := validateRoute(route, sinks); err != nil {
+		return nil, err
+	}
+	return &Router{route: route, sinks: sinks}, nil
+}
+
+func validateRoute(route config.Route, sinks map[string]SinkInterface) error {
+	for _, name := range route.Sinks {
+		if _, ok := sinks[name]; !ok {
+			return fmt.Errorf("route refers to unknown sink %s", name)
+		}
+	}
+	for _, child := range route.Routes {
+		if err := validateRoute(child, sinks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Route returns names of sinks for alert labels, every sink is returned once
+func (r *Router) Route(labels map[string]string) []string {
+	sinks, _ := matchRoute(r.route, labels, nil)
+	result := []string{}
+	for _, sink := range sinks {
+		if !slices.Contains(result, sink) {
+			result = append(result, sink)
+		}
+	}
+	return result
+}
+
+func (r *Router) Sink(name string) (SinkInterface, bool) {
+	sink, ok := r.sinks[name]
+	return sink, ok
+}
+
+// SinkNames returns sorted names of all sinks
+func (r *Router) SinkNames() []string {
+	names := maps.Keys(r.sinks)
+	slices.Sort(names)
+	return names
+}
+
+func matchRoute(route config.Route, labels map[string]string, inherited []string) ([]string, bool) {
+	if !sharedtools.MatchLabels(labels, route.LabelsSelector) {
+		return nil, false
+	}
+	sinks := route.Sinks
+	if len(sinks) == 0 {
+		sinks = inherited
+	}
+	result := []string{}
+	matched := false
+	for _, child := range route.Routes {
+		if childSinks, ok := matchRoute(child, labels, sinks); ok {
+			result = append(result, childSinks...)
+			matched = true
+			if !child.Continue {
+				break
+			}
+		}
+	}
+	if !matched {
+		return sinks, true
+	}
+	return result, true
+}
@@ -0,0 +1,78 @@
+package alertsink
+
+import (
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nopSink struct{}
+
+func (n *nopSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	return
+}
+
+func TestRouter_Route(t *testing.T) {
+	sinks := map[string]SinkInterface{"oncall": &nopSink{}, "slack": &nopSink{}, "telegram": &nopSink{}, "email": &nopSink{}}
+	router, err := NewRouterWithSinks(config.Route{
+		Sinks: []string{"oncall"},
+		Routes: []config.Route{
+			{LabelsSelector: map[string]string{"severity": "info"}, Sinks: []string{"slack"}},
+			{LabelsSelector: map[string]string{"team": "db"}, Sinks: []string{"telegram"}, Continue: true},
+			{
+				LabelsSelector: map[string]string{"namespace": "prod-.+"},
+				Routes: []config.Route{
+					{LabelsSelector: map[string]string{"severity": "critical"}, Sinks: []string{"email", "oncall"}},
+				},
+			},
+		},
+	}, sinks)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected []string
+	}{
+		{name: "root", labels: map[string]string{"alertname": "test"}, expected: []string{"oncall"}},
+		{name: "first match wins", labels: map[string]string{"severity": "info", "team": "db"}, expected: []string{"slack"}},
+		{name: "continue", labels: map[string]string{"team": "db", "namespace": "prod-api"}, expected: []string{"telegram", "oncall"}},
+		{name: "continue without other matches", labels: map[string]string{"team": "db"}, expected: []string{"telegram"}},
+		{name: "nested", labels: map[string]string{"namespace": "prod-api", "severity": "critical"}, expected: []string{"email", "oncall"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, router.Route(tt.labels))
+		})
+	}
+
+	sink, ok := router.Sink("slack")
+	assert.True(t, ok)
+	assert.Equal(t, sinks["slack"], sink)
+	_, ok = router.Sink("unknown")
+	assert.False(t, ok)
+}
+
+func TestNewRouter(t *testing.T) {
+	router, err := NewRouter(&config.RunbooksConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{Oncall}, router.Route(map[string]string{"alertname": "test"}))
+	sink, _ := router.Sink(Oncall)
+	assert.IsType(t, &OncallSink{}, sink)
+
+	router, err = NewRouter(&config.RunbooksConfig{Sinks: []config.Sink{{Name: "primary", Type: Oncall}, {Name: "secondary", Type: Oncall}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"primary", "secondary"}, router.Route(map[string]string{"alertname": "test"}))
+
+	_, err = NewRouter(&config.RunbooksConfig{Sinks: []config.Sink{{Name: "pager", Type: "pagerduty"}}})
+	assert.Error(t, err)
+
+	_, err = NewRouter(&config.RunbooksConfig{Sinks: []config.Sink{{Name: "a", Type: Oncall}, {Name: "a", Type: Oncall}}})
+	assert.Error(t, err)
+
+	_, err = NewRouter(&config.RunbooksConfig{Route: &config.Route{Routes: []config.Route{{Sinks: []string{"slack"}}}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Slack = "slack"
+
+	defaultSlackAPIURL  = "https://slack.com/api"
+	defaultSlackMessage = `{{- range .FiringAlerts }}
+:red_circle: {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}
+{{- range .ResolvedAlerts }}
+:large_green_circle: {{ .Labels.alertname }} {{ .Annotations.description }}
+{{- end }}`
+
+	slackTsRef      = "slack_ts"
+	slackChannelRef = "slack_channel"
+)
+
+// SlackSink posts one message per alert group, with bot token message is updated on every change of the group
+// using stored ts, with incoming webhook new message is posted because webhook messages can't be edited
+type SlackSink struct {
+	runbooks   *config.RunbooksConfig
+	name       string
+	webhookURL string
+	token      string
+	apiURL     string
+	channel    string
+	message    string
+	blocks     string
+	client     *http.Client
+	retry      RetryPolicy
+	groups     *groupStore
+}
+
+type slackMessage struct {
+	Channel string          `json:"channel,omitempty"`
+	Ts      string          `json:"ts,omitempty"`
+	Text    string          `json:"text"`
+	Blocks  json.RawMessage `json:"blocks,omitempty"`
+}
+
+type slackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Ts      string `json:"ts"`
+	Channel string `json:"channel"`
+}
+
+// NewSlackSink creates slack sink from sink config:
+// webhookUrl or token and channel are required, they are templates so can be taken from env with {{ env "AF_SLACK_TOKEN" }},
+// channel is rendered for every alert group; message and blocks are templates over AlertTemplate of the group,
+// message defaults to oncall_message.slack_message prefixed with title, blocks must render to Block Kit json array
+func NewSlackSink(sink config.Sink, runbooks *config.RunbooksConfig) (*SlackSink, error) {
+	s := &SlackSink{
+		runbooks:   runbooks,
+		name:       sink.Name,
+		webhookURL: sharedtools.MustTemplateString(sink.Config["webhookUrl"], nil, ""),
+		token:      sharedtools.MustTemplateString(sink.Config["token"], nil, ""),
+		apiURL:     strings.TrimSuffix(sharedtools.MustTemplateString(sink.Config["apiUrl"], nil, ""), "/"),
+		channel:    sink.Config["channel"],
+		message:    sink.Config["message"],
+		blocks:     sink.Config["blocks"],
+		client:     &http.Client{Timeout: 10 * time.Second},
+		retry:      retryPolicyFromConfig(sink.Config),
+		groups:     newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if s.webhookURL == "" && (s.token == "" || s.channel == "") {
+		return nil, fmt.Errorf("slack sink %s requires webhookUrl or token and channel", sink.Name)
+	}
+	if s.apiURL == "" {
+		s.apiURL = defaultSlackAPIURL
+	}
+	if s.message == "" {
+		s.message = defaultSlackMessage
+		if runbooks.OncallMessage.SlackMessage != "" {
+			s.message = runbooks.OncallMessage.SlackMessage
+		}
+		s.message = "*{{ .Title }}*\n" + s.message
+	}
+	return s, nil
+}
+
+func (s *SlackSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(s.runbooks, alerts, "") {
+		group := s.groups.get(batch.Key, batch.Title)
+		group.merge(batch.Alerts)
+		if s.groups.unknownResolved(group) {
+			log.Warnf("resolved alert group %s is unknown to slack sink %s, its message can't be updated without stored state", group.Key, s.name)
+			_, resolvedInGroup := batchResult(batch.Alerts)
+			resolved = append(resolved, resolvedInGroup...)
+			continue
+		}
+
+		if err := s.sendGroup(group); err != nil {
+			log.Errorf("can't send alert group %s to slack sink %s: %s", batch.Title, s.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		s.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (s *SlackSink) sendGroup(group *AlertGroup) error {
+	variables := group.Template()
+	message := slackMessage{
+		Text: sharedtools.MustTemplateString(s.message, variables, "error while parsing slack message"),
+	}
+	if s.blocks != "" {
+		blocks, err := sharedtools.TemplateString(s.blocks, variables)
+		if err != nil {
+			return fmt.Errorf("can't render blocks: %w", err)
+		}
+		if !json.Valid([]byte(blocks)) {
+			return fmt.Errorf("blocks are not valid json: %s", blocks)
+		}
+		message.Blocks = json.RawMessage(blocks)
+	}
+
+	if s.webhookURL != "" {
+		_, err := s.post(s.webhookURL, message)
+		return err
+	}
+
+	method := "chat.postMessage"
+	message.Channel = sharedtools.MustTemplateString(s.channel, variables, s.channel)
+	if ts := group.Refs[slackTsRef]; ts != "" {
+		method = "chat.update"
+		message.Channel = group.Refs[slackChannelRef]
+		message.Ts = ts
+	}
+	body, err := s.post(s.apiURL+"/"+method, message)
+	if err != nil {
+		return err
+	}
+	response := slackResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("can't parse slack response: %w", err)
+	}
+	if !response.OK {
+		return fmt.Errorf("slack %s failed: %s", method, response.Error)
+	}
+	group.Refs[slackTsRef] = response.Ts
+	group.Refs[slackChannelRef] = response.Channel
+	return nil
+}
+
+func (s *SlackSink) post(url string, message slackMessage) ([]byte, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	response, err := sendWithRetry(s.client, s.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json; charset=utf-8")
+		if s.webhookURL == "" {
+			req.Header.Add("Authorization", "Bearer "+s.token)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
@@ -0,0 +1,161 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var slackRunbooks = config.RunbooksConfig{
+	OncallMessage: config.OncallMessage{
+		Title:        "{{ .Labels.alertname }}",
+		SlackMessage: template,
+	},
+}
+
+type fakeSlack struct {
+	server   *httptest.Server
+	requests []slackMessage
+	paths    []string
+	fail     bool
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := slackMessage{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		f.requests = append(f.requests, message)
+		f.paths = append(f.paths, r.URL.Path)
+		if r.URL.Path == "/webhook" {
+			w.Write([]byte("ok"))
+			return
+		}
+		assert.Equal(t, "Bearer xoxb-token", r.Header.Get("Authorization"))
+		if f.fail {
+			json.NewEncoder(w).Encode(slackResponse{OK: false, Error: "channel_not_found"})
+			return
+		}
+		json.NewEncoder(w).Encode(slackResponse{OK: true, Ts: "1700000000.000100", Channel: "C123"})
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func slackAlerts(status string, fingerprints ...string) []sharedtools.Alert {
+	alerts := []sharedtools.Alert{}
+	for i, fingerprint := range fingerprints {
+		alerts = append(alerts, sharedtools.Alert{
+			Fingerprint: fingerprint,
+			Status:      status,
+			Labels:      map[string]string{"alertname": "HighCPU"},
+			Annotations: map[string]string{"description": fingerprint},
+			StartsAt:    time.Now().Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return alerts
+}
+
+func TestSlackSink_PostMessage(t *testing.T) {
+	slack := newFakeSlack(t)
+	statePath := filepath.Join(t.TempDir(), "slack.json")
+	sink, err := NewSlackSink(config.Sink{Name: "slack", Type: Slack, Config: map[string]string{
+		"token":     "xoxb-token",
+		"channel":   "#alerts-{{ .Labels.alertname | lower }}",
+		"apiUrl":    slack.server.URL,
+		"statePath": statePath,
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	accepted, resolved, errs := sink.SendAlerts(slackAlerts(sharedtools.Pending, "1", "2"))
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, accepted)
+	assert.Empty(t, resolved)
+	require.Len(t, slack.requests, 1)
+	assert.Equal(t, "/chat.postMessage", slack.paths[0])
+	assert.Equal(t, "#alerts-highcpu", slack.requests[0].Channel)
+	assert.Equal(t, "*HighCPU*\n2\n1", slack.requests[0].Text)
+
+	// state survives restart and resolve updates the same message
+	sink, err = NewSlackSink(config.Sink{Name: "slack", Type: Slack, Config: map[string]string{
+		"token":     "xoxb-token",
+		"channel":   "#alerts",
+		"apiUrl":    slack.server.URL,
+		"statePath": statePath,
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+	accepted, resolved, errs = sink.SendAlerts(slackAlerts(sharedtools.Resolved, "1"))
+	assert.Empty(t, errs)
+	assert.Empty(t, accepted)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, slack.requests, 2)
+	assert.Equal(t, "/chat.update", slack.paths[1])
+	assert.Equal(t, "C123", slack.requests[1].Channel)
+	assert.Equal(t, "1700000000.000100", slack.requests[1].Ts)
+	assert.Equal(t, "*HighCPU*\n2\nResolved:\n1", slack.requests[1].Text)
+
+	// group is forgotten when all alerts are resolved
+	_, resolved, _ = sink.SendAlerts(slackAlerts(sharedtools.Resolved, "2"))
+	assert.Equal(t, []string{"2"}, resolved)
+	assert.Equal(t, "/chat.update", slack.paths[2])
+	state, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(state))
+
+	slack.fail = true
+	accepted, _, errs = sink.SendAlerts(slackAlerts(sharedtools.Firing, "3"))
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "channel_not_found")
+}
+
+func TestSlackSink_Webhook(t *testing.T) {
+	slack := newFakeSlack(t)
+	sink, err := NewSlackSink(config.Sink{Name: "slack", Type: Slack, Config: map[string]string{
+		"webhookUrl": slack.server.URL + "/webhook",
+		"message":    "{{ .Title }}: {{ len .FiringAlerts }} firing",
+		"blocks":     `[{"type":"section","text":{"type":"mrkdwn","text":"{{ .Title }}"}}]`,
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	accepted, _, errs := sink.SendAlerts(slackAlerts(sharedtools.Firing, "1"))
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	_, resolved, errs := sink.SendAlerts(slackAlerts(sharedtools.Resolved, "1"))
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+
+	require.Len(t, slack.requests, 2)
+	assert.Equal(t, "HighCPU: 1 firing", slack.requests[0].Text)
+	assert.Equal(t, "HighCPU: 0 firing", slack.requests[1].Text)
+	assert.JSONEq(t, `[{"type":"section","text":{"type":"mrkdwn","text":"HighCPU"}}]`, string(slack.requests[0].Blocks))
+	assert.Empty(t, slack.requests[0].Channel)
+
+	sink.blocks = `[{"type": {{ .Title }}]`
+	_, _, errs = sink.SendAlerts(slackAlerts(sharedtools.Firing, "1"))
+	assert.Len(t, errs, 1)
+}
+
+func TestNewSlackSink(t *testing.T) {
+	_, err := NewSlackSink(config.Sink{Name: "slack", Type: Slack, Config: map[string]string{"token": "xoxb"}}, &slackRunbooks)
+	assert.Error(t, err)
+
+	os.Setenv("AF_SLACK_TOKEN", "xoxb-env")
+	defer os.Setenv("AF_SLACK_TOKEN", "")
+	sink, err := NewAlertSink(config.Sink{Name: "slack", Type: Slack, Config: map[string]string{
+		"token":   `{{ env "AF_SLACK_TOKEN" }}`,
+		"channel": "#alerts",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-env", sink.(*SlackSink).token)
+	assert.Equal(t, defaultSlackAPIURL, sink.(*SlackSink).apiURL)
+}
@@ -0,0 +1,216 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	Teams = "teams"
+
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+)
+
+// TeamsSink posts Adaptive Card to Teams workflow webhook when alerts of the group start firing
+// and follow-up card when all alerts of the group are resolved, webhook messages can't be updated
+type TeamsSink struct {
+	runbooks     *config.RunbooksConfig
+	name         string
+	webhookURL   string
+	card         string
+	resolvedCard string
+	artifactsURL string
+	client       *http.Client
+	retry        RetryPolicy
+	groups       *groupStore
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string          `json:"contentType"`
+	ContentURL  *string         `json:"contentUrl"`
+	Content     json.RawMessage `json:"content"`
+}
+
+// NewTeamsSink creates teams sink from sink config: webhookUrl is required, card and resolvedCard are optional
+// templates over AlertTemplate of the group rendering Adaptive Card json, by default card has title,
+// facts from labels, grafana images from artifactsUrl and buttons to dashboards from *_dashboard_url labels
+func NewTeamsSink(sink config.Sink, runbooks *config.RunbooksConfig) (*TeamsSink, error) {
+	t := &TeamsSink{
+		runbooks:     runbooks,
+		name:         sink.Name,
+		webhookURL:   sharedtools.MustTemplateString(sink.Config["webhookUrl"], nil, ""),
+		card:         sink.Config["card"],
+		resolvedCard: sink.Config["resolvedCard"],
+		artifactsURL: sink.Config["artifactsUrl"],
+		client:       &http.Client{Timeout: 10 * time.Second},
+		retry:        retryPolicyFromConfig(sink.Config),
+		groups:       newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if t.webhookURL == "" {
+		return nil, fmt.Errorf("teams sink %s requires webhookUrl", sink.Name)
+	}
+	if t.resolvedCard == "" {
+		t.resolvedCard = t.card
+	}
+	return t, nil
+}
+
+func (t *TeamsSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(t.runbooks, alerts, "") {
+		group := t.groups.get(batch.Key, batch.Title)
+		newFiring := false
+		for _, alert := range batch.Alerts {
+			existing, ok := group.Alerts[alert.Fingerprint]
+			newFiring = newFiring || (alert.Status != sharedtools.Resolved && (!ok || existing.Status == sharedtools.Resolved))
+		}
+		group.merge(batch.Alerts)
+		if t.groups.unknownResolved(group) {
+			log.Warnf("resolved alert group %s is unknown to teams sink %s, its message can't be updated without stored state", group.Key, t.name)
+			_, resolvedInGroup := batchResult(batch.Alerts)
+			resolved = append(resolved, resolvedInGroup...)
+			continue
+		}
+
+		if err := t.sendGroup(group, newFiring); err != nil {
+			log.Errorf("can't send alert group %s to teams sink %s: %s", batch.Title, t.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		t.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+// sendGroup posts firing card if batch has alerts which were not firing in the group before, so resink doesn't
+// repeat it, and resolved card when the whole group is resolved, partially resolved group only updates the state
+func (t *TeamsSink) sendGroup(group *AlertGroup, newFiring bool) error {
+	resolved := group.Resolved()
+	if !newFiring && !resolved {
+		return nil
+	}
+
+	variables := group.Template()
+	cardTemplate := t.card
+	if resolved {
+		cardTemplate = t.resolvedCard
+	}
+	var card []byte
+	if cardTemplate == "" {
+		var err error
+		if card, err = json.Marshal(t.defaultCard(variables, resolved)); err != nil {
+			return err
+		}
+	} else {
+		rendered, err := sharedtools.TemplateString(cardTemplate, variables)
+		if err != nil {
+			return fmt.Errorf("can't render card: %w", err)
+		}
+		if !json.Valid([]byte(rendered)) {
+			return fmt.Errorf("card is not valid json: %s", rendered)
+		}
+		card = []byte(rendered)
+	}
+	return t.post(card)
+}
+
+// defaultCard builds Adaptive Card with title, description of alerts, facts from labels,
+// grafana images and buttons to dashboards and alert sources
+func (t *TeamsSink) defaultCard(variables AlertTemplate, resolved bool) map[string]any {
+	title, color, alerts := "🔴 "+variables.Title, "Attention", variables.FiringAlerts
+	if resolved {
+		title, color, alerts = "🟢 Resolved: "+variables.Title, "Good", variables.ResolvedAlerts
+	}
+	body := []any{
+		map[string]any{"type": "TextBlock", "text": title, "size": "Large", "weight": "Bolder", "color": color, "wrap": true},
+	}
+	for _, alert := range alerts {
+		if description := alert.Annotations["description"]; description != "" {
+			body = append(body, map[string]any{"type": "TextBlock", "text": description, "wrap": true})
+		}
+	}
+
+	facts := []any{}
+	keys := maps.Keys(variables.Labels)
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(key, "alertsforge_") {
+			continue
+		}
+		facts = append(facts, map[string]any{"title": key, "value": variables.Labels[key]})
+	}
+	if len(facts) > 0 {
+		body = append(body, map[string]any{"type": "FactSet", "facts": facts})
+	}
+
+	links, images := groupArtifacts(alerts, t.artifactsURL)
+	if !resolved {
+		for _, image := range images {
+			element := map[string]any{"type": "Image", "url": image.Src, "altText": image.Alt}
+			if image.Href != "" {
+				element["selectAction"] = map[string]any{"type": "Action.OpenUrl", "url": image.Href}
+			}
+			body = append(body, element)
+		}
+	}
+
+	actions := []any{}
+	for _, link := range links {
+		if link.Text != "source" && !strings.HasSuffix(link.Text, dashboardURLSuffix) {
+			continue
+		}
+		text := strings.TrimSuffix(strings.TrimPrefix(link.Text, "alertsforge_"), dashboardURLSuffix)
+		actions = append(actions, map[string]any{"type": "Action.OpenUrl", "title": strings.ReplaceAll(text, "_", " "), "url": link.Href})
+	}
+
+	card := map[string]any{
+		"type":    "AdaptiveCard",
+		"$schema": adaptiveCardSchema,
+		"version": adaptiveCardVersion,
+		"body":    body,
+		"msteams": map[string]any{"width": "Full"},
+	}
+	if len(actions) > 0 {
+		card["actions"] = actions
+	}
+	return card
+}
+
+func (t *TeamsSink) post(card []byte) error {
+	body, err := json.Marshal(teamsMessage{
+		Type:        "message",
+		Attachments: []teamsAttachment{{ContentType: adaptiveCardContentType, Content: card}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = sendWithRetry(t.client, t.retry, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, t.webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/json")
+		return req, nil
+	})
+	return err
+}
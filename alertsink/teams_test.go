@@ -0,0 +1,119 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeTeams(t *testing.T, cards *[]map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		message := teamsMessage{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		assert.Equal(t, "message", message.Type)
+		require.Len(t, message.Attachments, 1)
+		assert.Equal(t, adaptiveCardContentType, message.Attachments[0].ContentType)
+		card := map[string]any{}
+		require.NoError(t, json.Unmarshal(message.Attachments[0].Content, &card))
+		*cards = append(*cards, card)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTeamsSink_SendAlerts(t *testing.T) {
+	cards := []map[string]any{}
+	server := newFakeTeams(t, &cards)
+	sink, err := NewAlertSink(config.Sink{Name: "teams", Type: Teams, Config: map[string]string{
+		"webhookUrl":   server.URL,
+		"artifactsUrl": "https://alertsforge-static",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	labels := map[string]string{
+		"alertname":                   "HighCPU",
+		"namespace":                   "prod",
+		"alertsforge_grafana_pod_cpu": "2024-06-05/cpu.png",
+		"alertsforge_grafana_pod_cpu_dashboard_url": "https://grafana/d/cpu",
+	}
+	alerts := []sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Pending, StartsAt: time.Now(), Labels: labels, Annotations: map[string]string{"description": "cpu is high"}},
+		{Fingerprint: "2", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}},
+	}
+	accepted, _, errs := sink.SendAlerts(alerts)
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, accepted)
+	require.Len(t, cards, 1)
+
+	card := cards[0]
+	assert.Equal(t, "AdaptiveCard", card["type"])
+	body := card["body"].([]any)
+	assert.Equal(t, "🔴 HighCPU", body[0].(map[string]any)["text"])
+	assert.Equal(t, "cpu is high", body[1].(map[string]any)["text"])
+	assert.Contains(t, body, map[string]any{"type": "FactSet", "facts": []any{
+		map[string]any{"title": "alertname", "value": "HighCPU"},
+		map[string]any{"title": "namespace", "value": "prod"},
+	}})
+	assert.Contains(t, body, map[string]any{
+		"type":         "Image",
+		"url":          "https://alertsforge-static/2024-06-05/cpu.png",
+		"altText":      "alertsforge_grafana_pod_cpu",
+		"selectAction": map[string]any{"type": "Action.OpenUrl", "url": "https://grafana/d/cpu"},
+	})
+	assert.Equal(t, []any{map[string]any{"type": "Action.OpenUrl", "title": "grafana pod cpu", "url": "https://grafana/d/cpu"}}, card["actions"])
+
+	// resink of the same firing alerts doesn't post the card again, alert which wasn't firing in the group does
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{alerts[0], alerts[1]})
+	assert.Empty(t, errs)
+	assert.Len(t, cards, 1)
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{alerts[0], {Fingerprint: "3", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, errs)
+	require.Len(t, cards, 2)
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "3", Status: sharedtools.Resolved, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, errs)
+	cards = cards[:1]
+
+	// partial resolve is not posted, follow-up card is posted when the group is resolved
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "2", Status: sharedtools.Resolved, Labels: alerts[1].Labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"2"}, resolved)
+	assert.Len(t, cards, 1)
+	_, resolved, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, cards, 2)
+	assert.Equal(t, "🟢 Resolved: HighCPU", cards[1]["body"].([]any)[0].(map[string]any)["text"])
+	assert.Empty(t, sink.(*TeamsSink).groups.groups)
+}
+
+func TestTeamsSink_CardTemplate(t *testing.T) {
+	cards := []map[string]any{}
+	server := newFakeTeams(t, &cards)
+	sink, err := NewTeamsSink(config.Sink{Name: "teams", Type: Teams, Config: map[string]string{
+		"webhookUrl": server.URL,
+		"card":       `{"type": "AdaptiveCard", "version": "1.4", "body": [{"type": "TextBlock", "text": "{{ .Title }}: {{ len .FiringAlerts }}"}]}`,
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, errs)
+	require.Len(t, cards, 1)
+	assert.Equal(t, "DiskFull: 1", cards[0]["body"].([]any)[0].(map[string]any)["text"])
+
+	sink.card = `{"broken": {{ .Title }}}`
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "2", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "not valid json")
+
+	_, err = NewTeamsSink(config.Sink{Name: "teams", Type: Teams}, &slackRunbooks)
+	assert.Error(t, err)
+}
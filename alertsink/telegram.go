@@ -0,0 +1,234 @@
+package alertsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Telegram = "telegram"
+
+	defaultTelegramAPIURL    = "https://api.telegram.org"
+	defaultTelegramParseMode = "HTML"
+	// values are escaped with html function because the message is sent with HTML parse mode
+	defaultTelegramMessage = `{{- range .FiringAlerts }}
+🔴 {{ html .Labels.alertname }} {{ html .Annotations.description }}
+{{- end }}
+{{- range .ResolvedAlerts }}
+🟢 {{ html .Labels.alertname }} {{ html .Annotations.description }}
+{{- end }}`
+
+	telegramMaxText    = 4096
+	telegramMaxCaption = 1024
+
+	telegramMessageIDRef = "telegram_message_id"
+	telegramChatIDRef    = "telegram_chat_id"
+	telegramPhotoRef     = "telegram_photo"
+)
+
+// TelegramSink sends one bot api message per alert group and edits it on every change including resolve,
+// if the group has grafana image it's uploaded as photo with the message as caption
+type TelegramSink struct {
+	runbooks     *config.RunbooksConfig
+	name         string
+	token        string
+	apiURL       string
+	chatID       string
+	message      string
+	parseMode    string
+	artifactsURL string
+	client       *http.Client
+	retry        RetryPolicy
+	groups       *groupStore
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Result      struct {
+		MessageID int64 `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"result"`
+}
+
+// NewTelegramSink creates telegram sink from sink config: token and chatId are required, chatId is rendered
+// for every alert group; message is template over AlertTemplate of the group which defaults to
+// oncall_message.telegram_message prefixed with title, parseMode is HTML by default
+func NewTelegramSink(sink config.Sink, runbooks *config.RunbooksConfig) (*TelegramSink, error) {
+	t := &TelegramSink{
+		runbooks:     runbooks,
+		name:         sink.Name,
+		token:        sharedtools.MustTemplateString(sink.Config["token"], nil, ""),
+		apiURL:       strings.TrimSuffix(sharedtools.MustTemplateString(sink.Config["apiUrl"], nil, ""), "/"),
+		chatID:       sink.Config["chatId"],
+		message:      sink.Config["message"],
+		parseMode:    sink.Config["parseMode"],
+		artifactsURL: sink.Config["artifactsUrl"],
+		client:       &http.Client{Timeout: 30 * time.Second},
+		retry:        retryPolicyFromConfig(sink.Config),
+		groups:       newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if t.token == "" || t.chatID == "" {
+		return nil, fmt.Errorf("telegram sink %s requires token and chatId", sink.Name)
+	}
+	if t.apiURL == "" {
+		t.apiURL = defaultTelegramAPIURL
+	}
+	if t.parseMode == "" {
+		t.parseMode = defaultTelegramParseMode
+	}
+	if t.message == "" {
+		t.message = defaultTelegramMessage
+		if runbooks.OncallMessage.TelegramMessage != "" {
+			t.message = runbooks.OncallMessage.TelegramMessage
+		}
+		if t.parseMode == defaultTelegramParseMode {
+			t.message = "<b>{{ html .Title }}</b>\n" + t.message
+		}
+	}
+	return t, nil
+}
+
+func (t *TelegramSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(t.runbooks, alerts, "") {
+		group := t.groups.get(batch.Key, batch.Title)
+		group.merge(batch.Alerts)
+		if t.groups.unknownResolved(group) {
+			log.Warnf("resolved alert group %s is unknown to telegram sink %s, its message can't be updated without stored state", group.Key, t.name)
+			_, resolvedInGroup := batchResult(batch.Alerts)
+			resolved = append(resolved, resolvedInGroup...)
+			continue
+		}
+
+		if err := t.sendGroup(group); err != nil {
+			log.Errorf("can't send alert group %s to telegram sink %s: %s", batch.Title, t.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		t.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (t *TelegramSink) sendGroup(group *AlertGroup) error {
+	variables := group.Template()
+	text := sharedtools.MustTemplateString(t.message, variables, "error while parsing telegram message")
+
+	if messageID := group.Refs[telegramMessageIDRef]; messageID != "" {
+		params := map[string]string{
+			"chat_id":    group.Refs[telegramChatIDRef],
+			"message_id": messageID,
+			"parse_mode": t.parseMode,
+		}
+		method := "editMessageText"
+		if group.Refs[telegramPhotoRef] != "" {
+			method = "editMessageCaption"
+			params["caption"] = truncate(text, telegramMaxCaption)
+		} else {
+			params["text"] = truncate(text, telegramMaxText)
+		}
+		_, err := t.call(method, params, nil)
+		return err
+	}
+
+	params := map[string]string{
+		"chat_id":    strings.TrimSpace(sharedtools.MustTemplateString(t.chatID, variables, t.chatID)),
+		"parse_mode": t.parseMode,
+	}
+	var photo []byte
+	if _, images := groupArtifacts(variables.FiringAlerts, t.artifactsURL); len(images) > 0 {
+		data, err := fetchArtifact(t.client, images[0].Src)
+		if err != nil {
+			zap.S().Warnf("can't fetch image %s for telegram sink %s: %s", images[0].Src, t.name, err)
+		} else {
+			photo = data
+		}
+	}
+	method := "sendMessage"
+	if photo != nil {
+		method = "sendPhoto"
+		params["caption"] = truncate(text, telegramMaxCaption)
+	} else {
+		params["text"] = truncate(text, telegramMaxText)
+	}
+	response, err := t.call(method, params, photo)
+	if err != nil {
+		return err
+	}
+	group.Refs[telegramMessageIDRef] = strconv.FormatInt(response.Result.MessageID, 10)
+	group.Refs[telegramChatIDRef] = strconv.FormatInt(response.Result.Chat.ID, 10)
+	if photo != nil {
+		group.Refs[telegramPhotoRef] = "true"
+	}
+	return nil
+}
+
+// call sends bot api method as multipart form, photo is attached as file if it's set
+func (t *TelegramSink) call(method string, params map[string]string, photo []byte) (*telegramResponse, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for key, value := range params {
+		if err := form.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if photo != nil {
+		part, err := form.CreateFormFile("photo", "grafana.png")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(photo); err != nil {
+			return nil, err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	response, err := sendWithRetryAs(t.client, t.retry, t.apiURL+"/bot<token>/"+method, nil, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, t.apiURL+"/bot"+t.token+"/"+method, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", form.FormDataContentType())
+		return req, nil
+	})
+	result := &telegramResponse{}
+	if response != nil {
+		if jsonErr := json.Unmarshal(response.Body, result); jsonErr != nil && err == nil {
+			return nil, fmt.Errorf("can't parse telegram response: %w", jsonErr)
+		}
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		// edit with the same text is rejected, message already shows the state of the group
+		if strings.Contains(result.Description, "message is not modified") {
+			return result, nil
+		}
+		return nil, fmt.Errorf("telegram %s failed: %d %s", method, statusErr.Response.StatusCode, result.Description)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("telegram %s failed: %w", method, err)
+	}
+	if !result.OK {
+		return nil, fmt.Errorf("telegram %s failed: %s", method, result.Description)
+	}
+	return result, nil
+}
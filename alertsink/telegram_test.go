@@ -0,0 +1,141 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type telegramRequest struct {
+	Path   string
+	Fields map[string]string
+	Photo  string
+}
+
+func newFakeTelegram(t *testing.T, requests *[]telegramRequest) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/static/2024-06-05/cpu.png" {
+			w.Write([]byte("png"))
+			return
+		}
+		require.NoError(t, r.ParseMultipartForm(1<<20))
+		request := telegramRequest{Path: r.URL.Path, Fields: map[string]string{}}
+		for key, values := range r.MultipartForm.Value {
+			request.Fields[key] = values[0]
+		}
+		if file, _, err := r.FormFile("photo"); err == nil {
+			data, _ := io.ReadAll(file)
+			request.Photo = string(data)
+		}
+		*requests = append(*requests, request)
+		if request.Fields["text"] == "not modified" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`))
+			return
+		}
+		if request.Fields["chat_id"] == "unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": map[string]any{"message_id": 42, "chat": map[string]any{"id": -100123}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTelegramSink_SendAlerts(t *testing.T) {
+	requests := []telegramRequest{}
+	server := newFakeTelegram(t, &requests)
+	runbooks := config.RunbooksConfig{OncallMessage: config.OncallMessage{
+		Title:           "{{ .Labels.alertname }}",
+		TelegramMessage: "{{ len .FiringAlerts }} firing, {{ len .ResolvedAlerts }} resolved",
+	}}
+	sink, err := NewAlertSink(config.Sink{Name: "telegram", Type: Telegram, Config: map[string]string{
+		"token":        "123:abc",
+		"apiUrl":       server.URL,
+		"chatId":       "{{ .Labels.chat }}",
+		"artifactsUrl": server.URL + "/static",
+	}}, &runbooks)
+	require.NoError(t, err)
+
+	labels := map[string]string{"alertname": "HighCPU", "chat": "-100123"}
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Pending, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "/bot123:abc/sendMessage", requests[0].Path)
+	assert.Equal(t, map[string]string{"chat_id": "-100123", "parse_mode": "HTML", "text": "<b>HighCPU</b>\n1 firing, 0 resolved"}, requests[0].Fields)
+
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, resolved)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/bot123:abc/editMessageText", requests[1].Path)
+	assert.Equal(t, map[string]string{"chat_id": "-100123", "message_id": "42", "parse_mode": "HTML", "text": "<b>HighCPU</b>\n0 firing, 1 resolved"}, requests[1].Fields)
+	assert.Empty(t, sink.(*TelegramSink).groups.groups)
+
+	// grafana image is uploaded as photo and caption is edited later
+	requests = nil
+	labels = map[string]string{"alertname": "HighMemory", "chat": "-100123", "alertsforge_grafana_pod_memory": "2024-06-05/cpu.png"}
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "2", Status: sharedtools.Firing, Labels: labels}})
+	assert.Empty(t, errs)
+	_, _, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "2", Status: sharedtools.Resolved, Labels: labels}})
+	assert.Empty(t, errs)
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/bot123:abc/sendPhoto", requests[0].Path)
+	assert.Equal(t, "png", requests[0].Photo)
+	assert.Equal(t, "<b>HighMemory</b>\n1 firing, 0 resolved", requests[0].Fields["caption"])
+	assert.Equal(t, "/bot123:abc/editMessageCaption", requests[1].Path)
+	assert.Equal(t, "<b>HighMemory</b>\n0 firing, 1 resolved", requests[1].Fields["caption"])
+}
+
+func TestTelegramSink_Errors(t *testing.T) {
+	_, err := NewTelegramSink(config.Sink{Name: "telegram", Type: Telegram, Config: map[string]string{"token": "123:abc"}}, &slackRunbooks)
+	assert.Error(t, err)
+
+	requests := []telegramRequest{}
+	server := newFakeTelegram(t, &requests)
+	sink, err := NewTelegramSink(config.Sink{Name: "telegram", Type: Telegram, Config: map[string]string{
+		"token":  "123:abc",
+		"apiUrl": server.URL,
+		"chatId": "unknown",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "chat not found")
+
+	// unchanged message is not an error
+	sink.message = "not modified"
+	sink.groups.put(&AlertGroup{Key: "HighCPU", Title: "HighCPU", Alerts: map[string]sharedtools.Alert{"1": {Fingerprint: "1", Status: sharedtools.Firing}}, Refs: map[string]string{telegramMessageIDRef: "42", telegramChatIDRef: "1"}})
+	accepted, _, errs = sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "HighCPU"}}})
+	assert.Empty(t, errs)
+	assert.Equal(t, []string{"1"}, accepted)
+}
+
+func TestTelegramSink_DefaultMessageEscaping(t *testing.T) {
+	requests := []telegramRequest{}
+	server := newFakeTelegram(t, &requests)
+	runbooks := config.RunbooksConfig{OncallMessage: config.OncallMessage{Title: "{{ .Labels.alertname }} <prod>"}}
+	sink, err := NewAlertSink(config.Sink{Name: "telegram", Type: Telegram, Config: map[string]string{"token": "123:abc", "apiUrl": server.URL, "chatId": "-100123"}}, &runbooks)
+	require.NoError(t, err)
+
+	_, _, errs := sink.SendAlerts([]sharedtools.Alert{{
+		Fingerprint: "1",
+		Status:      sharedtools.Firing,
+		Labels:      map[string]string{"alertname": "HighCPU"},
+		Annotations: map[string]string{"description": "cpu > 90% & rising"},
+	}})
+	assert.Empty(t, errs)
+	require.Len(t, requests, 1)
+	assert.Equal(t, "<b>HighCPU &lt;prod&gt;</b>\n🔴 HighCPU cpu &gt; 90% &amp; rising", requests[0].Fields["text"])
+}
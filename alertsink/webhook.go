@@ -0,0 +1,173 @@
+package alertsink
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	Webhook = "webhook"
+
+	defaultWebhookBody        = "{{ toJson . }}"
+	defaultWebhookContentType = "application/json"
+
+	webhookHeaderPrefix = "header."
+)
+
+// WebhookSink sends http request per alert group, url, method, headers and body are templates over AlertTemplate
+// of the group, resolvedBody is sent instead of body when all alerts of the group are resolved
+type WebhookSink struct {
+	runbooks     *config.RunbooksConfig
+	name         string
+	url          string
+	method       string
+	headers      map[string]string
+	body         string
+	resolvedBody string
+	groupBy      string
+	success      func(status int) bool
+	client       *http.Client
+	retry        RetryPolicy
+	groups       *groupStore
+}
+
+// NewWebhookSink creates webhook sink from sink config: url is required, method defaults to POST,
+// body defaults to json of AlertTemplate, header.<Name> keys are headers, successStatus is comma separated list
+// of status codes and ranges like 200-299,409, groupBy is template of group key which defaults to title
+func NewWebhookSink(sink config.Sink, runbooks *config.RunbooksConfig) (*WebhookSink, error) {
+	w := &WebhookSink{
+		runbooks:     runbooks,
+		name:         sink.Name,
+		url:          sink.Config["url"],
+		method:       sink.Config["method"],
+		headers:      map[string]string{"Content-Type": defaultWebhookContentType},
+		body:         sink.Config["body"],
+		resolvedBody: sink.Config["resolvedBody"],
+		groupBy:      sink.Config["groupBy"],
+		client:       &http.Client{Timeout: 10 * time.Second},
+		retry:        retryPolicyFromConfig(sink.Config),
+		groups:       newGroupStore(sinkStatePath(sink, "statePath", "groups")),
+	}
+	if w.url == "" {
+		return nil, fmt.Errorf("webhook sink %s requires url", sink.Name)
+	}
+	if w.method == "" {
+		w.method = http.MethodPost
+	}
+	if w.body == "" {
+		w.body = defaultWebhookBody
+	}
+	if w.resolvedBody == "" {
+		w.resolvedBody = w.body
+	}
+	for key, value := range sink.Config {
+		if name, found := strings.CutPrefix(key, webhookHeaderPrefix); found && name != "" {
+			w.headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	success, err := parseStatusPredicate(sink.Config["successStatus"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid successStatus of webhook sink %s: %w", sink.Name, err)
+	}
+	w.success = success
+	return w, nil
+}
+
+func (w *WebhookSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	log := zap.S()
+	for _, batch := range groupAlertsByKey(w.runbooks, alerts, w.groupBy) {
+		group := w.groups.get(batch.Key, batch.Title)
+		group.merge(batch.Alerts)
+		if w.groups.unknownResolved(group) {
+			log.Infof("resolved alert group %s is unknown to webhook sink %s, closing it with resolved body", group.Key, w.name)
+		}
+
+		if err := w.sendGroup(group); err != nil {
+			log.Errorf("can't send alert group %s to webhook sink %s: %s", batch.Key, w.name, err)
+			errors = append(errors, err)
+			continue
+		}
+		w.groups.put(group)
+		acceptedInGroup, resolvedInGroup := batchResult(batch.Alerts)
+		accepted = append(accepted, acceptedInGroup...)
+		resolved = append(resolved, resolvedInGroup...)
+	}
+	return
+}
+
+func (w *WebhookSink) sendGroup(group *AlertGroup) error {
+	variables := group.Template()
+	requestURL, err := sharedtools.TemplateString(w.url, variables)
+	if err != nil {
+		return fmt.Errorf("can't render url: %w", err)
+	}
+	method, err := sharedtools.TemplateString(w.method, variables)
+	if err != nil {
+		return fmt.Errorf("can't render method: %w", err)
+	}
+	bodyTemplate := w.body
+	if group.Resolved() {
+		bodyTemplate = w.resolvedBody
+	}
+	body, err := sharedtools.TemplateString(bodyTemplate, variables)
+	if err != nil {
+		return fmt.Errorf("can't render body: %w", err)
+	}
+	headers := map[string]string{}
+	for name, value := range w.headers {
+		if headers[name], err = sharedtools.TemplateString(value, variables); err != nil {
+			return fmt.Errorf("can't render header %s: %w", name, err)
+		}
+	}
+
+	_, err = sendWithRetry(w.client, w.retry, w.success, func() (*http.Request, error) {
+		req, err := http.NewRequest(strings.ToUpper(strings.TrimSpace(method)), strings.TrimSpace(requestURL), strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		return req, nil
+	})
+	return err
+}
+
+// parseStatusPredicate parses comma separated list of status codes and ranges, empty list means 2xx
+func parseStatusPredicate(statuses string) (func(status int) bool, error) {
+	type statusRange struct{ from, to int }
+	ranges := []statusRange{}
+	for _, item := range splitList(statuses) {
+		from, to, isRange := strings.Cut(item, "-")
+		if !isRange {
+			to = from
+		}
+		fromStatus, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid status %q", item)
+		}
+		toStatus, err := strconv.Atoi(strings.TrimSpace(to))
+		if err != nil || toStatus < fromStatus {
+			return nil, fmt.Errorf("invalid status range %q", item)
+		}
+		ranges = append(ranges, statusRange{fromStatus, toStatus})
+	}
+	if len(ranges) == 0 {
+		return isSuccessStatus, nil
+	}
+	return func(status int) bool {
+		for _, r := range ranges {
+			if status >= r.from && status <= r.to {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
@@ -0,0 +1,114 @@
+package alertsink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type webhookRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+func TestWebhookSink_SendAlerts(t *testing.T) {
+	noSleep(t)
+	requests := []webhookRequest{}
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests = append(requests, webhookRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header, Body: string(body)})
+		w.WriteHeader(status)
+		status = http.StatusConflict
+	}))
+	defer server.Close()
+
+	t.Setenv("AF_STATUSPAGE_TOKEN", "secret")
+	sink, err := NewAlertSink(config.Sink{Name: "statuspage", Type: Webhook, Config: map[string]string{
+		"url":                  server.URL + "/incidents/{{ .Labels.namespace }}",
+		"method":               "put",
+		"header.Authorization": `Bearer {{ env "AF_STATUSPAGE_TOKEN" }}`,
+		"header.X-Title":       "{{ .Title }}",
+		"body":                 `{"status":"firing","count":{{ len .FiringAlerts }}}`,
+		"resolvedBody":         `{"status":"resolved","count":{{ len .ResolvedAlerts }}}`,
+		"successStatus":        "200-299, 409",
+	}}, &slackRunbooks)
+	require.NoError(t, err)
+
+	labels := map[string]string{"alertname": "HighCPU", "namespace": "prod"}
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Pending, Labels: labels},
+		{Fingerprint: "2", Status: sharedtools.Firing, Labels: labels},
+	})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, accepted)
+	// 503 is retried, 409 is accepted by successStatus
+	require.Len(t, requests, 2)
+	assert.Equal(t, http.MethodPut, requests[1].Method)
+	assert.Equal(t, "/incidents/prod", requests[1].Path)
+	assert.Equal(t, "Bearer secret", requests[1].Header.Get("Authorization"))
+	assert.Equal(t, "HighCPU", requests[1].Header.Get("X-Title"))
+	assert.Equal(t, "application/json", requests[1].Header.Get("Content-Type"))
+	assert.Equal(t, `{"status":"firing","count":2}`, requests[1].Body)
+
+	requests = nil
+	_, resolved, errs := sink.SendAlerts([]sharedtools.Alert{
+		{Fingerprint: "1", Status: sharedtools.Resolved, Labels: labels},
+		{Fingerprint: "2", Status: sharedtools.Resolved, Labels: labels},
+	})
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{"1", "2"}, resolved)
+	require.Len(t, requests, 1)
+	assert.Equal(t, `{"status":"resolved","count":2}`, requests[0].Body)
+}
+
+func TestWebhookSink_DefaultBody(t *testing.T) {
+	var body AlertTemplate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(config.Sink{Name: "hook", Type: Webhook, Config: map[string]string{"url": server.URL}}, &slackRunbooks)
+	require.NoError(t, err)
+	accepted, _, errs := sink.SendAlerts([]sharedtools.Alert{{Fingerprint: "1", Status: sharedtools.Firing, Labels: map[string]string{"alertname": "DiskFull"}}})
+	assert.Empty(t, accepted)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "400")
+	assert.Equal(t, "DiskFull", body.Title)
+	require.Len(t, body.FiringAlerts, 1)
+	assert.Equal(t, "1", body.FiringAlerts[0].Fingerprint)
+}
+
+func TestParseStatusPredicate(t *testing.T) {
+	success, err := parseStatusPredicate("")
+	require.NoError(t, err)
+	assert.True(t, success(204))
+	assert.False(t, success(409))
+
+	success, err = parseStatusPredicate("200, 202-204,409")
+	require.NoError(t, err)
+	assert.True(t, success(200))
+	assert.True(t, success(203))
+	assert.True(t, success(409))
+	assert.False(t, success(201))
+
+	for _, invalid := range []string{"2xx", "300-200", "200-"} {
+		_, err = parseStatusPredicate(invalid)
+		assert.Error(t, err, invalid)
+	}
+	_, err = NewWebhookSink(config.Sink{Name: "hook", Type: Webhook}, &slackRunbooks)
+	assert.Error(t, err)
+}
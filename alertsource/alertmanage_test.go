@@ -10,9 +10,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mobalyticshq/alertsforge/alertsink"
 	"github.com/mobalyticshq/alertsforge/config"
 	"github.com/mobalyticshq/alertsforge/sharedtools"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockSink struct {
@@ -24,6 +26,14 @@ func (m *mockSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, re
 	return []string{"alert1", "alert2", "alert5", "alert6"}, []string{"alert3"}, []error{http.ErrContentLength}
 }
 
+func newMockRouter(t *testing.T, sink alertsink.SinkInterface) alertsink.RouterInterface {
+	router, err := alertsink.NewRouterWithSinks(config.Route{Sinks: []string{"mock"}}, map[string]alertsink.SinkInterface{"mock": sink})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
 type mockEnricher struct {
 }
 
@@ -78,7 +88,7 @@ func TestAlertManager_ProcessAlertsBuffer(t *testing.T) {
 			},
 		},
 		AlertBufferMutex: sync.RWMutex{},
-		AlertSink:        &mockSink{},
+		AlertRouter:      newMockRouter(t, &mockSink{}),
 		AlertEnricher:    &mockEnricher{},
 		runbooks:         &config.RunbooksConfig{},
 	}
@@ -88,7 +98,8 @@ func TestAlertManager_ProcessAlertsBuffer(t *testing.T) {
 
 	assert.ElementsMatch(t, []error{http.ErrContentLength}, errs)
 
-	alertsSentToSink := am.AlertSink.(*mockSink).ReceivedAlerts
+	sink, _ := am.AlertRouter.Sink("mock")
+	alertsSentToSink := sink.(*mockSink).ReceivedAlerts
 	sort.Sort(alertsSentToSink)
 	assert.Equal(t, 5, len(alertsSentToSink))
 	assert.Equal(t, "alert1", alertsSentToSink[0].Fingerprint)
@@ -297,3 +308,80 @@ func TestAlertManager_receiveAlerts(t *testing.T) {
 		}
 	})
 }
+
+type recordingSink struct {
+	Received []sharedtools.Alert
+	Fail     bool
+}
+
+func (r *recordingSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	r.Received = alerts
+	if r.Fail {
+		return nil, nil, []error{fmt.Errorf("sink is down")}
+	}
+	for _, alert := range alerts {
+		if alert.Status == sharedtools.Resolved {
+			resolved = append(resolved, alert.Fingerprint)
+		} else {
+			accepted = append(accepted, alert.Fingerprint)
+		}
+	}
+	return
+}
+
+func TestAlertManager_ProcessAlertsBufferRouting(t *testing.T) {
+	os.Setenv("AF_RESINK_TIME", "")
+	primary, secondary, info := &recordingSink{}, &recordingSink{Fail: true}, &recordingSink{}
+	router, err := alertsink.NewRouterWithSinks(config.Route{
+		Sinks: []string{"primary", "secondary"},
+		Routes: []config.Route{
+			{LabelsSelector: map[string]string{"severity": "info"}, Sinks: []string{"info"}},
+		},
+	}, map[string]alertsink.SinkInterface{"primary": primary, "secondary": secondary, "info": info})
+	assert.NoError(t, err)
+
+	am := &AlertManager{
+		AlertsBuffer: map[string]*sharedtools.Alert{
+			"critical": {Fingerprint: "critical", Labels: map[string]string{"severity": "critical"}, EndsAt: time.Now().Add(time.Hour), Status: sharedtools.Pending},
+			"info":     {Fingerprint: "info", Labels: map[string]string{"severity": "info"}, EndsAt: time.Now().Add(time.Hour), Status: sharedtools.Pending},
+		},
+		AlertBufferMutex: sync.RWMutex{},
+		AlertRouter:      router,
+		AlertEnricher:    &mockEnricher{},
+		runbooks:         &config.RunbooksConfig{},
+	}
+
+	errs := am.ProcessAlertsBuffer()
+	assert.Len(t, errs, 1)
+	assert.Len(t, primary.Received, 1)
+	assert.Len(t, secondary.Received, 1)
+	assert.Len(t, info.Received, 1)
+	assert.Equal(t, sharedtools.Firing, am.AlertsBuffer["critical"].Status)
+	assert.Equal(t, []string{"primary"}, am.AlertsBuffer["critical"].AcceptedBy)
+	assert.Equal(t, []string{"info"}, am.AlertsBuffer["info"].AcceptedBy)
+
+	// only sink which failed gets alert again
+	primary.Received, secondary.Received, info.Received = nil, nil, nil
+	secondary.Fail = false
+	errs = am.ProcessAlertsBuffer()
+	assert.Empty(t, errs)
+	assert.Empty(t, primary.Received)
+	assert.Empty(t, info.Received)
+	assert.Len(t, secondary.Received, 1)
+	assert.ElementsMatch(t, []string{"primary", "secondary"}, am.AlertsBuffer["critical"].AcceptedBy)
+
+	// resolved alert stays in buffer until every sink which accepted it has resolved it
+	secondary.Fail = true
+	am.AlertsBuffer["critical"].EndsAt = time.Now().Add(-time.Minute)
+	am.ProcessAlertsBuffer()
+	assert.Equal(t, sharedtools.Resolved, primary.Received[0].Status)
+	require.Contains(t, am.AlertsBuffer, "critical")
+	assert.Equal(t, []string{"secondary"}, am.AlertsBuffer["critical"].AcceptedBy)
+
+	primary.Received = nil
+	secondary.Fail = false
+	am.ProcessAlertsBuffer()
+	assert.Empty(t, primary.Received)
+	assert.NotContains(t, am.AlertsBuffer, "critical")
+	assert.Contains(t, am.AlertsBuffer, "info")
+}
@@ -3,59 +3,118 @@ package alertsource
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"sync"
 	"time"
 
 	"net/http"
 
+	"github.com/dlclark/regexp2"
 	"github.com/mobalyticshq/alertsforge/alertsink"
 	"github.com/mobalyticshq/alertsforge/config"
 	"github.com/mobalyticshq/alertsforge/enrichers"
 	"github.com/mobalyticshq/alertsforge/sharedtools"
 	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
 )
 
 type AlertManager struct {
 	AlertsBuffer     map[string]*sharedtools.Alert
 	AlertBufferMutex sync.RWMutex
-	AlertSink        alertsink.SinkInterface
+	AlertRouter      alertsink.RouterInterface
 	AlertEnricher    enrichers.EnrichmentInterface
+	BufferStore      BufferStoreInterface
 	runbooks         *config.RunbooksConfig
+	startedAt        time.Time
+	cluster          *Cluster
+	// processingMutex serializes buffer processing with dead letters replay, so replay doesn't send
+	// outdated payload concurrently with newer one
+	processingMutex sync.Mutex
+
+	// fingerprintRegexps are compiled excludeRegex of fingerprint policies by their source
+	fingerprintRegexps map[string]*regexp2.Regexp
 }
 type AlertManagerInterface interface {
 	AlertsProcessor()
 	ProcessAlertsBuffer() []error
-	receiveAlerts(alerts []sharedtools.Alert)
+	receiveAlerts(alerts []sharedtools.Alert) []string
+	bufferAlerts(alerts []sharedtools.Alert) []string
+	bufferSnapshot() []BufferRecord
+	applySnapshot(records []BufferRecord, keepReceivedAfter time.Time)
+	setCluster(cluster *Cluster)
+	pushHandler(source string, parse alertsParser) http.HandlerFunc
+	resolveAlerts(fingerprints []string)
+	expireAlerts(fingerprints []string)
 	ProcessAlertsBufferWebhook(w http.ResponseWriter, r *http.Request)
 	ShowAlertsBufferWebhook(w http.ResponseWriter, r *http.Request)
 	AlertWebhook(w http.ResponseWriter, r *http.Request)
+	AlertmanagerWebhook(w http.ResponseWriter, r *http.Request)
+	GrafanaWebhook(w http.ResponseWriter, r *http.Request)
+	JSONWebhook(source config.JSONSource) http.HandlerFunc
+	GetAlertsWebhook(w http.ResponseWriter, r *http.Request)
+	GetAlertGroupsWebhook(w http.ResponseWriter, r *http.Request)
+	GetStatusWebhook(w http.ResponseWriter, r *http.Request)
+	DeadLettersWebhook(w http.ResponseWriter, r *http.Request)
+	ReplayDeadLettersWebhook(w http.ResponseWriter, r *http.Request)
+	OncallWebhook(w http.ResponseWriter, r *http.Request)
 }
 
-func NewAlertManager(runbooks *config.RunbooksConfig) AlertManagerInterface {
+func NewAlertManager(runbooks *config.RunbooksConfig) (AlertManagerInterface, error) {
+	router, err := alertsink.NewRouter(runbooks)
+	if err != nil {
+		return nil, err
+	}
+	fingerprintRegexps, err := compileFingerprintRegexps(runbooks.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	bufferStore := NewBufferStore(os.Getenv("AF_BUFFER_PATH"))
+	alertsBuffer, err := bufferStore.Load()
+	if err != nil {
+		zap.S().Errorf("can't restore alerts buffer, starting with empty one: %s", err)
+		alertsBuffer = map[string]*sharedtools.Alert{}
+	}
 
 	return &AlertManager{
-		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertsBuffer:     alertsBuffer,
 		AlertBufferMutex: sync.RWMutex{},
 		runbooks:         runbooks,
-		AlertSink:        alertsink.NewAlertSink(alertsink.Oncall, runbooks),
+		AlertRouter:      router,
 		AlertEnricher:    enrichers.NewEnrichment(runbooks),
-	}
+		BufferStore:      bufferStore,
+		startedAt:        time.Now(),
+
+		fingerprintRegexps: fingerprintRegexps,
+	}, nil
 }
 
 func (a *AlertManager) AlertsProcessor() {
 	for range time.Tick(time.Second * 10) {
+		if a.cluster != nil && !a.cluster.IsLeader() {
+			zap.S().Debugf("skipping buffer processing, leader is %s", a.cluster.Leader())
+			continue
+		}
 		errs := a.ProcessAlertsBuffer()
 		if len(errs) > 0 {
 			zap.S().Warnf("buffer processsing was not coompletely successful")
 		}
+		if a.cluster != nil {
+			a.cluster.replicate()
+		}
 	}
 }
 
+func (a *AlertManager) setCluster(cluster *Cluster) {
+	a.cluster = cluster
+}
+
 func (a *AlertManager) ProcessAlertsBufferWebhook(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	log := zap.S()
+	if a.cluster != nil && !a.cluster.IsLeader() {
+		asJson(w, http.StatusConflict, "buffer is processed by leader "+a.cluster.Leader())
+		return
+	}
 	body := ""
 	if err := a.ProcessAlertsBuffer(); err != nil {
 		body = fmt.Sprintf("%s", err)
@@ -66,16 +125,41 @@ func (a *AlertManager) ProcessAlertsBufferWebhook(w http.ResponseWriter, r *http
 	asJson(w, http.StatusOK, body)
 }
 
+// bufferView is buffered alert with alertsforge state which is not sent to sinks
+type bufferView struct {
+	*sharedtools.Alert
+	FingerprintPolicy string   `json:"fingerprintPolicy,omitempty"`
+	FingerprintLabels []string `json:"fingerprintLabels,omitempty"`
+	SinkState         string   `json:"sinkState,omitempty"`
+	SilencedBy        string   `json:"silencedBy,omitempty"`
+}
+
+func newBufferView(alert *sharedtools.Alert) bufferView {
+	return bufferView{
+		Alert:             alert,
+		FingerprintPolicy: alert.FingerprintPolicy,
+		FingerprintLabels: alert.FingerprintLabels,
+		SinkState:         alert.SinkState,
+		SilencedBy:        alert.SilencedBy,
+	}
+}
+
 func (a *AlertManager) ShowAlertsBufferWebhook(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	a.AlertBufferMutex.Lock()
-	bytes, _ := json.MarshalIndent(a.AlertsBuffer, "", "\t")
+	view := map[string]bufferView{}
+	for fingerprint, alert := range a.AlertsBuffer {
+		view[fingerprint] = newBufferView(alert)
+	}
+	bytes, _ := json.MarshalIndent(view, "", "\t")
 	a.AlertBufferMutex.Unlock()
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprint(w, string(bytes))
 }
 
 func (a *AlertManager) ProcessAlertsBuffer() []error {
+	a.processingMutex.Lock()
+	defer a.processingMutex.Unlock()
 	log := zap.S()
 	log.Debugf("starting processing of alertsbuffer")
 	AlertsBufferCopy := map[string]sharedtools.Alert{}
@@ -88,8 +172,8 @@ func (a *AlertManager) ProcessAlertsBuffer() []error {
 	var wg sync.WaitGroup
 	sentAlerts := 0
 	errChan := make(chan []error, len(AlertsBufferCopy))
-	alertsToOncall := []sharedtools.Alert{}
-	alertsToOncallMutex := &sync.RWMutex{}
+	alertsToSinks := []sharedtools.Alert{}
+	alertsToSinksMutex := &sync.RWMutex{}
 	log.Debugf("found %d alerts in buffer", len(AlertsBufferCopy))
 
 	for _, alert := range AlertsBufferCopy {
@@ -97,9 +181,9 @@ func (a *AlertManager) ProcessAlertsBuffer() []error {
 		if alertCopy.EndsAt.Before(time.Now()) {
 			log.Infof("alert end date before current time, consider it resolved: %v", alertCopy)
 			if alertCopy.Status == sharedtools.Pending {
-				log.Warnf("alert was removed before sending it to oncall! : %v", alertCopy)
+				log.Warnf("alert was removed before sending it to sinks! : %v", alertCopy)
 				a.AlertBufferMutex.Lock()
-				delete(a.AlertsBuffer, alertCopy.Fingerprint)
+				a.deleteAlert(alertCopy.Fingerprint)
 				a.AlertBufferMutex.Unlock()
 			} else {
 				sentAlerts++
@@ -108,9 +192,9 @@ func (a *AlertManager) ProcessAlertsBuffer() []error {
 					defer wg.Done()
 					log.Infof("resolving alert: %v", alertCopy)
 					alertCopy.Status = sharedtools.Resolved
-					alertsToOncallMutex.Lock()
-					alertsToOncall = append(alertsToOncall, alertCopy)
-					alertsToOncallMutex.Unlock()
+					alertsToSinksMutex.Lock()
+					alertsToSinks = append(alertsToSinks, alertCopy)
+					alertsToSinksMutex.Unlock()
 				}()
 			}
 
@@ -122,25 +206,25 @@ func (a *AlertManager) ProcessAlertsBuffer() []error {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				log.Infof("found pending alert, enriching it and sending to oncall: %v", alertCopy)
+				log.Infof("found pending alert, enriching it and sending to sinks: %v", alertCopy)
 				errs := a.AlertEnricher.StartEnrichmentFlow(alertCopy)
 				errChan <- errs
 				a.AlertBufferMutex.Lock()
 				a.AlertsBuffer[alertCopy.Fingerprint] = &alertCopy
+				a.persistAlert(&alertCopy)
 				a.AlertBufferMutex.Unlock()
-				alertsToOncallMutex.Lock()
-				alertsToOncall = append(alertsToOncall, alertCopy)
-				alertsToOncallMutex.Unlock()
+				alertsToSinksMutex.Lock()
+				alertsToSinks = append(alertsToSinks, alertCopy)
+				alertsToSinksMutex.Unlock()
 			}()
 
 		}
 
-		if resink, err := time.ParseDuration(os.Getenv("AF_RESINK_TIME")); err == nil {
-			if alertCopy.Status == sharedtools.Firing && time.Since(alertCopy.LastSinkAt) > resink {
-				alertsToOncallMutex.Lock()
-				alertsToOncall = append(alertsToOncall, alertCopy)
-				alertsToOncallMutex.Unlock()
-			}
+		if alertCopy.Status == sharedtools.Firing && ((resinkDue(alertCopy) && !locallySilenced(alertCopy)) || len(a.missingSinks(alertCopy)) > 0) {
+			sentAlerts++
+			alertsToSinksMutex.Lock()
+			alertsToSinks = append(alertsToSinks, alertCopy)
+			alertsToSinksMutex.Unlock()
 		}
 
 	}
@@ -156,66 +240,176 @@ func (a *AlertManager) ProcessAlertsBuffer() []error {
 
 	errors := []error{}
 	if sentAlerts > 0 {
-		log.Infof("alerts to oncall: %v", alertsToOncall)
-		var accepted, resolved []string
-		accepted, resolved, errors = a.AlertSink.SendAlerts(alertsToOncall)
+		log.Infof("alerts to sinks: %v", alertsToSinks)
+		errors = a.sendToSinks(alertsToSinks)
+		log.Infof("%d alerts have been sent to sinks", sentAlerts)
+	}
+	a.syncAlertStates()
+	log.Debugf("finished processing of alertsbuffer")
+	return errors
+}
 
-		log.Infof("accepted fingerprints: %v", accepted)
-		log.Infof("resolved fingerprints: %v", resolved)
+// sinkTargets returns sinks alert must be sent to: resolved alerts go to sinks which accepted them,
+// firing alerts go to routed sinks which haven't accepted them yet or to all routed sinks on resink,
+// locally silenced alerts are not resinked
+func (a *AlertManager) sinkTargets(alert sharedtools.Alert) []string {
+	switch alert.Status {
+	case sharedtools.Resolved:
+		if len(alert.AcceptedBy) > 0 {
+			return alert.AcceptedBy
+		}
+		return a.AlertRouter.Route(alert.Labels)
+	case sharedtools.Firing:
+		if resinkDue(alert) && !locallySilenced(alert) {
+			return a.AlertRouter.Route(alert.Labels)
+		}
+		return a.missingSinks(alert)
+	}
+	return a.AlertRouter.Route(alert.Labels)
+}
 
-		for _, err := range errors {
-			log.Errorf("error while sending alert to oncall: %s", err)
+// missingSinks returns routed sinks which haven't accepted firing alert yet
+func (a *AlertManager) missingSinks(alert sharedtools.Alert) []string {
+	missing := []string{}
+	for _, sink := range a.AlertRouter.Route(alert.Labels) {
+		if !slices.Contains(alert.AcceptedBy, sink) {
+			missing = append(missing, sink)
 		}
+	}
+	return missing
+}
+
+func resinkDue(alert sharedtools.Alert) bool {
+	resink, err := time.ParseDuration(os.Getenv("AF_RESINK_TIME"))
+	return err == nil && time.Since(alert.LastSinkAt) > resink
+}
 
-		a.AlertBufferMutex.Lock()
-		for _, fingerprint := range accepted {
+// sendToSinks sends alerts to their sinks in parallel and updates buffer with per sink results,
+// resolved alert is deleted from buffer when all sinks which accepted it have resolved it
+func (a *AlertManager) sendToSinks(alerts []sharedtools.Alert) []error {
+	log := zap.S()
+	alertsBySink := map[string][]sharedtools.Alert{}
+	resolveTargets := map[string][]string{}
+	for _, alert := range alerts {
+		targets := a.sinkTargets(alert)
+		if len(targets) == 0 {
+			log.Warnf("no sinks are routed for alert %s with labels %v", alert.Fingerprint, alert.Labels)
+		}
+		if alert.Status == sharedtools.Resolved {
+			resolveTargets[alert.Fingerprint] = targets
+		}
+		for _, target := range targets {
+			alertsBySink[target] = append(alertsBySink[target], alert)
+		}
+	}
 
+	type sinkResult struct {
+		sink               string
+		accepted, resolved []string
+		errors             []error
+	}
+	results := make(chan sinkResult, len(alertsBySink))
+	var wg sync.WaitGroup
+	for name, sinkAlerts := range alertsBySink {
+		sink, ok := a.AlertRouter.Sink(name)
+		if !ok {
+			results <- sinkResult{sink: name, errors: []error{fmt.Errorf("unknown sink %s", name)}}
+			continue
+		}
+		name, sinkAlerts := name, sinkAlerts
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			accepted, resolved, errors := sink.SendAlerts(sinkAlerts)
+			results <- sinkResult{sink: name, accepted: accepted, resolved: resolved, errors: errors}
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	errors := []error{}
+	a.AlertBufferMutex.Lock()
+	defer a.AlertBufferMutex.Unlock()
+	for result := range results {
+		log.Infof("sink %s accepted fingerprints: %v", result.sink, result.accepted)
+		log.Infof("sink %s resolved fingerprints: %v", result.sink, result.resolved)
+		for _, err := range result.errors {
+			log.Errorf("error while sending alert to sink %s: %s", result.sink, err)
+		}
+		errors = append(errors, result.errors...)
+
+		for _, fingerprint := range result.accepted {
 			if alert, ok := a.AlertsBuffer[fingerprint]; ok {
 				if alert.Status == sharedtools.Firing {
-					log.Infof("fingerprint %s have been resinked", alert.Fingerprint)
+					log.Infof("fingerprint %s have been resinked to %s", alert.Fingerprint, result.sink)
 				} else {
 					log.Infof("changing fingerprint %s with status %s to status firing", alert.Fingerprint, alert.Status)
 					alert.Status = sharedtools.Firing
 				}
+				if !slices.Contains(alert.AcceptedBy, result.sink) {
+					alert.AcceptedBy = append(alert.AcceptedBy, result.sink)
+				}
 				alert.LastSinkAt = time.Now()
+				a.persistAlert(alert)
 			}
 		}
-		for _, fingerprint := range resolved {
+		for _, fingerprint := range result.resolved {
+			targets := []string{}
+			for _, target := range resolveTargets[fingerprint] {
+				if target != result.sink {
+					targets = append(targets, target)
+				}
+			}
+			resolveTargets[fingerprint] = targets
+		}
+	}
+
+	for fingerprint, targets := range resolveTargets {
+		alert, ok := a.AlertsBuffer[fingerprint]
+		if !ok {
+			continue
+		}
+		if len(targets) == 0 {
 			log.Infof("deleting alert with fingerprint %s from buffer", fingerprint)
-			delete(a.AlertsBuffer, fingerprint)
+			a.deleteAlert(fingerprint)
+		} else {
+			log.Infof("alert with fingerprint %s is not resolved yet in sinks %v", fingerprint, targets)
+			alert.AcceptedBy = targets
+			a.persistAlert(alert)
 		}
-		a.AlertBufferMutex.Unlock()
-		log.Infof("%d alerts have been sent to Oncall successfully", sentAlerts)
+	}
 
+	// alerts without any sink are marked as sent so they are not enriched again
+	for _, alert := range alerts {
+		if buffered, ok := a.AlertsBuffer[alert.Fingerprint]; ok && buffered.Status == sharedtools.Pending && len(a.AlertRouter.Route(alert.Labels)) == 0 {
+			buffered.Status = sharedtools.Firing
+			buffered.LastSinkAt = time.Now()
+			a.persistAlert(buffered)
+		}
 	}
-	log.Debugf("finished processing of alertsbuffer")
 	return errors
 }
 
 func (a *AlertManager) AlertWebhook(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	log := zap.S()
-	alerts := []sharedtools.Alert{}
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Errorf("Can't get body", err)
+	if r.Method == http.MethodGet {
+		a.GetAlertsWebhook(w, r)
 		return
 	}
+	a.pushHandler(AlertmanagerSourceType, parseAlerts)(w, r)
+}
 
-	if err := json.Unmarshal(body, &alerts); err != nil {
-		asJson(w, http.StatusBadRequest, err.Error())
-		log.Errorf("Can't unmarshal request from alertmanager, body: \n%s", body)
-		return
+// receiveAlerts puts alerts to buffer and returns fingerprints of alerts which were not silenced,
+// in HA mode alerts are also forwarded to leader
+func (a *AlertManager) receiveAlerts(alerts []sharedtools.Alert) []string {
+	if a.cluster != nil {
+		a.cluster.forward(alerts)
 	}
-
-	a.receiveAlerts(alerts)
-
-	log.Debugf("got %d firing alerts from alertsource", len(alerts))
-	asJson(w, http.StatusOK, "success")
+	return a.bufferAlerts(alerts)
 }
 
-func (a *AlertManager) receiveAlerts(alerts []sharedtools.Alert) {
+func (a *AlertManager) bufferAlerts(alerts []sharedtools.Alert) []string {
 	log := zap.S()
+	fingerprints := []string{}
 	for _, alert := range alerts {
 		silenced := false
 		alert := alert
@@ -227,9 +421,10 @@ func (a *AlertManager) receiveAlerts(alerts []sharedtools.Alert) {
 		}
 		if !silenced {
 			alert.LastReceiveAt = time.Now()
-			copyLabels := sharedtools.CopyMap(alert.Labels)
-			delete(copyLabels, "uid") //reduce duplication of alerts
-			alert.Fingerprint = sharedtools.LabelSetToFingerprint(copyLabels)
+			fingerprint, policy, fingerprintLabels := a.fingerprint(alert.Labels)
+			alert.Fingerprint = fingerprint
+			alert.FingerprintPolicy = policy
+			alert.FingerprintLabels = fingerprintLabels
 
 			a.AlertBufferMutex.Lock()
 			if alertsforge_delay_resolve, ok := alert.Labels["alertsforge_delay_resolve"]; ok {
@@ -251,9 +446,67 @@ func (a *AlertManager) receiveAlerts(alerts []sharedtools.Alert) {
 				alert.Status = sharedtools.Pending
 				a.AlertsBuffer[alert.Fingerprint] = &alert
 			}
+			a.persistAlert(a.AlertsBuffer[alert.Fingerprint])
 			a.AlertBufferMutex.Unlock()
+			fingerprints = append(fingerprints, alert.Fingerprint)
 		}
 	}
+	return fingerprints
+}
+
+// resolveAlerts ends alerts which disappeared from source, in HA mode they are also resolved on leader
+func (a *AlertManager) resolveAlerts(fingerprints []string) {
+	if a.cluster != nil {
+		a.cluster.forwardResolved(fingerprints)
+	}
+	a.expireAlerts(fingerprints)
+}
+
+// expireAlerts sets end of alerts to current time, alertsforge_delay_resolve is respected
+func (a *AlertManager) expireAlerts(fingerprints []string) {
+	log := zap.S()
+	a.AlertBufferMutex.Lock()
+	defer a.AlertBufferMutex.Unlock()
+	for _, fingerprint := range fingerprints {
+		alert, ok := a.AlertsBuffer[fingerprint]
+		if !ok {
+			continue
+		}
+		endsAt := time.Now()
+		if alertsforge_delay_resolve, ok := alert.Labels["alertsforge_delay_resolve"]; ok {
+			if delayDuration, err := time.ParseDuration(alertsforge_delay_resolve); err == nil {
+				endsAt = endsAt.Add(delayDuration)
+			}
+		} else if delayDuration, err := time.ParseDuration(os.Getenv("AF_DEFAULT_RESOLVE_DELAY")); err == nil {
+			endsAt = endsAt.Add(delayDuration)
+		}
+		if alert.EndsAt.After(endsAt) {
+			log.Infof("resolving alert with fingerprint %s", fingerprint)
+			alert.EndsAt = endsAt
+			a.persistAlert(alert)
+		}
+	}
+}
+
+// persistAlert writes alert to buffer store, AlertBufferMutex must be held by caller
+func (a *AlertManager) persistAlert(alert *sharedtools.Alert) {
+	if a.BufferStore == nil {
+		return
+	}
+	if err := a.BufferStore.Save(*alert); err != nil {
+		zap.S().Errorf("can't persist alert %s: %s", alert.Fingerprint, err)
+	}
+}
+
+// deleteAlert removes alert from buffer and buffer store, AlertBufferMutex must be held by caller
+func (a *AlertManager) deleteAlert(fingerprint string) {
+	delete(a.AlertsBuffer, fingerprint)
+	if a.BufferStore == nil {
+		return
+	}
+	if err := a.BufferStore.Delete(fingerprint); err != nil {
+		zap.S().Errorf("can't delete alert %s from buffer store: %s", fingerprint, err)
+	}
 }
 
 func asJson(w http.ResponseWriter, status int, message string) {
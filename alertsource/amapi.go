@@ -0,0 +1,382 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/alertsink"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Alert states of alertmanager api
+const (
+	activeState      = "active"
+	unprocessedState = "unprocessed"
+	suppressedState  = "suppressed"
+)
+
+// GettableAlert is the alert representation of alertmanager api v2
+type GettableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+	Receivers    []Receiver        `json:"receivers"`
+	Status       AlertStatus       `json:"status"`
+}
+
+type Receiver struct {
+	Name string `json:"name"`
+}
+
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+type AlertGroup struct {
+	Labels   map[string]string `json:"labels"`
+	Receiver Receiver          `json:"receiver"`
+	Alerts   []GettableAlert   `json:"alerts"`
+}
+
+type labelMatcher struct {
+	name     string
+	operator string
+	value    string
+	regexp   *regexp.Regexp
+}
+
+var matcherRegexp = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(=~|!~|!=|=)\s*(.*?)\s*$`)
+
+// GetAlertsWebhook serves GET /api/v2/alerts of alertmanager api over the alerts buffer
+func (a *AlertManager) GetAlertsWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	alerts, err := a.filterAlerts(r)
+	if err != nil {
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+// GetAlertGroupsWebhook serves GET /api/v2/alerts/groups, alerts are grouped by oncall title
+func (a *AlertManager) GetAlertGroupsWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	alerts, err := a.filterAlerts(r)
+	if err != nil {
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groups := map[string]*AlertGroup{}
+	for _, alert := range alerts {
+		title := sharedtools.MustTemplateString(a.runbooks.OncallMessage.Title, alertsink.AlertTemplate{
+			Labels:      alert.Labels,
+			Annotations: alert.Annotations,
+		}, "")
+		for _, receiver := range alert.Receivers {
+			key := title + "/" + receiver.Name
+			if _, ok := groups[key]; !ok {
+				labels := map[string]string{}
+				if title != "" {
+					labels["title"] = title
+				}
+				groups[key] = &AlertGroup{Labels: labels, Receiver: receiver, Alerts: []GettableAlert{}}
+			}
+			groups[key].Alerts = append(groups[key].Alerts, alert)
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]AlertGroup, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *groups[key])
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// statusConfig is the part of config shown in status, sink configs and integrations aren't shown
+// because they contain tokens
+type statusConfig struct {
+	Route     *config.Route `yaml:"route,omitempty"`
+	Receivers []Receiver    `yaml:"receivers"`
+}
+
+// GetStatusWebhook serves GET /api/v2/status, config has only route and receivers
+func (a *AlertManager) GetStatusWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	shown := statusConfig{Route: a.runbooks.Route, Receivers: []Receiver{}}
+	sinks := []string{alertsink.Oncall}
+	if a.AlertRouter != nil {
+		sinks = a.AlertRouter.SinkNames()
+	}
+	for _, name := range sinks {
+		shown.Receivers = append(shown.Receivers, Receiver{Name: name})
+	}
+	original, err := yaml.Marshal(shown)
+	if err != nil {
+		zap.S().Errorf("can't marshal config: %s", err)
+	}
+
+	versionInfo := map[string]string{
+		"version":   "unknown",
+		"revision":  "unknown",
+		"branch":    "unknown",
+		"buildUser": "unknown",
+		"buildDate": "unknown",
+		"goVersion": runtime.Version(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		versionInfo["version"] = buildInfo.Main.Version
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				versionInfo["revision"] = setting.Value
+			case "vcs.time":
+				versionInfo["buildDate"] = setting.Value
+			}
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cluster": map[string]any{
+			"status": "ready",
+			"peers":  []any{},
+		},
+		"versionInfo": versionInfo,
+		"config": map[string]string{
+			"original": string(original),
+		},
+		"uptime": a.startedAt,
+	})
+}
+
+func (a *AlertManager) filterAlerts(r *http.Request) ([]GettableAlert, error) {
+	query := r.URL.Query()
+	matchers, err := parseMatchers(query["filter"])
+	if err != nil {
+		return nil, err
+	}
+	showActive, err := queryBool(query.Get("active"))
+	if err != nil {
+		return nil, err
+	}
+	showUnprocessed, err := queryBool(query.Get("unprocessed"))
+	if err != nil {
+		return nil, err
+	}
+	// alerts silenced by runbooks and inhibited alerts never get to the buffer, only alerts silenced in sinks are filtered
+	showSilenced, err := queryBool(query.Get("silenced"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := queryBool(query.Get("inhibited")); err != nil {
+		return nil, err
+	}
+	var receiverRegexp *regexp.Regexp
+	if receiver := query.Get("receiver"); receiver != "" {
+		if receiverRegexp, err = regexp.Compile("^(?:" + receiver + ")$"); err != nil {
+			return nil, err
+		}
+	}
+
+	a.AlertBufferMutex.RLock()
+	alerts := []GettableAlert{}
+	now := time.Now()
+	for _, alert := range a.AlertsBuffer {
+		if !alert.EndsAt.IsZero() && alert.EndsAt.Before(now) {
+			continue
+		}
+		gettable := a.toGettableAlert(alert)
+		if gettable.Status.State == activeState && !showActive {
+			continue
+		}
+		if gettable.Status.State == unprocessedState && !showUnprocessed {
+			continue
+		}
+		if gettable.Status.State == suppressedState && !showSilenced {
+			continue
+		}
+		if !matchAll(matchers, gettable.Labels) {
+			continue
+		}
+		if receiverRegexp != nil && !matchReceiver(receiverRegexp, gettable.Receivers) {
+			continue
+		}
+		alerts = append(alerts, gettable)
+	}
+	a.AlertBufferMutex.RUnlock()
+
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Fingerprint < alerts[j].Fingerprint })
+	return alerts, nil
+}
+
+func (a *AlertManager) toGettableAlert(alert *sharedtools.Alert) GettableAlert {
+	state := activeState
+	silencedBy := []string{}
+	if alert.Status == sharedtools.Pending {
+		state = unprocessedState
+	} else if locallySilenced(*alert) {
+		state = suppressedState
+		silencedBy = append(silencedBy, alert.SilencedBy)
+	}
+	receivers := []Receiver{}
+	for _, name := range a.alertReceivers(alert) {
+		receivers = append(receivers, Receiver{Name: name})
+	}
+	return GettableAlert{
+		Labels:       sharedtools.CopyMap(alert.Labels),
+		Annotations:  sharedtools.CopyMap(alert.Annotations),
+		StartsAt:     alert.StartsAt,
+		EndsAt:       alert.EndsAt,
+		UpdatedAt:    alert.LastReceiveAt,
+		GeneratorURL: alert.GeneratorURL,
+		Fingerprint:  alert.Fingerprint,
+		Receivers:    receivers,
+		Status: AlertStatus{
+			State:       state,
+			SilencedBy:  silencedBy,
+			InhibitedBy: []string{},
+		},
+	}
+}
+
+// alertReceivers returns names of sinks the alert is routed to
+func (a *AlertManager) alertReceivers(alert *sharedtools.Alert) []string {
+	if a.AlertRouter == nil {
+		return []string{alertsink.Oncall}
+	}
+	return a.AlertRouter.Route(alert.Labels)
+}
+
+// parseMatchers parses alertmanager filter matchers like alertname="foo" or instance=~"app-.+"
+func parseMatchers(filters []string) ([]labelMatcher, error) {
+	matchers := []labelMatcher{}
+	for _, filter := range filters {
+		filter = strings.TrimSpace(filter)
+		filter = strings.TrimSuffix(strings.TrimPrefix(filter, "{"), "}")
+		for _, part := range splitMatchers(filter) {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			groups := matcherRegexp.FindStringSubmatch(part)
+			if groups == nil {
+				return nil, fmt.Errorf("bad matcher format: %s", part)
+			}
+			value := groups[3]
+			if strings.HasPrefix(value, `"`) {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("bad matcher value: %s", part)
+				}
+				value = unquoted
+			}
+			matcher := labelMatcher{name: groups[1], operator: groups[2], value: value}
+			if matcher.operator == "=~" || matcher.operator == "!~" {
+				compiled, err := regexp.Compile("^(?:" + value + ")$")
+				if err != nil {
+					return nil, err
+				}
+				matcher.regexp = compiled
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	return matchers, nil
+}
+
+// splitMatchers splits comma separated matchers ignoring commas inside quoted values
+func splitMatchers(filter string) []string {
+	parts := []string{}
+	current := strings.Builder{}
+	quoted := false
+	escaped := false
+	for _, char := range filter {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '"':
+			quoted = !quoted
+		case char == ',' && !quoted:
+			parts = append(parts, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteRune(char)
+	}
+	return append(parts, current.String())
+}
+
+func (m labelMatcher) matches(labels map[string]string) bool {
+	value := labels[m.name]
+	switch m.operator {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.regexp.MatchString(value)
+	case "!~":
+		return !m.regexp.MatchString(value)
+	}
+	return false
+}
+
+func matchAll(matchers []labelMatcher, labels map[string]string) bool {
+	for _, matcher := range matchers {
+		if !matcher.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchReceiver(receiverRegexp *regexp.Regexp, receivers []Receiver) bool {
+	for _, receiver := range receivers {
+		if receiverRegexp.MatchString(receiver.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryBool parses boolean query parameter, absent parameter is true like in alertmanager
+func queryBool(value string) (bool, error) {
+	if value == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		asJson(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
@@ -0,0 +1,172 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAPITestAlertManager() *AlertManager {
+	return &AlertManager{
+		runbooks: &config.RunbooksConfig{
+			OncallMessage: config.OncallMessage{Title: "{{ .Labels.alertsforge_title }}"},
+		},
+		AlertsBuffer: map[string]*sharedtools.Alert{
+			"alert1": {
+				Fingerprint: "alert1",
+				Labels:      map[string]string{"alertname": "container-oom", "namespace": "prod", "alertsforge_title": "oom"},
+				EndsAt:      time.Now().Add(time.Hour),
+				Status:      sharedtools.Firing,
+			},
+			"alert2": {
+				Fingerprint: "alert2",
+				Labels:      map[string]string{"alertname": "container-restart", "namespace": "stg", "alertsforge_title": "oom"},
+				EndsAt:      time.Now().Add(time.Hour),
+				Status:      sharedtools.Firing,
+			},
+			"alert3": {
+				Fingerprint: "alert3",
+				Labels:      map[string]string{"alertname": "container-oom", "namespace": "stg"},
+				EndsAt:      time.Now().Add(time.Hour),
+				Status:      sharedtools.Pending,
+			},
+			"alert4": {
+				Fingerprint: "alert4",
+				Labels:      map[string]string{"alertname": "container-oom", "namespace": "dev"},
+				EndsAt:      time.Now().Add(-time.Hour),
+				Status:      sharedtools.Firing,
+			},
+		},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+}
+
+func getAlerts(t *testing.T, am *AlertManager, query string) ([]GettableAlert, int) {
+	t.Helper()
+	writer := httptest.NewRecorder()
+	am.AlertWebhook(writer, httptest.NewRequest(http.MethodGet, "/alertWebhook/api/v2/alerts"+query, nil))
+	alerts := []GettableAlert{}
+	if writer.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &alerts))
+	}
+	return alerts, writer.Code
+}
+
+func fingerprints(alerts []GettableAlert) []string {
+	result := []string{}
+	for _, alert := range alerts {
+		result = append(result, alert.Fingerprint)
+	}
+	return result
+}
+
+func TestAlertManager_GetAlertsWebhook(t *testing.T) {
+	am := newAPITestAlertManager()
+
+	testCases := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "all not resolved alerts", query: "", expected: []string{"alert1", "alert2", "alert3"}},
+		{name: "equal matcher", query: `?filter=alertname="container-oom"`, expected: []string{"alert1", "alert3"}},
+		{name: "several matchers", query: `?filter=alertname="container-oom"&filter=namespace!="prod"`, expected: []string{"alert3"}},
+		{name: "regexp matcher", query: `?filter={namespace=~"st.*",alertname!~"container-oom"}`, expected: []string{"alert2"}},
+		{name: "only unprocessed", query: "?active=false", expected: []string{"alert3"}},
+		{name: "only active", query: "?unprocessed=false", expected: []string{"alert1", "alert2"}},
+		{name: "receiver", query: "?receiver=onc.%2B", expected: []string{"alert1", "alert2", "alert3"}},
+		{name: "unknown receiver", query: "?receiver=slack", expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts, code := getAlerts(t, am, tc.query)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, tc.expected, fingerprints(alerts))
+		})
+	}
+
+	t.Run("alert format", func(t *testing.T) {
+		alerts, _ := getAlerts(t, am, `?filter=namespace="stg"&filter=alertname="container-oom"`)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, unprocessedState, alerts[0].Status.State)
+		assert.Equal(t, []Receiver{{Name: "oncall"}}, alerts[0].Receivers)
+		assert.Equal(t, []string{}, alerts[0].Status.SilencedBy)
+	})
+
+	t.Run("bad filter", func(t *testing.T) {
+		_, code := getAlerts(t, am, `?filter=alertname~"oom"`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		_, code = getAlerts(t, am, `?active=maybe`)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestAlertManager_GetAlertGroupsWebhook(t *testing.T) {
+	am := newAPITestAlertManager()
+	writer := httptest.NewRecorder()
+	am.GetAlertGroupsWebhook(writer, httptest.NewRequest(http.MethodGet, "/alertWebhook/api/v2/alerts/groups", nil))
+	require.Equal(t, http.StatusOK, writer.Code)
+
+	groups := []AlertGroup{}
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &groups))
+	require.Len(t, groups, 2)
+	assert.Equal(t, map[string]string{}, groups[0].Labels)
+	assert.Equal(t, []string{"alert3"}, fingerprints(groups[0].Alerts))
+	assert.Equal(t, map[string]string{"title": "oom"}, groups[1].Labels)
+	assert.Equal(t, []string{"alert1", "alert2"}, fingerprints(groups[1].Alerts))
+	assert.Equal(t, "oncall", groups[1].Receiver.Name)
+}
+
+func TestAlertManager_GetStatusWebhook(t *testing.T) {
+	am := newAPITestAlertManager()
+	writer := httptest.NewRecorder()
+	am.GetStatusWebhook(writer, httptest.NewRequest(http.MethodGet, "/alertWebhook/api/v2/status", nil))
+	require.Equal(t, http.StatusOK, writer.Code)
+
+	status := struct {
+		Cluster struct {
+			Status string `json:"status"`
+		} `json:"cluster"`
+		Config struct {
+			Original string `json:"original"`
+		} `json:"config"`
+		VersionInfo map[string]string `json:"versionInfo"`
+	}{}
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &status))
+	assert.Equal(t, "ready", status.Cluster.Status)
+	assert.Equal(t, "receivers:\n    - name: oncall\n", status.Config.Original)
+	assert.NotEmpty(t, status.VersionInfo["goVersion"])
+
+	// sink configs with tokens are not shown
+	am.runbooks.Sinks = []config.Sink{{Name: "pd", Type: "pagerduty", Config: map[string]string{"routingKey": "S3CR3T"}}}
+	am.runbooks.OncallIntegrations = []config.OncallIntegration{{Name: "backend", URL: "T0K3N"}}
+	am.runbooks.Route = &config.Route{Sinks: []string{"pd"}}
+	writer = httptest.NewRecorder()
+	am.GetStatusWebhook(writer, httptest.NewRequest(http.MethodGet, "/alertWebhook/api/v2/status", nil))
+	require.NoError(t, json.Unmarshal(writer.Body.Bytes(), &status))
+	assert.Contains(t, status.Config.Original, "route:\n    sinks:\n        - pd\n")
+	assert.NotContains(t, status.Config.Original, "S3CR3T")
+	assert.NotContains(t, status.Config.Original, "T0K3N")
+}
+
+func TestParseMatchers(t *testing.T) {
+	matchers, err := parseMatchers([]string{`{alertname="a,b", severity=~"p[12]"}`, `team!=devops`})
+	require.NoError(t, err)
+	require.Len(t, matchers, 3)
+	assert.Equal(t, "a,b", matchers[0].value)
+	assert.True(t, matchers[1].matches(map[string]string{"severity": "p1"}))
+	assert.False(t, matchers[1].matches(map[string]string{"severity": "p10"}))
+	assert.True(t, matchers[2].matches(map[string]string{"team": "backend"}))
+
+	_, err = parseMatchers([]string{`severity=~"p[12"`})
+	assert.Error(t, err)
+}
@@ -0,0 +1,255 @@
+package alertsource
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	bufferRecordSave   = "save"
+	bufferRecordDelete = "delete"
+
+	// amount of appended records after which write-ahead log is rewritten with actual buffer state
+	compactAfterRecords = 1000
+)
+
+type BufferStoreInterface interface {
+	Load() (map[string]*sharedtools.Alert, error)
+	Save(alert sharedtools.Alert) error
+	Delete(fingerprint string) error
+}
+
+// BufferRecord is a single entry of persisted buffer, LastSinkAt, LastReceiveAt and AcceptedBy are stored explicitly
+// because sharedtools.Alert doesn't serialize them
+type BufferRecord struct {
+	Op            string             `json:"op"`
+	Fingerprint   string             `json:"fingerprint"`
+	Alert         *sharedtools.Alert `json:"alert,omitempty"`
+	LastSinkAt    time.Time          `json:"lastSinkAt,omitempty"`
+	LastReceiveAt time.Time          `json:"lastReceiveAt,omitempty"`
+	AcceptedBy    []string           `json:"acceptedBy,omitempty"`
+
+	FingerprintPolicy string   `json:"fingerprintPolicy,omitempty"`
+	FingerprintLabels []string `json:"fingerprintLabels,omitempty"`
+	SinkState         string   `json:"sinkState,omitempty"`
+	SilencedBy        string   `json:"silencedBy,omitempty"`
+}
+
+func NewBufferRecord(alert sharedtools.Alert) BufferRecord {
+	return BufferRecord{
+		Op:            bufferRecordSave,
+		Fingerprint:   alert.Fingerprint,
+		Alert:         &alert,
+		LastSinkAt:    alert.LastSinkAt,
+		LastReceiveAt: alert.LastReceiveAt,
+		AcceptedBy:    alert.AcceptedBy,
+
+		FingerprintPolicy: alert.FingerprintPolicy,
+		FingerprintLabels: alert.FingerprintLabels,
+		SinkState:         alert.SinkState,
+		SilencedBy:        alert.SilencedBy,
+	}
+}
+
+func (r BufferRecord) ToAlert() *sharedtools.Alert {
+	alert := *r.Alert
+	alert.LastSinkAt = r.LastSinkAt
+	alert.LastReceiveAt = r.LastReceiveAt
+	alert.AcceptedBy = r.AcceptedBy
+	alert.FingerprintPolicy = r.FingerprintPolicy
+	alert.FingerprintLabels = r.FingerprintLabels
+	alert.SinkState = r.SinkState
+	alert.SilencedBy = r.SilencedBy
+	return &alert
+}
+
+// NewBufferStore returns write-ahead log store if path is set and in-memory store otherwise
+func NewBufferStore(path string) BufferStoreInterface {
+	if path == "" {
+		return &memoryBufferStore{}
+	}
+	return &fileBufferStore{path: path}
+}
+
+// memoryBufferStore keeps nothing, buffer lives only in AlertManager.AlertsBuffer
+type memoryBufferStore struct{}
+
+func (m *memoryBufferStore) Load() (map[string]*sharedtools.Alert, error) {
+	return map[string]*sharedtools.Alert{}, nil
+}
+
+func (m *memoryBufferStore) Save(alert sharedtools.Alert) error {
+	return nil
+}
+
+func (m *memoryBufferStore) Delete(fingerprint string) error {
+	return nil
+}
+
+// fileBufferStore is append-only json lines log which is replayed on Load
+type fileBufferStore struct {
+	path     string
+	file     *os.File
+	state    map[string]BufferRecord
+	appended int
+	mutex    sync.Mutex
+}
+
+func (f *fileBufferStore) Load() (map[string]*sharedtools.Alert, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.state = map[string]BufferRecord{}
+	if err := f.replay(); err != nil {
+		return nil, err
+	}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+
+	buffer := map[string]*sharedtools.Alert{}
+	for fingerprint, record := range f.state {
+		buffer[fingerprint] = record.ToAlert()
+	}
+	zap.S().Infof("restored %d alerts from buffer store %s", len(buffer), f.path)
+	return buffer, nil
+}
+
+func (f *fileBufferStore) Save(alert sharedtools.Alert) error {
+	return f.append(NewBufferRecord(sharedtools.CopyAlert(&alert)))
+}
+
+func (f *fileBufferStore) Delete(fingerprint string) error {
+	return f.append(BufferRecord{Op: bufferRecordDelete, Fingerprint: fingerprint})
+}
+
+func (f *fileBufferStore) replay() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		record := BufferRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// last line can be partially written if process was killed
+			zap.S().Warnf("skipping broken buffer store record: %s", err)
+			continue
+		}
+		f.apply(record)
+	}
+	return scanner.Err()
+}
+
+func (f *fileBufferStore) apply(record BufferRecord) {
+	switch record.Op {
+	case bufferRecordSave:
+		if record.Alert != nil {
+			f.state[record.Fingerprint] = record
+		}
+	case bufferRecordDelete:
+		delete(f.state, record.Fingerprint)
+	}
+}
+
+// compact rewrites log with only actual records and reopens it for appending
+func (f *fileBufferStore) compact() error {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, record := range f.state {
+		line, err := json.Marshal(record)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return err
+	}
+
+	f.appended = 0
+	return f.open()
+}
+
+func (f *fileBufferStore) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	return nil
+}
+
+func (f *fileBufferStore) append(record BufferRecord) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.state == nil {
+		// state is needed for compaction, so existing log must be read even if Load wasn't called
+		f.state = map[string]BufferRecord{}
+		if err := f.replay(); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.apply(record)
+	f.appended++
+
+	if f.appended > compactAfterRecords {
+		return f.compact()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package alertsource
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileBufferStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer", "wal.jsonl")
+	lastSink := time.Now().Add(-time.Hour).Round(0)
+	lastReceive := time.Now().Add(-time.Minute).Round(0)
+
+	store := NewBufferStore(path)
+	buffer, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, buffer)
+
+	require.NoError(t, store.Save(sharedtools.Alert{
+		Fingerprint:   "alert1",
+		Status:        sharedtools.Firing,
+		Labels:        map[string]string{"alertname": "test"},
+		LastSinkAt:    lastSink,
+		LastReceiveAt: lastReceive,
+	}))
+	require.NoError(t, store.Save(sharedtools.Alert{Fingerprint: "alert2", Status: sharedtools.Pending}))
+	require.NoError(t, store.Save(sharedtools.Alert{Fingerprint: "alert2", Status: sharedtools.Firing}))
+	require.NoError(t, store.Save(sharedtools.Alert{Fingerprint: "alert3", Status: sharedtools.Pending}))
+	require.NoError(t, store.Delete("alert3"))
+
+	restored, err := NewBufferStore(path).Load()
+	require.NoError(t, err)
+	assert.Len(t, restored, 2)
+	assert.Equal(t, sharedtools.Firing, restored["alert1"].Status)
+	assert.Equal(t, "test", restored["alert1"].Labels["alertname"])
+	assert.True(t, lastSink.Equal(restored["alert1"].LastSinkAt))
+	assert.True(t, lastReceive.Equal(restored["alert1"].LastReceiveAt))
+	assert.Equal(t, sharedtools.Firing, restored["alert2"].Status)
+}
+
+func TestFileBufferStore_BrokenRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.jsonl")
+	store := NewBufferStore(path)
+	require.NoError(t, store.Save(sharedtools.Alert{Fingerprint: "alert1", Status: sharedtools.Firing}))
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"op":"save","fingerprint":"alert2","ale`)
+	require.NoError(t, err)
+	file.Close()
+
+	restored, err := NewBufferStore(path).Load()
+	require.NoError(t, err)
+	assert.Len(t, restored, 1)
+	assert.Contains(t, restored, "alert1")
+}
+
+func TestAlertManager_RestoreBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal.jsonl")
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	os.Setenv("AF_BUFFER_PATH", path)
+	defer os.Setenv("AF_BUFFER_PATH", "")
+
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+		BufferStore:      NewBufferStore(path),
+	}
+	am.receiveAlerts([]sharedtools.Alert{
+		{
+			Labels: map[string]string{"somelabel": "value"},
+			EndsAt: time.Now().Add(time.Hour),
+		},
+	})
+
+	manager, err := NewAlertManager(&config.RunbooksConfig{})
+	require.NoError(t, err)
+	restarted := manager.(*AlertManager)
+	require.Contains(t, restarted.AlertsBuffer, "c337993c31eb8eac")
+	alert := restarted.AlertsBuffer["c337993c31eb8eac"]
+	assert.Equal(t, sharedtools.Pending, alert.Status)
+	assert.False(t, alert.LastReceiveAt.IsZero())
+}
@@ -0,0 +1,506 @@
+package alertsource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const (
+	clusterStatusPath   = "/cluster/status"
+	clusterAlertsPath   = "/cluster/alerts"
+	clusterSnapshotPath = "/cluster/snapshot"
+	clusterResolvePath  = "/cluster/resolve"
+
+	// forwardedHeader marks request forwarded to leader, so it's not forwarded again when replicas disagree on leader
+	forwardedHeader = "X-Alertsforge-Forwarded"
+
+	defaultHeartbeatInterval = 5 * time.Second
+	// minClusterPeers is the least amount of peers which keeps majority when one of them is down
+	minClusterPeers = 3
+	// maxPendingForwards limits requests kept for leader while it's unreachable, the oldest are dropped above it
+	maxPendingForwards = 10000
+)
+
+type ClusterStatus struct {
+	Address string          `json:"address"`
+	Leader  string          `json:"leader"`
+	Synced  bool            `json:"synced"`
+	Peers   map[string]bool `json:"peers"`
+}
+
+// ClusterSnapshot is the whole alerts buffer sent by leader to followers, GeneratedAt is leader's clock
+// and is not compared with local time of follower
+type ClusterSnapshot struct {
+	Leader      string         `json:"leader"`
+	GeneratedAt time.Time      `json:"generatedAt"`
+	Records     []BufferRecord `json:"records"`
+}
+
+// Cluster replicates alerts buffer between replicas, the first alive synced peer in sorted list of addresses is the leader,
+// only leader processes buffer and sends alerts to sinks, followers forward received and resolved alerts to leader.
+// Replica is synced when it got buffer snapshot from leader or when none of alive peers is synced on cold start,
+// so restarted replica doesn't take leadership with stale buffer. Leader is elected only when majority of peers is alive.
+// Requests forwarded to leader are kept in order until leader acknowledges them and are retried every heartbeat
+type Cluster struct {
+	self              string
+	peers             []string
+	alive             map[string]bool
+	synced            map[string]bool
+	am                AlertManagerInterface
+	client            *http.Client
+	heartbeatInterval time.Duration
+	// lastSnapshotAt is local time when the last snapshot was applied
+	lastSnapshotAt time.Time
+	token          string
+	mutex          sync.RWMutex
+
+	pendingForwards []clusterForward
+	forwardMutex    sync.Mutex
+}
+
+// clusterForward is request to leader which was not acknowledged yet
+type clusterForward struct {
+	path string
+	body []byte
+}
+
+// NewClusterFromEnv creates cluster from AF_CLUSTER_PEERS and AF_CLUSTER_SELF, AF_CLUSTER_TOKEN is sent to peers
+// as bearer token and must have admin role when auth is enabled, nil is returned if HA mode is not configured.
+// At least 3 peers are required, as 2 peers can't keep majority when one of them is down and never fail over
+func NewClusterFromEnv(am AlertManagerInterface) (*Cluster, error) {
+	if os.Getenv("AF_CLUSTER_PEERS") == "" {
+		return nil, nil
+	}
+	self := os.Getenv("AF_CLUSTER_SELF")
+	if self == "" {
+		return nil, errors.New("AF_CLUSTER_SELF must be set when AF_CLUSTER_PEERS is set")
+	}
+	cluster := NewCluster(am, self, strings.Split(os.Getenv("AF_CLUSTER_PEERS"), ","))
+	if len(cluster.peers) < minClusterPeers {
+		return nil, fmt.Errorf("HA mode requires at least %d peers including AF_CLUSTER_SELF, got %d", minClusterPeers, len(cluster.peers))
+	}
+	if interval, err := time.ParseDuration(os.Getenv("AF_CLUSTER_HEARTBEAT")); err == nil {
+		cluster.heartbeatInterval = interval
+	}
+	cluster.token = os.Getenv("AF_CLUSTER_TOKEN")
+	return cluster, nil
+}
+
+func NewCluster(am AlertManagerInterface, self string, peers []string) *Cluster {
+	self = strings.TrimSuffix(strings.TrimSpace(self), "/")
+	addresses := map[string]bool{self: true}
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(strings.TrimSpace(peer), "/")
+		if peer != "" {
+			addresses[peer] = true
+		}
+	}
+	sortedPeers := make([]string, 0, len(addresses))
+	alive := map[string]bool{}
+	for address := range addresses {
+		sortedPeers = append(sortedPeers, address)
+		// peers are considered alive until first failed heartbeat, so replicas started together agree on leader
+		alive[address] = true
+	}
+	sort.Strings(sortedPeers)
+
+	cluster := &Cluster{
+		self:              self,
+		peers:             sortedPeers,
+		alive:             alive,
+		synced:            map[string]bool{},
+		am:                am,
+		client:            &http.Client{Timeout: 5 * time.Second},
+		heartbeatInterval: defaultHeartbeatInterval,
+		// alerts received before start are restored from write-ahead log and are dropped by the first snapshot
+		lastSnapshotAt: time.Now(),
+	}
+	am.setCluster(cluster)
+	return cluster
+}
+
+func (c *Cluster) Register(mux *http.ServeMux) {
+	mux.HandleFunc(clusterStatusPath, c.statusWebhook)
+	mux.HandleFunc(clusterAlertsPath, c.alertsWebhook)
+	mux.HandleFunc(clusterSnapshotPath, c.snapshotWebhook)
+	mux.HandleFunc(clusterResolvePath, c.resolveWebhook)
+}
+
+func (c *Cluster) Run() {
+	c.heartbeat()
+	for range time.Tick(c.heartbeatInterval) {
+		c.heartbeat()
+	}
+}
+
+// Leader returns the first alive synced peer, empty string is returned when there is no leader
+// because majority of peers is not alive or none of them is synced yet
+func (c *Cluster) Leader() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if !c.hasQuorum() {
+		return ""
+	}
+	for _, peer := range c.peers {
+		if c.alive[peer] && c.synced[peer] {
+			return peer
+		}
+	}
+	return ""
+}
+
+// hasQuorum is true when majority of peers is alive, mutex must be held by caller
+func (c *Cluster) hasQuorum() bool {
+	alive := 0
+	for _, peer := range c.peers {
+		if c.alive[peer] {
+			alive++
+		}
+	}
+	return alive*2 > len(c.peers)
+}
+
+func (c *Cluster) isSynced() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.synced[c.self]
+}
+
+func (c *Cluster) IsLeader() bool {
+	return c.Leader() == c.self
+}
+
+func (c *Cluster) Status() ClusterStatus {
+	leader := c.Leader()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	peers := map[string]bool{}
+	for peer, alive := range c.alive {
+		peers[peer] = alive
+	}
+	return ClusterStatus{Address: c.self, Leader: leader, Synced: c.synced[c.self], Peers: peers}
+}
+
+// heartbeat checks which peers are alive and synced, leader changes as soon as it stops responding.
+// Replica which is not synced yet joins cluster after heartbeat
+func (c *Cluster) heartbeat() {
+	log := zap.S()
+	leader := c.Leader()
+	results := map[string]*ClusterStatus{}
+	resultsMutex := sync.Mutex{}
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		if peer == c.self {
+			continue
+		}
+		peer := peer
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := &ClusterStatus{}
+			if err := c.send(http.MethodGet, peer+clusterStatusPath, nil, status); err != nil {
+				status = nil
+			}
+			resultsMutex.Lock()
+			results[peer] = status
+			resultsMutex.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	c.mutex.Lock()
+	for peer, status := range results {
+		alive := status != nil
+		if c.alive[peer] != alive {
+			log.Infof("cluster peer %s alive: %t", peer, alive)
+		}
+		c.alive[peer] = alive
+		c.synced[peer] = alive && status.Synced
+	}
+	c.mutex.Unlock()
+
+	if !c.isSynced() {
+		c.join()
+	}
+	c.flushForwards()
+	if newLeader := c.Leader(); newLeader != leader {
+		log.Warnf("cluster leader changed from %s to %s", leader, newLeader)
+	}
+}
+
+// join pulls buffer snapshot from leader, if none of alive peers is synced on cold start
+// replica keeps its own buffer, it becomes synced only when majority of peers is alive
+func (c *Cluster) join() {
+	leader := c.Leader()
+	if leader == "" {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if !c.hasQuorum() {
+			zap.S().Warnf("majority of cluster peers is not alive, waiting for them to join")
+			return
+		}
+		zap.S().Infof("none of cluster peers is synced, %s is synced with own buffer", c.self)
+		c.synced[c.self] = true
+		return
+	}
+	snapshot := ClusterSnapshot{}
+	if err := c.send(http.MethodGet, leader+clusterSnapshotPath, nil, &snapshot); err != nil {
+		zap.S().Errorf("can't get buffer snapshot from leader %s: %s", leader, err)
+		return
+	}
+	c.applySnapshot(snapshot)
+	zap.S().Infof("%s is synced with buffer of leader %s", c.self, leader)
+}
+
+// applySnapshot replaces buffer with leader's snapshot and marks replica as synced, alerts received after
+// the previous snapshot was applied are kept as leader may not have them yet. Only local clock is compared
+// with local receive time, so clock skew between replicas doesn't drop alerts
+func (c *Cluster) applySnapshot(snapshot ClusterSnapshot) {
+	c.mutex.Lock()
+	keepReceivedAfter := c.lastSnapshotAt
+	c.lastSnapshotAt = time.Now()
+	c.synced[c.self] = true
+	c.mutex.Unlock()
+
+	c.am.applySnapshot(snapshot.Records, keepReceivedAfter)
+}
+
+// forward sends alerts received by follower to leader, alerts are serialized before return so caller can modify them
+func (c *Cluster) forward(alerts []sharedtools.Alert) {
+	if len(alerts) > 0 {
+		c.sendToLeader(clusterAlertsPath, alerts)
+	}
+}
+
+// forwardResolved sends fingerprints of alerts resolved by follower to leader
+func (c *Cluster) forwardResolved(fingerprints []string) {
+	if len(fingerprints) > 0 {
+		c.sendToLeader(clusterResolvePath, fingerprints)
+	}
+}
+
+// sendToLeader queues request for leader and sends queue in background, request which was not acknowledged
+// is retried with next heartbeat
+func (c *Cluster) sendToLeader(path string, payload any) {
+	if c.IsLeader() {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		zap.S().Errorf("can't marshal %s request for leader: %s", path, err)
+		return
+	}
+	c.mutex.Lock()
+	c.pendingForwards = append(c.pendingForwards, clusterForward{path: path, body: body})
+	if dropped := len(c.pendingForwards) - maxPendingForwards; dropped > 0 {
+		zap.S().Errorf("leader is unreachable, dropping %d oldest forwarded requests", dropped)
+		c.pendingForwards = c.pendingForwards[dropped:]
+	}
+	c.mutex.Unlock()
+	go c.flushForwards()
+}
+
+// flushForwards sends pending requests to leader in order until one of them fails, requests are dropped when
+// replica becomes leader itself because they are already in its buffer
+func (c *Cluster) flushForwards() {
+	c.forwardMutex.Lock()
+	defer c.forwardMutex.Unlock()
+	for {
+		leader := c.Leader()
+		c.mutex.Lock()
+		if leader == c.self && len(c.pendingForwards) > 0 {
+			zap.S().Infof("%s is the leader, dropping %d requests forwarded to previous leader", c.self, len(c.pendingForwards))
+			c.pendingForwards = nil
+		}
+		if leader == "" || len(c.pendingForwards) == 0 {
+			c.mutex.Unlock()
+			return
+		}
+		forward := c.pendingForwards[0]
+		c.mutex.Unlock()
+
+		if err := c.send(http.MethodPost, leader+forward.path, forward.body, nil); err != nil {
+			zap.S().Errorf("can't forward %s request to leader %s, it's retried with next heartbeat: %s", forward.path, leader, err)
+			return
+		}
+		c.mutex.Lock()
+		c.pendingForwards = c.pendingForwards[1:]
+		c.mutex.Unlock()
+	}
+}
+
+// proxyToLeader sends request to leader and waits for its response, it's used for requests applied by leader only
+func (c *Cluster) proxyToLeader(path string, body []byte) (string, error) {
+	leader := c.Leader()
+	if leader == "" {
+		return "", errors.New("there is no leader")
+	}
+	req, err := http.NewRequest(http.MethodPost, leader+path, bytes.NewReader(body))
+	if err != nil {
+		return leader, err
+	}
+	req.Header.Set(forwardedHeader, c.self)
+	return leader, c.do(req, nil)
+}
+
+// replicate sends buffer snapshot from leader to all alive followers
+func (c *Cluster) replicate() {
+	if !c.IsLeader() {
+		return
+	}
+	snapshot := ClusterSnapshot{Leader: c.self, GeneratedAt: time.Now(), Records: c.am.bufferSnapshot()}
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		zap.S().Errorf("can't marshal buffer snapshot: %s", err)
+		return
+	}
+
+	c.mutex.RLock()
+	followers := []string{}
+	for _, peer := range c.peers {
+		if peer != c.self && c.alive[peer] {
+			followers = append(followers, peer)
+		}
+	}
+	c.mutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, follower := range followers {
+		follower := follower
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.send(http.MethodPost, follower+clusterSnapshotPath, body, nil); err != nil {
+				zap.S().Errorf("can't replicate buffer to %s: %s", follower, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// send makes request to peer, response is decoded to result if it's not nil
+func (c *Cluster) send(method, url string, body []byte, result any) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return c.do(req, result)
+}
+
+func (c *Cluster) do(req *http.Request, result any) error {
+	req.Header.Add("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Add("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		io.Copy(io.Discard, res.Body)
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	if result == nil {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+func (c *Cluster) statusWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	writeJSON(w, http.StatusOK, c.Status())
+}
+
+func (c *Cluster) alertsWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	alerts := []sharedtools.Alert{}
+	if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.am.bufferAlerts(alerts)
+	asJson(w, http.StatusOK, "success")
+}
+
+func (c *Cluster) resolveWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	fingerprints := []string{}
+	if err := json.NewDecoder(r.Body).Decode(&fingerprints); err != nil {
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.am.expireAlerts(fingerprints)
+	asJson(w, http.StatusOK, "success")
+}
+
+// snapshotWebhook serves buffer snapshot to joining replicas on GET and applies leader's snapshot on POST
+func (c *Cluster) snapshotWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method == http.MethodGet {
+		if !c.isSynced() {
+			asJson(w, http.StatusConflict, "this replica is not synced")
+			return
+		}
+		writeJSON(w, http.StatusOK, ClusterSnapshot{Leader: c.Leader(), GeneratedAt: time.Now(), Records: c.am.bufferSnapshot()})
+		return
+	}
+	snapshot := ClusterSnapshot{}
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if c.IsLeader() {
+		asJson(w, http.StatusConflict, "this replica is the leader")
+		return
+	}
+
+	c.applySnapshot(snapshot)
+	asJson(w, http.StatusOK, "success")
+}
+
+// bufferSnapshot returns copy of the whole buffer
+func (a *AlertManager) bufferSnapshot() []BufferRecord {
+	a.AlertBufferMutex.RLock()
+	defer a.AlertBufferMutex.RUnlock()
+	records := make([]BufferRecord, 0, len(a.AlertsBuffer))
+	for _, alert := range a.AlertsBuffer {
+		records = append(records, NewBufferRecord(sharedtools.CopyAlert(alert)))
+	}
+	return records
+}
+
+// applySnapshot replaces buffer with leader's one, local alerts received after keepReceivedAfter are kept
+// because they may be still on the way to leader
+func (a *AlertManager) applySnapshot(records []BufferRecord, keepReceivedAfter time.Time) {
+	a.AlertBufferMutex.Lock()
+	defer a.AlertBufferMutex.Unlock()
+	snapshot := map[string]*sharedtools.Alert{}
+	for _, record := range records {
+		if record.Alert != nil {
+			snapshot[record.Fingerprint] = record.ToAlert()
+		}
+	}
+	for fingerprint, alert := range a.AlertsBuffer {
+		if _, ok := snapshot[fingerprint]; !ok && !alert.LastReceiveAt.After(keepReceivedAfter) {
+			a.deleteAlert(fingerprint)
+		}
+	}
+	for fingerprint, alert := range snapshot {
+		a.AlertsBuffer[fingerprint] = alert
+		a.persistAlert(alert)
+	}
+}
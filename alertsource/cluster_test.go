@@ -0,0 +1,305 @@
+package alertsource
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReplica struct {
+	am      *AlertManager
+	server  *httptest.Server
+	mux     *http.ServeMux
+	cluster *Cluster
+}
+
+// newTestReplicas starts replicas in-process, returned slice is sorted by address so the first one is the leader
+func newTestReplicas(t *testing.T, count int) []*testReplica {
+	t.Helper()
+	replicas := []*testReplica{}
+	addresses := []string{}
+	for i := 0; i < count; i++ {
+		mux := http.NewServeMux()
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		replicas = append(replicas, &testReplica{
+			am: &AlertManager{
+				runbooks:         &config.RunbooksConfig{},
+				AlertsBuffer:     map[string]*sharedtools.Alert{},
+				AlertBufferMutex: sync.RWMutex{},
+			},
+			server: server,
+			mux:    mux,
+		})
+		addresses = append(addresses, server.URL)
+	}
+	for _, replica := range replicas {
+		replica.cluster = NewCluster(replica.am, replica.server.URL, addresses)
+		replica.cluster.Register(replica.mux)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].server.URL < replicas[j].server.URL })
+	return replicas
+}
+
+// heartbeat runs heartbeat of replicas in order, so the first one syncs with own buffer and others join it
+func heartbeat(replicas ...*testReplica) {
+	for _, replica := range replicas {
+		replica.cluster.heartbeat()
+	}
+}
+
+func bufferLen(am *AlertManager) int {
+	am.AlertBufferMutex.RLock()
+	defer am.AlertBufferMutex.RUnlock()
+	return len(am.AlertsBuffer)
+}
+
+func TestCluster_Leader(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	assert.Empty(t, replicas[0].cluster.Leader())
+	heartbeat(replicas...)
+
+	assert.True(t, replicas[0].cluster.IsLeader())
+	for _, replica := range replicas {
+		assert.Equal(t, replicas[0].server.URL, replica.cluster.Leader())
+	}
+	assert.False(t, replicas[1].cluster.IsLeader())
+	assert.False(t, replicas[2].cluster.IsLeader())
+
+	writer := httptest.NewRecorder()
+	replicas[1].am.ProcessAlertsBufferWebhook(writer, httptest.NewRequest(http.MethodPost, "/processAlertBuffer", nil))
+	assert.Equal(t, http.StatusConflict, writer.Code)
+}
+
+func TestCluster_ForwardToLeader(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+
+	replicas[2].am.receiveAlerts([]sharedtools.Alert{
+		{Labels: map[string]string{"alertname": "test"}, EndsAt: time.Now().Add(time.Hour)},
+	})
+
+	assert.Equal(t, 1, bufferLen(replicas[2].am))
+	assert.Eventually(t, func() bool { return bufferLen(replicas[0].am) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, bufferLen(replicas[1].am))
+}
+
+func pendingForwards(c *Cluster) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.pendingForwards)
+}
+
+// failingTransport fails requests while fail is set
+type failingTransport struct {
+	fail atomic.Bool
+}
+
+func (f *failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if f.fail.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestCluster_ForwardRetry(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	transport := &failingTransport{}
+	replicas[2].cluster.client = &http.Client{Transport: transport, Timeout: time.Second}
+
+	// forward which leader didn't acknowledge is kept in order and sent with the next heartbeat
+	transport.fail.Store(true)
+	replicas[2].am.receiveAlerts([]sharedtools.Alert{{Labels: map[string]string{"alertname": "test"}, EndsAt: time.Now().Add(time.Hour)}})
+	fingerprint := sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "test"})
+	replicas[2].am.resolveAlerts([]string{fingerprint})
+	replicas[2].cluster.flushForwards()
+	assert.Equal(t, 2, pendingForwards(replicas[2].cluster))
+	assert.Equal(t, 0, bufferLen(replicas[0].am))
+
+	transport.fail.Store(false)
+	replicas[2].cluster.heartbeat()
+	assert.Equal(t, 0, pendingForwards(replicas[2].cluster))
+	require.Equal(t, 1, bufferLen(replicas[0].am))
+	assert.True(t, replicas[0].am.AlertsBuffer[fingerprint].EndsAt.Before(time.Now().Add(time.Minute)))
+
+	// replica which became leader drops forwards to previous leader, as it has them in own buffer
+	transport.fail.Store(true)
+	replicas[2].am.receiveAlerts([]sharedtools.Alert{{Labels: map[string]string{"alertname": "other"}, EndsAt: time.Now().Add(time.Hour)}})
+	replicas[2].cluster.flushForwards()
+	replicas[2].cluster.mutex.Lock()
+	replicas[2].cluster.alive[replicas[0].server.URL] = false
+	replicas[2].cluster.synced[replicas[1].server.URL] = false
+	replicas[2].cluster.mutex.Unlock()
+	require.True(t, replicas[2].cluster.IsLeader())
+	replicas[2].cluster.flushForwards()
+	assert.Equal(t, 0, pendingForwards(replicas[2].cluster))
+}
+
+func TestCluster_ApplySnapshotClockSkew(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	follower := replicas[1]
+
+	// leader's clock is ahead, alert received by follower after snapshot is kept until the next one
+	follower.cluster.applySnapshot(ClusterSnapshot{Leader: replicas[0].server.URL, GeneratedAt: time.Now().Add(time.Hour)})
+	follower.am.bufferAlerts([]sharedtools.Alert{{Labels: map[string]string{"alertname": "test"}, EndsAt: time.Now().Add(time.Hour)}})
+	follower.cluster.applySnapshot(ClusterSnapshot{Leader: replicas[0].server.URL, GeneratedAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, 1, bufferLen(follower.am))
+	follower.cluster.applySnapshot(ClusterSnapshot{Leader: replicas[0].server.URL, GeneratedAt: time.Now().Add(-time.Hour)})
+	assert.Equal(t, 0, bufferLen(follower.am))
+}
+
+func TestCluster_Replicate(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	lastSink := time.Now().Add(-time.Hour).Round(0)
+	replicas[0].am.AlertsBuffer["alert1"] = &sharedtools.Alert{
+		Fingerprint: "alert1",
+		Status:      sharedtools.Firing,
+		Labels:      map[string]string{"alertname": "test"},
+		EndsAt:      time.Now().Add(time.Hour),
+		LastSinkAt:  lastSink,
+	}
+	replicas[1].am.AlertsBuffer["stale"] = &sharedtools.Alert{Fingerprint: "stale", Status: sharedtools.Firing}
+	replicas[1].am.AlertsBuffer["fresh"] = &sharedtools.Alert{Fingerprint: "fresh", Status: sharedtools.Pending, LastReceiveAt: time.Now()}
+
+	// follower can't push its buffer to others
+	replicas[1].cluster.replicate()
+	assert.Equal(t, 1, bufferLen(replicas[0].am))
+
+	replicas[0].cluster.replicate()
+	for _, replica := range replicas[1:] {
+		replica.am.AlertBufferMutex.RLock()
+		alert, ok := replica.am.AlertsBuffer["alert1"]
+		replica.am.AlertBufferMutex.RUnlock()
+		require.True(t, ok)
+		assert.Equal(t, sharedtools.Firing, alert.Status)
+		assert.True(t, lastSink.Equal(alert.LastSinkAt))
+	}
+	assert.NotContains(t, replicas[1].am.AlertsBuffer, "stale")
+	assert.Contains(t, replicas[1].am.AlertsBuffer, "fresh")
+
+	// after the next snapshot alert which never got to leader is dropped
+	replicas[0].cluster.replicate()
+	assert.NotContains(t, replicas[1].am.AlertsBuffer, "fresh")
+}
+
+func TestCluster_Failover(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	replicas[0].server.Close()
+
+	for _, replica := range replicas[1:] {
+		replica.cluster.heartbeat()
+		assert.Equal(t, replicas[1].server.URL, replica.cluster.Leader())
+	}
+	assert.True(t, replicas[1].cluster.IsLeader())
+	assert.False(t, replicas[1].cluster.Status().Peers[replicas[0].server.URL])
+}
+
+func TestCluster_Join(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	replicas[0].am.AlertsBuffer["stale"] = &sharedtools.Alert{Fingerprint: "stale", Status: sharedtools.Firing}
+	replicas[1].am.AlertsBuffer["current"] = &sharedtools.Alert{Fingerprint: "current", Status: sharedtools.Firing}
+
+	// replica restarted with stale buffer doesn't lead until it pulls snapshot from leader
+	heartbeat(replicas[1], replicas[2])
+	assert.Equal(t, replicas[1].server.URL, replicas[2].cluster.Leader())
+	assert.False(t, replicas[0].cluster.IsLeader())
+	assert.True(t, replicas[1].cluster.IsLeader())
+	assert.Contains(t, replicas[2].am.AlertsBuffer, "current")
+
+	heartbeat(replicas...)
+	assert.True(t, replicas[0].cluster.IsLeader())
+	assert.Equal(t, replicas[0].server.URL, replicas[1].cluster.Leader())
+	assert.Contains(t, replicas[0].am.AlertsBuffer, "current")
+	assert.NotContains(t, replicas[0].am.AlertsBuffer, "stale")
+}
+
+func TestCluster_Quorum(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	replicas[0].server.Close()
+	replicas[1].server.Close()
+
+	heartbeat(replicas[2])
+	assert.Empty(t, replicas[2].cluster.Leader())
+	assert.False(t, replicas[2].cluster.IsLeader())
+
+	// replica can't sync with own buffer in minority
+	isolated := newTestReplicas(t, 3)
+	isolated[1].server.Close()
+	isolated[2].server.Close()
+	heartbeat(isolated[0])
+	assert.False(t, isolated[0].cluster.isSynced())
+	assert.False(t, isolated[0].cluster.IsLeader())
+}
+
+func TestCluster_ForwardResolved(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	replicas := newTestReplicas(t, 3)
+	heartbeat(replicas...)
+	endsAt := time.Now().Add(time.Hour)
+	for _, replica := range replicas {
+		replica.am.AlertsBuffer["alert1"] = &sharedtools.Alert{Fingerprint: "alert1", Status: sharedtools.Firing, Labels: map[string]string{}, EndsAt: endsAt}
+	}
+
+	replicas[2].am.resolveAlerts([]string{"alert1"})
+	assert.True(t, replicas[2].am.AlertsBuffer["alert1"].EndsAt.Before(endsAt))
+	assert.Eventually(t, func() bool {
+		replicas[0].am.AlertBufferMutex.RLock()
+		defer replicas[0].am.AlertBufferMutex.RUnlock()
+		return replicas[0].am.AlertsBuffer["alert1"].EndsAt.Before(endsAt)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, replicas[1].am.AlertsBuffer["alert1"].EndsAt.Equal(endsAt))
+}
+
+func TestNewClusterFromEnv(t *testing.T) {
+	am := &AlertManager{}
+	os.Setenv("AF_CLUSTER_PEERS", "")
+	cluster, err := NewClusterFromEnv(am)
+	assert.NoError(t, err)
+	assert.Nil(t, cluster)
+
+	os.Setenv("AF_CLUSTER_PEERS", "http://alertsforge-0:8080,http://alertsforge-1:8080/,http://alertsforge-2:8080")
+	defer os.Setenv("AF_CLUSTER_PEERS", "")
+	_, err = NewClusterFromEnv(am)
+	assert.Error(t, err)
+
+	os.Setenv("AF_CLUSTER_SELF", "http://alertsforge-1:8080")
+	defer os.Setenv("AF_CLUSTER_SELF", "")
+	os.Setenv("AF_CLUSTER_TOKEN", "secret")
+	defer os.Setenv("AF_CLUSTER_TOKEN", "")
+	cluster, err = NewClusterFromEnv(am)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http://alertsforge-0:8080", "http://alertsforge-1:8080", "http://alertsforge-2:8080"}, cluster.peers)
+	assert.Equal(t, cluster, am.cluster)
+	assert.False(t, cluster.IsLeader())
+
+	// 2 peers can't fail over, as the one left is not majority
+	os.Setenv("AF_CLUSTER_PEERS", "http://alertsforge-0:8080,http://alertsforge-1:8080")
+	_, err = NewClusterFromEnv(am)
+	assert.ErrorContains(t, err, "at least 3 peers")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	assert.NoError(t, cluster.send(http.MethodGet, server.URL+clusterStatusPath, nil, nil))
+}
@@ -0,0 +1,94 @@
+package alertsource
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mobalyticshq/alertsforge/alertsink"
+)
+
+// ReplayResult is response of dead letters replay for a sink
+type ReplayResult struct {
+	Replayed []string `json:"replayed"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// DeadLettersWebhook serves GET /deadLetters with undelivered payloads of sinks, sink query parameter selects one sink
+func (a *AlertManager) DeadLettersWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodGet {
+		asJson(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	queues, err := a.deadLetterQueues(r.URL.Query().Get("sink"))
+	if err != nil {
+		asJson(w, http.StatusNotFound, err.Error())
+		return
+	}
+	result := map[string][]alertsink.DeadLetter{}
+	for name, queue := range queues {
+		result[name] = queue.DeadLetters()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ReplayDeadLettersWebhook serves POST /deadLetters/replay, letters are selected by sink and id query parameters,
+// all letters of all sinks are replayed without them. Replay waits for buffer processing, so letter whose group
+// was delivered meanwhile is already removed and is not replayed over newer payload
+func (a *AlertManager) ReplayDeadLettersWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if a.cluster != nil && !a.cluster.IsLeader() {
+		asJson(w, http.StatusConflict, "alerts are sent by leader "+a.cluster.Leader())
+		return
+	}
+	queues, err := a.deadLetterQueues(r.URL.Query().Get("sink"))
+	if err != nil {
+		asJson(w, http.StatusNotFound, err.Error())
+		return
+	}
+	a.processingMutex.Lock()
+	defer a.processingMutex.Unlock()
+	result := map[string]ReplayResult{}
+	status := http.StatusOK
+	for name, queue := range queues {
+		replayed, errs := queue.ReplayDeadLetters(r.URL.Query()["id"])
+		sinkResult := ReplayResult{Replayed: replayed}
+		if sinkResult.Replayed == nil {
+			sinkResult.Replayed = []string{}
+		}
+		for _, err := range errs {
+			sinkResult.Errors = append(sinkResult.Errors, err.Error())
+			status = http.StatusBadGateway
+		}
+		result[name] = sinkResult
+	}
+	writeJSON(w, status, result)
+}
+
+// deadLetterQueues returns sinks with dead letter queue by name, all of them if name is empty
+func (a *AlertManager) deadLetterQueues(name string) (map[string]alertsink.DeadLetterQueue, error) {
+	queues := map[string]alertsink.DeadLetterQueue{}
+	if a.AlertRouter == nil {
+		return queues, nil
+	}
+	names := a.AlertRouter.SinkNames()
+	if name != "" {
+		names = []string{name}
+	}
+	for _, sinkName := range names {
+		sink, ok := a.AlertRouter.Sink(sinkName)
+		if !ok {
+			return nil, errors.New("unknown sink " + sinkName)
+		}
+		if queue, ok := sink.(alertsink.DeadLetterQueue); ok {
+			queues[sinkName] = queue
+		} else if name != "" {
+			return nil, errors.New("sink " + sinkName + " has no dead letter queue")
+		}
+	}
+	return queues, nil
+}
@@ -0,0 +1,100 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/alertsink"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockDeadLetterSink struct {
+	mockSink
+	letters []alertsink.DeadLetter
+	fail    bool
+	// onReplay is called while letters are replayed
+	onReplay func()
+}
+
+func (m *mockDeadLetterSink) DeadLetters() []alertsink.DeadLetter {
+	return m.letters
+}
+
+func (m *mockDeadLetterSink) ReplayDeadLetters(ids []string) (replayed []string, errs []error) {
+	if m.onReplay != nil {
+		m.onReplay()
+	}
+	if m.fail {
+		return nil, []error{errors.New("oncall is down")}
+	}
+	return ids, nil
+}
+
+func TestAlertManager_DeadLettersWebhook(t *testing.T) {
+	queue := &mockDeadLetterSink{letters: []alertsink.DeadLetter{{ID: "abc", Request: alertsink.OncallRequest{Title: "HighCPU"}}}}
+	router, err := alertsink.NewRouterWithSinks(config.Route{Sinks: []string{"oncall"}}, map[string]alertsink.SinkInterface{"oncall": queue, "mock": &mockSink{}})
+	require.NoError(t, err)
+	am := &AlertManager{AlertRouter: router}
+
+	w := httptest.NewRecorder()
+	am.DeadLettersWebhook(w, httptest.NewRequest(http.MethodGet, "/deadLetters", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	letters := map[string][]alertsink.DeadLetter{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &letters))
+	assert.Equal(t, map[string][]alertsink.DeadLetter{"oncall": queue.letters}, letters)
+
+	w = httptest.NewRecorder()
+	am.DeadLettersWebhook(w, httptest.NewRequest(http.MethodGet, "/deadLetters?sink=mock", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	am.ReplayDeadLettersWebhook(w, httptest.NewRequest(http.MethodGet, "/deadLetters/replay", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = httptest.NewRecorder()
+	am.ReplayDeadLettersWebhook(w, httptest.NewRequest(http.MethodPost, "/deadLetters/replay?sink=oncall&id=abc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"oncall":{"replayed":["abc"]}}`, w.Body.String())
+
+	queue.fail = true
+	w = httptest.NewRecorder()
+	am.ReplayDeadLettersWebhook(w, httptest.NewRequest(http.MethodPost, "/deadLetters/replay", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.JSONEq(t, `{"oncall":{"replayed":[],"errors":["oncall is down"]}}`, w.Body.String())
+}
+
+func TestAlertManager_ReplayDeadLettersWebhook_Processing(t *testing.T) {
+	queue := &mockDeadLetterSink{letters: []alertsink.DeadLetter{{ID: "abc", Request: alertsink.OncallRequest{Title: "HighCPU"}}}}
+	router, err := alertsink.NewRouterWithSinks(config.Route{Sinks: []string{"oncall"}}, map[string]alertsink.SinkInterface{"oncall": queue})
+	require.NoError(t, err)
+	am := &AlertManager{AlertRouter: router}
+
+	// buffer is not processed while letters are replayed
+	queue.onReplay = func() {
+		assert.False(t, am.processingMutex.TryLock())
+	}
+	w := httptest.NewRecorder()
+	am.ReplayDeadLettersWebhook(w, httptest.NewRequest(http.MethodPost, "/deadLetters/replay", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// replay waits for buffer processing
+	am.processingMutex.Lock()
+	replayed := make(chan struct{})
+	go func() {
+		am.ReplayDeadLettersWebhook(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/deadLetters/replay", nil))
+		close(replayed)
+	}()
+	select {
+	case <-replayed:
+		t.Fatal("replay didn't wait for buffer processing")
+	case <-time.After(50 * time.Millisecond):
+	}
+	am.processingMutex.Unlock()
+	<-replayed
+}
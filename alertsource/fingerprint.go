@@ -0,0 +1,113 @@
+package alertsource
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlclark/regexp2"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// uidLabel differs for every grafana alert instance, it's never part of fingerprint unless it's included explicitly
+const uidLabel = "uid"
+
+// defaultFingerprintPolicy is used when fingerprint is not configured
+var defaultFingerprintPolicy = config.FingerprintPolicy{Exclude: []string{uidLabel}}
+
+// fingerprint returns fingerprint of alert labels and description of the policy which was applied
+func (a *AlertManager) fingerprint(labels map[string]string) (string, string, []string) {
+	policy, name := a.fingerprintPolicy(labels)
+	fingerprintLabels := applyFingerprintPolicy(labels, policy, a.fingerprintRegexps[policy.ExcludeRegex])
+	names := maps.Keys(fingerprintLabels)
+	sort.Strings(names)
+	return sharedtools.LabelSetToFingerprint(fingerprintLabels), describeFingerprintPolicy(name, policy), names
+}
+
+// compileFingerprintRegexps compiles excludeRegex of global policy and rules once at start,
+// invalid regex is config error as otherwise alerts would silently get different fingerprints
+func compileFingerprintRegexps(fingerprint config.Fingerprint) (map[string]*regexp2.Regexp, error) {
+	regexps := map[string]*regexp2.Regexp{}
+	for _, policy := range append([]config.FingerprintPolicy{fingerprint.FingerprintPolicy}, fingerprint.Rules...) {
+		if policy.ExcludeRegex == "" || regexps[policy.ExcludeRegex] != nil {
+			continue
+		}
+		regExp, err := regexp2.Compile(policy.ExcludeRegex, 0)
+		if err != nil {
+			return nil, fmt.Errorf("can't compile fingerprint excludeRegex %s: %w", policy.ExcludeRegex, err)
+		}
+		regexps[policy.ExcludeRegex] = regExp
+	}
+	return regexps, nil
+}
+
+// fingerprintPolicy returns the first rule matching labels, global policy otherwise
+func (a *AlertManager) fingerprintPolicy(labels map[string]string) (config.FingerprintPolicy, string) {
+	fingerprint := a.runbooks.Fingerprint
+	for i, rule := range fingerprint.Rules {
+		if sharedtools.MatchLabels(labels, rule.LabelsSelector) {
+			return rule, fmt.Sprintf("rule %d", i)
+		}
+	}
+	global := fingerprint.FingerprintPolicy
+	if len(global.Include) == 0 && len(global.Exclude) == 0 && global.ExcludeRegex == "" {
+		return defaultFingerprintPolicy, "default"
+	}
+	return global, "global"
+}
+
+// applyFingerprintPolicy returns labels which are part of fingerprint, alertsforge_source is never part of it
+// and uid is part of it only if policy includes it, excludeRegex is compiled excludeRegex of the policy.
+// If policy leaves no labels all of them are used, otherwise every alert would get the same fingerprint
+func applyFingerprintPolicy(labels map[string]string, policy config.FingerprintPolicy, excludeRegex *regexp2.Regexp) map[string]string {
+	keepUID := slices.Contains(policy.Include, uidLabel)
+	result := map[string]string{}
+	for name, value := range labels {
+		if name == SourceLabel || (name == uidLabel && !keepUID) {
+			continue
+		}
+		if len(policy.Include) > 0 && !slices.Contains(policy.Include, name) {
+			continue
+		}
+		if slices.Contains(policy.Exclude, name) {
+			continue
+		}
+		if excludeRegex != nil {
+			if isMatch, _ := excludeRegex.MatchString(name); isMatch {
+				continue
+			}
+		}
+		result[name] = value
+	}
+
+	if len(result) == 0 && len(labels) > 0 {
+		zap.S().Warnf("fingerprint policy %s excludes all labels of alert %v, using all labels", describeFingerprintPolicy("", policy), labels)
+		result = sharedtools.CopyMap(labels)
+		delete(result, SourceLabel)
+		if !keepUID {
+			delete(result, uidLabel)
+		}
+	}
+	return result
+}
+
+func describeFingerprintPolicy(name string, policy config.FingerprintPolicy) string {
+	parts := []string{}
+	if name != "" {
+		parts = append(parts, name)
+	}
+	if len(policy.Include) > 0 {
+		parts = append(parts, "include="+strings.Join(policy.Include, ","))
+	}
+	if len(policy.Exclude) > 0 {
+		parts = append(parts, "exclude="+strings.Join(policy.Exclude, ","))
+	}
+	if policy.ExcludeRegex != "" {
+		parts = append(parts, "excludeRegex="+policy.ExcludeRegex)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,161 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyFingerprintPolicy(t *testing.T) {
+	labels := map[string]string{
+		"alertname": "KubePodCrashLooping",
+		"namespace": "prod",
+		"pod":       "api-123",
+		"instance":  "10.0.0.1",
+		"uid":       "abc",
+		SourceLabel: "alertmanager",
+	}
+
+	tests := []struct {
+		name     string
+		policy   config.FingerprintPolicy
+		expected map[string]string
+	}{
+		{
+			name:     "default",
+			policy:   defaultFingerprintPolicy,
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod", "pod": "api-123", "instance": "10.0.0.1"},
+		},
+		{
+			name:     "include",
+			policy:   config.FingerprintPolicy{Include: []string{"alertname", "namespace", SourceLabel}},
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod"},
+		},
+		{
+			name:     "exclude and regex",
+			policy:   config.FingerprintPolicy{Exclude: []string{"uid"}, ExcludeRegex: "^(pod|instance)$"},
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod"},
+		},
+		{
+			name:     "include and exclude",
+			policy:   config.FingerprintPolicy{Include: []string{"alertname", "pod"}, Exclude: []string{"pod"}},
+			expected: map[string]string{"alertname": "KubePodCrashLooping"},
+		},
+		{
+			name:     "uid is excluded by global policy without exclude",
+			policy:   config.FingerprintPolicy{ExcludeRegex: "^(pod|instance)$"},
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod"},
+		},
+		{
+			name:     "uid is included explicitly",
+			policy:   config.FingerprintPolicy{Include: []string{"alertname", "uid"}},
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "uid": "abc"},
+		},
+		{
+			name:     "nothing left",
+			policy:   config.FingerprintPolicy{Include: []string{"cluster"}},
+			expected: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod", "pod": "api-123", "instance": "10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regexps, err := compileFingerprintRegexps(config.Fingerprint{FingerprintPolicy: tt.policy})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, applyFingerprintPolicy(labels, tt.policy, regexps[tt.policy.ExcludeRegex]))
+		})
+	}
+}
+
+func TestCompileFingerprintRegexps(t *testing.T) {
+	regexps, err := compileFingerprintRegexps(config.Fingerprint{
+		FingerprintPolicy: config.FingerprintPolicy{ExcludeRegex: "^pod$"},
+		Rules:             []config.FingerprintPolicy{{ExcludeRegex: "^pod$"}, {ExcludeRegex: "^instance$"}, {}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, regexps, 2)
+
+	_, err = compileFingerprintRegexps(config.Fingerprint{Rules: []config.FingerprintPolicy{{ExcludeRegex: "(("}}})
+	assert.ErrorContains(t, err, "can't compile fingerprint excludeRegex ((")
+
+	_, err = NewAlertManager(&config.RunbooksConfig{Fingerprint: config.Fingerprint{FingerprintPolicy: config.FingerprintPolicy{ExcludeRegex: "(("}}})
+	assert.Error(t, err)
+}
+
+func TestAlertManager_fingerprintPolicy(t *testing.T) {
+	am := &AlertManager{runbooks: &config.RunbooksConfig{}}
+	policy, name := am.fingerprintPolicy(map[string]string{"alertname": "test"})
+	assert.Equal(t, defaultFingerprintPolicy, policy)
+	assert.Equal(t, "default", name)
+
+	am.runbooks.Fingerprint = config.Fingerprint{
+		FingerprintPolicy: config.FingerprintPolicy{Exclude: []string{"uid", "pod"}},
+		Rules: []config.FingerprintPolicy{
+			{LabelsSelector: map[string]string{"alertname": "KubePod.*"}, Include: []string{"alertname", "namespace"}},
+			{LabelsSelector: map[string]string{"alertname": "KubePodCrashLooping"}, Include: []string{"alertname"}},
+		},
+	}
+	policy, name = am.fingerprintPolicy(map[string]string{"alertname": "KubePodCrashLooping"})
+	assert.Equal(t, []string{"alertname", "namespace"}, policy.Include)
+	assert.Equal(t, "rule 0", name)
+
+	policy, name = am.fingerprintPolicy(map[string]string{"alertname": "HighCPU"})
+	assert.Equal(t, []string{"uid", "pod"}, policy.Exclude)
+	assert.Equal(t, "global", name)
+}
+
+func TestAlertManager_bufferAlertsFingerprint(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	fingerprint := config.Fingerprint{
+		Rules: []config.FingerprintPolicy{
+			{LabelsSelector: map[string]string{"alertname": "KubePod.*"}, ExcludeRegex: "^(pod|instance)$"},
+		},
+	}
+	regexps, err := compileFingerprintRegexps(fingerprint)
+	require.NoError(t, err)
+	am := &AlertManager{
+		runbooks:           &config.RunbooksConfig{Fingerprint: fingerprint},
+		AlertsBuffer:       map[string]*sharedtools.Alert{},
+		AlertBufferMutex:   sync.RWMutex{},
+		fingerprintRegexps: regexps,
+	}
+
+	fingerprints := am.bufferAlerts([]sharedtools.Alert{
+		{Labels: map[string]string{"alertname": "KubePodCrashLooping", "pod": "api-1"}, EndsAt: time.Now().Add(time.Hour)},
+		{Labels: map[string]string{"alertname": "KubePodCrashLooping", "pod": "api-2"}, EndsAt: time.Now().Add(time.Hour)},
+		{Labels: map[string]string{"alertname": "HighCPU", "pod": "api-1", "uid": "1"}, EndsAt: time.Now().Add(time.Hour)},
+		{Labels: map[string]string{"alertname": "HighCPU", "pod": "api-1", "uid": "2"}, EndsAt: time.Now().Add(time.Hour)},
+	})
+
+	assert.Equal(t, fingerprints[0], fingerprints[1])
+	assert.Equal(t, fingerprints[2], fingerprints[3])
+	assert.Len(t, am.AlertsBuffer, 2)
+
+	alert := am.AlertsBuffer[fingerprints[0]]
+	assert.Equal(t, sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "KubePodCrashLooping"}), alert.Fingerprint)
+	assert.Equal(t, "rule 0 excludeRegex=^(pod|instance)$", alert.FingerprintPolicy)
+	assert.Equal(t, []string{"alertname"}, alert.FingerprintLabels)
+	// fingerprint description is not sent to sinks
+	assert.Empty(t, alert.Annotations)
+
+	alert = am.AlertsBuffer[fingerprints[2]]
+	assert.Equal(t, "default exclude=uid", alert.FingerprintPolicy)
+	assert.Equal(t, []string{"alertname", "pod"}, alert.FingerprintLabels)
+	assert.Equal(t, alert.FingerprintLabels, NewBufferRecord(*alert).ToAlert().FingerprintLabels)
+
+	// buffer view shows how fingerprint was calculated
+	recorder := httptest.NewRecorder()
+	am.ShowAlertsBufferWebhook(recorder, httptest.NewRequest(http.MethodGet, "/showAlertBuffer", nil))
+	view := map[string]map[string]any{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &view))
+	assert.Equal(t, "default exclude=uid", view[fingerprints[2]]["fingerprintPolicy"])
+	assert.Equal(t, "HighCPU", view[fingerprints[2]]["labels"].(map[string]any)["alertname"])
+}
@@ -0,0 +1,75 @@
+package alertsource
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+)
+
+// Annotations added to alerts received from grafana contact point
+const (
+	silenceURLAnnotation   = "alertsforge_silence_url"
+	dashboardURLAnnotation = "alertsforge_dashboard_url"
+	panelURLAnnotation     = "alertsforge_panel_url"
+	imageURLAnnotation     = "alertsforge_image_url"
+	valueStringAnnotation  = "alertsforge_value_string"
+	valueAnnotationPrefix  = "alertsforge_value_"
+	grafanaOrgIDAnnotation = "alertsforge_grafana_org_id"
+	grafanaTitleAnnotation = "alertsforge_grafana_title"
+)
+
+type GrafanaAlert struct {
+	sharedtools.Alert
+	SilenceURL   string             `json:"silenceURL"`
+	DashboardURL string             `json:"dashboardURL"`
+	PanelURL     string             `json:"panelURL"`
+	ImageURL     string             `json:"imageURL"`
+	Values       map[string]float64 `json:"values"`
+	ValueString  string             `json:"valueString"`
+}
+
+// GrafanaWebhookMessage is the payload of grafana unified alerting webhook contact point,
+// it extends alertmanager webhook message with grafana specific fields
+type GrafanaWebhookMessage struct {
+	AlertmanagerWebhookMessage
+	Alerts  []GrafanaAlert `json:"alerts"`
+	OrgID   int64          `json:"orgId"`
+	Title   string         `json:"title"`
+	State   string         `json:"state"`
+	Message string         `json:"message"`
+}
+
+func (a *AlertManager) GrafanaWebhook(w http.ResponseWriter, r *http.Request) {
+	a.pushHandler(GrafanaSourceType, parseGrafanaWebhook)(w, r)
+}
+
+func (m GrafanaWebhookMessage) toAlerts(now time.Time) []sharedtools.Alert {
+	m.AlertmanagerWebhookMessage.Alerts = make([]sharedtools.Alert, 0, len(m.Alerts))
+	for _, grafanaAlert := range m.Alerts {
+		alert := grafanaAlert.Alert
+		annotations := map[string]string{
+			silenceURLAnnotation:   grafanaAlert.SilenceURL,
+			dashboardURLAnnotation: grafanaAlert.DashboardURL,
+			panelURLAnnotation:     grafanaAlert.PanelURL,
+			imageURLAnnotation:     grafanaAlert.ImageURL,
+			valueStringAnnotation:  grafanaAlert.ValueString,
+			grafanaOrgIDAnnotation: strconv.FormatInt(m.OrgID, 10),
+			grafanaTitleAnnotation: m.Title,
+		}
+		for name, value := range grafanaAlert.Values {
+			annotations[valueAnnotationPrefix+name] = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		if alert.Annotations == nil {
+			alert.Annotations = map[string]string{}
+		}
+		for key, value := range annotations {
+			if value != "" {
+				alert.Annotations[key] = value
+			}
+		}
+		m.AlertmanagerWebhookMessage.Alerts = append(m.AlertmanagerWebhookMessage.Alerts, alert)
+	}
+	return m.AlertmanagerWebhookMessage.toAlerts(now)
+}
@@ -0,0 +1,101 @@
+package alertsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var grafanaWebhookPayload = `{
+  "receiver": "alertsforge",
+  "status": "firing",
+  "orgId": 1,
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "High CPU", "grafana_folder": "infra"},
+      "annotations": {"description": "cpu is high"},
+      "startsAt": "2024-06-05T19:10:47Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "https://grafana/alerting/grafana/abc/view",
+      "fingerprint": "57c6d9296de2ad39",
+      "silenceURL": "https://grafana/alerting/silence/new",
+      "dashboardURL": "https://grafana/d/dashboard",
+      "panelURL": "https://grafana/d/dashboard?viewPanel=1",
+      "values": {"B": 22.5, "C": 1},
+      "valueString": "[ var='B' labels={} value=22.5 ]"
+    }
+  ],
+  "groupLabels": {"alertname": "High CPU"},
+  "commonLabels": {"alertname": "High CPU"},
+  "commonAnnotations": {},
+  "externalURL": "https://grafana/",
+  "version": "1",
+  "groupKey": "{}:{alertname=\"High CPU\"}",
+  "truncatedAlerts": 0,
+  "title": "[FIRING:1] High CPU",
+  "state": "alerting",
+  "message": "**Firing**"
+}`
+
+func TestAlertManager_GrafanaWebhook(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+
+	am := &AlertManager{
+		runbooks: &config.RunbooksConfig{
+			Silences: []config.Silence{
+				{LabelsSelector: map[string]string{"grafana_folder": "muted"}},
+			},
+		},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/alertWebhook/grafana", strings.NewReader(grafanaWebhookPayload))
+	am.GrafanaWebhook(writer, request)
+
+	assert.Equal(t, http.StatusOK, writer.Code)
+	require.Len(t, am.AlertsBuffer, 1)
+
+	alert := am.AlertsBuffer[sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "High CPU", "grafana_folder": "infra"})]
+	require.NotNil(t, alert)
+	assert.Equal(t, sharedtools.Pending, alert.Status)
+	assert.Equal(t, "cpu is high", alert.Annotations["description"])
+	assert.Equal(t, "https://grafana/alerting/silence/new", alert.Annotations[silenceURLAnnotation])
+	assert.Equal(t, "https://grafana/d/dashboard", alert.Annotations[dashboardURLAnnotation])
+	assert.Equal(t, "https://grafana/d/dashboard?viewPanel=1", alert.Annotations[panelURLAnnotation])
+	assert.Equal(t, "[ var='B' labels={} value=22.5 ]", alert.Annotations[valueStringAnnotation])
+	assert.Equal(t, "22.5", alert.Annotations[valueAnnotationPrefix+"B"])
+	assert.Equal(t, "1", alert.Annotations[valueAnnotationPrefix+"C"])
+	assert.Equal(t, "https://grafana/", alert.Annotations[externalURLAnnotation])
+	assert.Equal(t, "[FIRING:1] High CPU", alert.Annotations[grafanaTitleAnnotation])
+	assert.NotContains(t, alert.Annotations, imageURLAnnotation)
+}
+
+func TestAlertManager_GrafanaWebhook_Silenced(t *testing.T) {
+	am := &AlertManager{
+		runbooks: &config.RunbooksConfig{
+			Silences: []config.Silence{
+				{LabelsSelector: map[string]string{"grafana_folder": "infra"}},
+			},
+		},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/alertWebhook/grafana", strings.NewReader(grafanaWebhookPayload))
+	am.GrafanaWebhook(writer, request)
+
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Empty(t, am.AlertsBuffer)
+}
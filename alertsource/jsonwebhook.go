@@ -0,0 +1,159 @@
+package alertsource
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+// JSONTemplate is the data available in templates of json source mapping
+type JSONTemplate struct {
+	Alert any
+	Body  any
+}
+
+func (a *AlertManager) JSONWebhook(source config.JSONSource) http.HandlerFunc {
+	return a.pushHandler(source.Name, func(body []byte) ([]sharedtools.Alert, error) {
+		return mapJSONAlerts(source, body, time.Now())
+	})
+}
+
+func mapJSONAlerts(source config.JSONSource, body []byte, now time.Time) ([]sharedtools.Alert, error) {
+	parsedBody, err := unmarshalJSONNumbers(body)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []any{}
+	rawItems := body
+	if source.AlertsKey != "" {
+		value, _, _, err := jsonparser.Get(body, strings.Split(source.AlertsKey, ".")...)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s from body: %w", source.AlertsKey, err)
+		}
+		rawItems = value
+	}
+	parsedItems, err := unmarshalJSONNumbers(rawItems)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := parsedItems.([]any); ok {
+		items = append(items, list...)
+	} else {
+		items = append(items, parsedItems)
+	}
+
+	alerts := []sharedtools.Alert{}
+	for _, item := range items {
+		alert, err := mapJSONAlert(source, JSONTemplate{Alert: item, Body: parsedBody}, now)
+		if err != nil {
+			zap.S().Warnf("skipping alert from json source %s: %s", source.Name, err)
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	if len(alerts) == 0 && len(items) > 0 {
+		return nil, errors.New("no alerts could be mapped from request")
+	}
+	return alerts, nil
+}
+
+func mapJSONAlert(source config.JSONSource, variables JSONTemplate, now time.Time) (sharedtools.Alert, error) {
+	alert := sharedtools.Alert{
+		Labels:      templateMap(source.Labels, variables),
+		Annotations: templateMap(source.Annotations, variables),
+		Status:      sharedtools.Firing,
+		StartsAt:    now,
+	}
+	if len(alert.Labels) == 0 {
+		return alert, errors.New("alert has no labels")
+	}
+
+	if source.Status != "" {
+		status, err := sharedtools.TemplateString(source.Status, variables)
+		if err != nil {
+			return alert, err
+		}
+		if strings.TrimSpace(status) == sharedtools.Resolved {
+			alert.Status = sharedtools.Resolved
+		}
+	}
+
+	if source.StartsAt != "" {
+		startsAt, err := templateTime(source.StartsAt, variables)
+		if err != nil {
+			return alert, err
+		}
+		if !startsAt.IsZero() {
+			alert.StartsAt = startsAt
+		}
+	}
+
+	var endsAt time.Time
+	if source.EndsAt != "" {
+		var err error
+		if endsAt, err = templateTime(source.EndsAt, variables); err != nil {
+			return alert, err
+		}
+	}
+	alert.EndsAt = webhookAlertEndsAt(alert.Status, endsAt, now)
+	return alert, nil
+}
+
+// unmarshalJSONNumbers keeps numbers as json.Number so ids and timestamps are not rendered in exponent form
+func unmarshalJSONNumbers(data []byte) (any, error) {
+	var result any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// templateMap templates every value of the map, empty values are dropped so optional fields can be mapped
+func templateMap(templates map[string]string, variables any) map[string]string {
+	result := map[string]string{}
+	for key, tpl := range templates {
+		value, err := sharedtools.TemplateString(tpl, variables)
+		if err != nil {
+			zap.S().Warnf("can't template %s: %s", key, err)
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value != "" && value != "<no value>" {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// templateTime accepts RFC3339 time or unix timestamp in seconds, empty result is zero time
+func templateTime(tpl string, variables any) (time.Time, error) {
+	value, err := sharedtools.TemplateString(tpl, variables)
+	if err != nil {
+		return time.Time{}, err
+	}
+	value = strings.TrimSpace(value)
+	if value == "" || value == "<no value>" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("can't parse time %q", value)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
@@ -0,0 +1,105 @@
+package alertsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ciSource = config.JSONSource{
+	Name:      "ci",
+	Path:      "/alertWebhook/ci",
+	AlertsKey: "data.failures",
+	Labels: map[string]string{
+		"alertname": "CIPipelineFailed",
+		"pipeline":  "{{ .Alert.pipeline }}",
+		"job_id":    "{{ .Alert.id }}",
+		"runner":    "{{ .Alert.runner }}",
+	},
+	Annotations: map[string]string{
+		"description": "pipeline {{ .Alert.pipeline }} failed on {{ .Body.data.branch }}",
+	},
+	StartsAt: "{{ .Alert.failed_at }}",
+	EndsAt:   "{{ .Alert.fixed_at }}",
+	Status:   "{{ .Alert.state }}",
+}
+
+func TestMapJSONAlerts(t *testing.T) {
+	now := time.Now()
+	body := `{"data":{"branch":"main","failures":[
+		{"id":12345678,"pipeline":"deploy","failed_at":"2024-06-05T19:10:47Z","state":"failed"},
+		{"id":2,"pipeline":"test","failed_at":1717614647,"fixed_at":1717614700,"state":"resolved"},
+		{"id":3}
+	]}}`
+
+	alerts, err := mapJSONAlerts(ciSource, []byte(body), now)
+	require.NoError(t, err)
+	require.Len(t, alerts, 3)
+
+	assert.Equal(t, map[string]string{"alertname": "CIPipelineFailed", "pipeline": "deploy", "job_id": "12345678"}, alerts[0].Labels)
+	assert.Equal(t, "pipeline deploy failed on main", alerts[0].Annotations["description"])
+	assert.Equal(t, sharedtools.Firing, alerts[0].Status)
+	assert.Equal(t, time.Date(2024, 6, 5, 19, 10, 47, 0, time.UTC), alerts[0].StartsAt.UTC())
+	assert.True(t, alerts[0].EndsAt.After(now))
+
+	assert.Equal(t, sharedtools.Resolved, alerts[1].Status)
+	assert.Equal(t, time.Unix(1717614647, 0), alerts[1].StartsAt)
+	assert.Equal(t, time.Unix(1717614700, 0), alerts[1].EndsAt)
+
+	assert.Equal(t, now, alerts[2].StartsAt)
+}
+
+func TestMapJSONAlerts_SingleObject(t *testing.T) {
+	source := config.JSONSource{
+		Name:   "cron",
+		Labels: map[string]string{"alertname": "CronFailed", "job": "{{ .Alert.job }}"},
+	}
+
+	alerts, err := mapJSONAlerts(source, []byte(`{"job":"backup"}`), time.Now())
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "backup", alerts[0].Labels["job"])
+}
+
+func TestMapJSONAlerts_Errors(t *testing.T) {
+	_, err := mapJSONAlerts(ciSource, []byte(`{"data":`), time.Now())
+	assert.Error(t, err)
+
+	_, err = mapJSONAlerts(ciSource, []byte(`{"other":[]}`), time.Now())
+	assert.Error(t, err)
+
+	source := config.JSONSource{Labels: map[string]string{"job": "{{ .Alert.job }}"}}
+	_, err = mapJSONAlerts(source, []byte(`[{"name":"backup"}]`), time.Now())
+	assert.Error(t, err)
+}
+
+func TestAlertManager_JSONWebhook(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, ciSource.Path, strings.NewReader(`{"data":{"branch":"main","failures":[{"id":1,"pipeline":"deploy"}]}}`))
+	am.JSONWebhook(ciSource)(writer, request)
+
+	assert.Equal(t, http.StatusOK, writer.Code)
+	assert.Len(t, am.AlertsBuffer, 1)
+
+	writer = httptest.NewRecorder()
+	request = httptest.NewRequest(http.MethodPost, ciSource.Path, strings.NewReader(`not json`))
+	am.JSONWebhook(ciSource)(writer, request)
+
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+}
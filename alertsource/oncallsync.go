@@ -0,0 +1,138 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/mobalyticshq/alertsforge/alertsink"
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+)
+
+const oncallWebhookPath = "/oncall/webhook"
+
+// oncallWebhookPayload is the part of oncall outgoing webhook data used to sync alert group state
+type oncallWebhookPayload struct {
+	Event struct {
+		Type string `json:"type"`
+	} `json:"event"`
+	AlertGroup struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+		State string `json:"state"`
+	} `json:"alert_group"`
+}
+
+// oncallEventStates maps oncall outgoing webhook event types to alert group states
+var oncallEventStates = map[string]string{
+	"acknowledge":   oncall.StateAcknowledged,
+	"resolve":       oncall.StateResolved,
+	"silence":       oncall.StateSilenced,
+	"unacknowledge": oncall.StateNew,
+	"unresolve":     oncall.StateNew,
+	"unsilence":     oncall.StateNew,
+}
+
+// OncallWebhook receives oncall outgoing webhook, so acknowledge, resolve and silence of alert group are applied
+// right away instead of waiting for state refresh of oncall sink. In HA mode follower forwards webhook to leader,
+// as only leader's sinks send alert groups
+func (a *AlertManager) OncallWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		asJson(w, http.StatusBadRequest, "can't read oncall webhook: "+err.Error())
+		return
+	}
+	if a.cluster != nil && !a.cluster.IsLeader() {
+		if r.Header.Get(forwardedHeader) != "" {
+			asJson(w, http.StatusConflict, "alerts are sent by leader "+a.cluster.Leader())
+			return
+		}
+		leader, err := a.cluster.proxyToLeader(oncallWebhookPath, body)
+		if err != nil {
+			zap.S().Errorf("can't forward oncall webhook to leader %s: %s", leader, err)
+			asJson(w, http.StatusServiceUnavailable, "can't forward oncall webhook to leader: "+err.Error())
+			return
+		}
+		asJson(w, http.StatusOK, "forwarded to leader "+leader)
+		return
+	}
+	payload := oncallWebhookPayload{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		asJson(w, http.StatusBadRequest, "can't parse oncall webhook: "+err.Error())
+		return
+	}
+	state, ok := oncallEventStates[payload.Event.Type]
+	if !ok {
+		state = payload.AlertGroup.State
+	}
+	if state == "firing" {
+		state = oncall.StateNew
+	}
+	if payload.AlertGroup.Title == "" || state == "" {
+		asJson(w, http.StatusBadRequest, "alert_group title and state or event type are required")
+		return
+	}
+
+	updated := false
+	if a.AlertRouter != nil {
+		for _, name := range a.AlertRouter.SinkNames() {
+			sink, _ := a.AlertRouter.Sink(name)
+			if receiver, ok := sink.(alertsink.AlertgroupStateReceiver); ok {
+				updated = receiver.SetAlertgroupState(payload.AlertGroup.ID, payload.AlertGroup.Title, state) || updated
+			}
+		}
+	}
+	if !updated {
+		zap.S().Infof("oncall alertgroup %s %s is not sent by alertsforge, ignoring it", payload.AlertGroup.ID, payload.AlertGroup.Title)
+		asJson(w, http.StatusOK, "ignored")
+		return
+	}
+	a.syncAlertStates()
+	asJson(w, http.StatusOK, "success")
+}
+
+// syncAlertStates marks buffered alerts with states reported by sinks, SilencedBy is set for alerts
+// which are silenced locally and are not resinked to any sink
+func (a *AlertManager) syncAlertStates() {
+	if a.AlertRouter == nil {
+		return
+	}
+	states := map[string]alertsink.AlertState{}
+	silencedBy := map[string]string{}
+	for _, name := range a.AlertRouter.SinkNames() {
+		sink, _ := a.AlertRouter.Sink(name)
+		reporter, ok := sink.(alertsink.AlertStateReporter)
+		if !ok {
+			continue
+		}
+		for fingerprint, state := range reporter.SyncAlertStates() {
+			states[fingerprint] = state
+			if state.Silenced {
+				silencedBy[fingerprint] = name
+			}
+		}
+	}
+
+	a.AlertBufferMutex.Lock()
+	defer a.AlertBufferMutex.Unlock()
+	for fingerprint, alert := range a.AlertsBuffer {
+		if alert.SinkState != states[fingerprint].State || alert.SilencedBy != silencedBy[fingerprint] {
+			alert.SinkState = states[fingerprint].State
+			alert.SilencedBy = silencedBy[fingerprint]
+			zap.S().Infof("alert %s state in sinks is %q, silenced by %q", fingerprint, states[fingerprint].State, silencedBy[fingerprint])
+			a.persistAlert(alert)
+		}
+	}
+}
+
+// locallySilenced is true for alert silenced in sink, it's not resinked to any sink
+func locallySilenced(alert sharedtools.Alert) bool {
+	return alert.SilencedBy != ""
+}
@@ -0,0 +1,154 @@
+package alertsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/alertsink"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockStateSink keeps states of alert groups by title, alert "alert1" belongs to group "HighCPU"
+type mockStateSink struct {
+	sent   int
+	states map[string]string
+	silent bool
+}
+
+func (m *mockStateSink) SendAlerts(alerts []sharedtools.Alert) (accepted []string, resolved []string, errors []error) {
+	m.sent += len(alerts)
+	accepted, resolved = []string{}, []string{}
+	for _, alert := range alerts {
+		accepted = append(accepted, alert.Fingerprint)
+	}
+	return
+}
+
+func (m *mockStateSink) SetAlertgroupState(id, title, state string) bool {
+	if title != "HighCPU" {
+		return false
+	}
+	m.states[title] = state
+	return true
+}
+
+func (m *mockStateSink) SyncAlertStates() map[string]alertsink.AlertState {
+	state := m.states["HighCPU"]
+	if state == "" || state == oncall.StateNew {
+		return nil
+	}
+	return map[string]alertsink.AlertState{"alert1": {State: state, Silenced: m.silent && state == oncall.StateSilenced}}
+}
+
+func TestAlertManager_OncallWebhook(t *testing.T) {
+	t.Setenv("AF_RESINK_TIME", "1m")
+	oncallSink := &mockStateSink{states: map[string]string{}, silent: true}
+	other := &mockStateSink{states: map[string]string{}}
+	router, err := alertsink.NewRouterWithSinks(config.Route{Sinks: []string{"oncall", "slack"}}, map[string]alertsink.SinkInterface{"oncall": oncallSink, "slack": other})
+	require.NoError(t, err)
+	am := &AlertManager{
+		AlertsBuffer: map[string]*sharedtools.Alert{
+			"alert1": {
+				Fingerprint: "alert1",
+				Status:      sharedtools.Firing,
+				Labels:      map[string]string{"alertname": "HighCPU"},
+				StartsAt:    time.Now().Add(-time.Hour),
+				EndsAt:      time.Now().Add(time.Hour),
+				LastSinkAt:  time.Now().Add(-time.Hour),
+				AcceptedBy:  []string{"oncall", "slack"},
+			},
+		},
+		AlertRouter: router,
+		runbooks:    &config.RunbooksConfig{},
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		am.OncallWebhook(w, httptest.NewRequest(http.MethodPost, "/oncall/webhook", strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"event":{"type":"acknowledge"}}`).Code)
+	w := post(`{"event":{"type":"resolve"},"alert_group":{"id":"1","title":"Unknown"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "ignored")
+
+	// acknowledged alert is marked and still resinked to sinks, oncall sink skips it by itself
+	require.Equal(t, http.StatusOK, post(`{"event":{"type":"acknowledge"},"alert_group":{"id":"1","title":"HighCPU","state":"firing"}}`).Code)
+	assert.Equal(t, oncall.StateAcknowledged, am.AlertsBuffer["alert1"].SinkState)
+	assert.Empty(t, am.AlertsBuffer["alert1"].Annotations)
+	am.ProcessAlertsBuffer()
+	assert.Equal(t, 1, oncallSink.sent)
+
+	// locally silenced alert is not resinked to any sink
+	require.Equal(t, http.StatusOK, post(`{"event":{"type":"silence"},"alert_group":{"id":"1","title":"HighCPU"}}`).Code)
+	assert.Equal(t, "oncall", am.AlertsBuffer["alert1"].SilencedBy)
+	restored := NewBufferRecord(*am.AlertsBuffer["alert1"]).ToAlert()
+	assert.Equal(t, oncall.StateSilenced, restored.SinkState)
+	assert.Equal(t, "oncall", restored.SilencedBy)
+	recorder := httptest.NewRecorder()
+	am.ShowAlertsBufferWebhook(recorder, httptest.NewRequest(http.MethodGet, "/showAlertBuffer", nil))
+	assert.Contains(t, recorder.Body.String(), `"silencedBy": "oncall"`)
+	am.AlertsBuffer["alert1"].LastSinkAt = time.Now().Add(-time.Hour)
+	am.ProcessAlertsBuffer()
+	assert.Equal(t, 1, oncallSink.sent)
+	assert.Equal(t, 1, other.sent)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/alerts?silenced=false", nil)
+	alerts, err := am.filterAlerts(r)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+	alerts, err = am.filterAlerts(httptest.NewRequest(http.MethodGet, "/api/v2/alerts", nil))
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, suppressedState, alerts[0].Status.State)
+	assert.Equal(t, []string{"oncall"}, alerts[0].Status.SilencedBy)
+
+	// alert group state from webhook is used without event type
+	require.Equal(t, http.StatusOK, post(`{"alert_group":{"id":"1","title":"HighCPU","state":"firing"}}`).Code)
+	assert.Empty(t, am.AlertsBuffer["alert1"].SinkState)
+	assert.Empty(t, am.AlertsBuffer["alert1"].SilencedBy)
+	am.ProcessAlertsBuffer()
+	assert.Equal(t, 2, oncallSink.sent)
+	assert.Equal(t, 2, other.sent)
+}
+
+func TestAlertManager_OncallWebhook_ForwardToLeader(t *testing.T) {
+	replicas := newTestReplicas(t, 3)
+	for _, replica := range replicas {
+		replica.mux.HandleFunc(oncallWebhookPath, replica.am.OncallWebhook)
+	}
+	oncallSink := &mockStateSink{states: map[string]string{}}
+	router, err := alertsink.NewRouterWithSinks(config.Route{Sinks: []string{"oncall"}}, map[string]alertsink.SinkInterface{"oncall": oncallSink})
+	require.NoError(t, err)
+	replicas[0].am.AlertRouter = router
+	heartbeat(replicas...)
+
+	body := `{"event":{"type":"acknowledge"},"alert_group":{"id":"1","title":"HighCPU"}}`
+	w := httptest.NewRecorder()
+	replicas[1].am.OncallWebhook(w, httptest.NewRequest(http.MethodPost, oncallWebhookPath, strings.NewReader(body)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), replicas[0].server.URL)
+	assert.Equal(t, oncall.StateAcknowledged, oncallSink.states["HighCPU"])
+
+	// forwarded webhook is not forwarded again
+	r := httptest.NewRequest(http.MethodPost, oncallWebhookPath, strings.NewReader(body))
+	r.Header.Set(forwardedHeader, replicas[2].server.URL)
+	w = httptest.NewRecorder()
+	replicas[1].am.OncallWebhook(w, r)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// webhook is not lost silently without leader
+	replicas[0].server.Close()
+	replicas[2].server.Close()
+	replicas[1].cluster.heartbeat()
+	w = httptest.NewRecorder()
+	replicas[1].am.OncallWebhook(w, httptest.NewRequest(http.MethodPost, oncallWebhookPath, strings.NewReader(body)))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
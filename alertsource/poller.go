@@ -0,0 +1,198 @@
+package alertsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/maps"
+)
+
+// Poller types
+const (
+	alertmanagerPollerType = "alertmanager"
+	vmalertPollerType      = "vmalert"
+)
+
+const defaultPollInterval = time.Minute
+
+type alertmanagerGettableAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Status       struct {
+		State string `json:"state"`
+	} `json:"status"`
+}
+
+type vmalertAlertsResponse struct {
+	Data struct {
+		Alerts []struct {
+			Name        string            `json:"name"`
+			State       string            `json:"state"`
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+			ActiveAt    time.Time         `json:"activeAt"`
+			Source      string            `json:"source"`
+		} `json:"alerts"`
+	} `json:"data"`
+}
+
+type alertsPoller struct {
+	am       AlertManagerInterface
+	config   config.Poller
+	interval time.Duration
+	cli      sharedtools.HTTPInterface
+	// fingerprints returned by previous poll, alerts missing in the next poll are resolved
+	seen map[string]bool
+}
+
+func NewAlertsPoller(am AlertManagerInterface, poller config.Poller) (*alertsPoller, error) {
+	if poller.Type != alertmanagerPollerType && poller.Type != vmalertPollerType {
+		return nil, fmt.Errorf("unknown type '%s' of poller %s", poller.Type, poller.Name)
+	}
+	if poller.URL == "" {
+		return nil, fmt.Errorf("poller %s has no url", poller.Name)
+	}
+	interval := defaultPollInterval
+	if poller.Interval != "" {
+		parsed, err := time.ParseDuration(poller.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse interval of poller %s: %w", poller.Name, err)
+		}
+		interval = parsed
+	}
+	return &alertsPoller{am: am, config: poller, interval: interval, cli: &sharedtools.HTTPClient{}, seen: map[string]bool{}}, nil
+}
+
+func (p *alertsPoller) Run() {
+	p.restoreSeen()
+	p.poll()
+	for range time.Tick(p.interval) {
+		p.poll()
+	}
+}
+
+// restoreSeen fills seen with buffered alerts of this poller, so alerts which disappeared
+// while alertsforge was down are resolved by the first poll
+func (p *alertsPoller) restoreSeen() {
+	for _, record := range p.am.bufferSnapshot() {
+		if record.Alert != nil && record.Alert.Status != sharedtools.Resolved && record.Alert.Labels[SourceLabel] == p.config.Name {
+			p.seen[record.Fingerprint] = true
+		}
+	}
+	if len(p.seen) > 0 {
+		zap.S().Infof("restored %d alerts of poller %s from buffer", len(p.seen), p.config.Name)
+	}
+}
+
+func (p *alertsPoller) poll() {
+	log := zap.S()
+	alerts, err := p.fetchAlerts()
+	if err != nil {
+		log.Errorf("can't poll alerts from %s: %s", p.config.Name, err)
+		return
+	}
+
+	received := p.am.receiveAlerts(tagSource(alerts, p.config.Name))
+	current := map[string]bool{}
+	for _, fingerprint := range received {
+		current[fingerprint] = true
+	}
+
+	missing := []string{}
+	for fingerprint := range p.seen {
+		if !current[fingerprint] {
+			missing = append(missing, fingerprint)
+		}
+	}
+	if len(missing) > 0 {
+		log.Infof("%d alerts disappeared from %s, resolving them", len(missing), p.config.Name)
+		p.am.resolveAlerts(missing)
+	}
+	p.seen = current
+	log.Debugf("polled %d alerts from %s", len(alerts), p.config.Name)
+}
+
+func (p *alertsPoller) fetchAlerts() ([]sharedtools.Alert, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	baseURL := strings.TrimSuffix(p.config.URL, "/")
+	path := "/api/v2/alerts?active=true&silenced=false&inhibited=false"
+	if p.config.Type == vmalertPollerType {
+		path = "/api/v1/alerts"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := p.cli.FetchResponse(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.Type == vmalertPollerType {
+		return parseVmalertAlerts(resBody, time.Now())
+	}
+	return parseAlertmanagerAlerts(resBody, time.Now())
+}
+
+func parseAlertmanagerAlerts(body []byte, now time.Time) ([]sharedtools.Alert, error) {
+	gettableAlerts := []alertmanagerGettableAlert{}
+	if err := json.Unmarshal(body, &gettableAlerts); err != nil {
+		return nil, err
+	}
+	alerts := []sharedtools.Alert{}
+	for _, gettable := range gettableAlerts {
+		if gettable.Status.State != "" && gettable.Status.State != "active" {
+			continue
+		}
+		alerts = append(alerts, sharedtools.Alert{
+			Status:       sharedtools.Firing,
+			Labels:       gettable.Labels,
+			Annotations:  gettable.Annotations,
+			StartsAt:     gettable.StartsAt,
+			EndsAt:       webhookAlertEndsAt(sharedtools.Firing, gettable.EndsAt, now),
+			GeneratorURL: gettable.GeneratorURL,
+		})
+	}
+	return alerts, nil
+}
+
+func parseVmalertAlerts(body []byte, now time.Time) ([]sharedtools.Alert, error) {
+	response := vmalertAlertsResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	alerts := []sharedtools.Alert{}
+	for _, vmalert := range response.Data.Alerts {
+		if vmalert.State != sharedtools.Firing {
+			continue
+		}
+		labels := maps.Clone(vmalert.Labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		if _, ok := labels["alertname"]; !ok {
+			labels["alertname"] = vmalert.Name
+		}
+		alerts = append(alerts, sharedtools.Alert{
+			Status:       sharedtools.Firing,
+			Labels:       labels,
+			Annotations:  vmalert.Annotations,
+			StartsAt:     vmalert.ActiveAt,
+			EndsAt:       webhookAlertEndsAt(sharedtools.Firing, time.Time{}, now),
+			GeneratorURL: vmalert.Source,
+		})
+	}
+	return alerts, nil
+}
@@ -0,0 +1,141 @@
+package alertsource
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAlertsPoller(t *testing.T) {
+	am := &AlertManager{}
+	_, err := NewAlertsPoller(am, config.Poller{Name: "test", Type: "unknown", URL: "http://localhost"})
+	assert.Error(t, err)
+	_, err = NewAlertsPoller(am, config.Poller{Name: "test", Type: alertmanagerPollerType})
+	assert.Error(t, err)
+	_, err = NewAlertsPoller(am, config.Poller{Name: "test", Type: vmalertPollerType, URL: "http://localhost", Interval: "1mm"})
+	assert.Error(t, err)
+
+	poller, err := NewAlertsPoller(am, config.Poller{Name: "test", Type: vmalertPollerType, URL: "http://localhost"})
+	require.NoError(t, err)
+	assert.Equal(t, defaultPollInterval, poller.interval)
+}
+
+func TestAlertsPoller_Alertmanager(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	endsAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	responses := []string{
+		fmt.Sprintf(`[
+			{"labels":{"alertname":"first"},"annotations":{},"startsAt":"2024-06-05T19:10:47Z","endsAt":"%s","status":{"state":"active"}},
+			{"labels":{"alertname":"second"},"annotations":{},"startsAt":"2024-06-05T19:10:47Z","endsAt":"%s","status":{"state":"active"}},
+			{"labels":{"alertname":"silenced"},"annotations":{},"startsAt":"2024-06-05T19:10:47Z","endsAt":"%s","status":{"state":"suppressed"}}
+		]`, endsAt, endsAt, endsAt),
+		fmt.Sprintf(`[
+			{"labels":{"alertname":"first"},"annotations":{},"startsAt":"2024-06-05T19:10:47Z","endsAt":"%s","status":{"state":"active"}}
+		]`, endsAt),
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/alerts", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("active"))
+		fmt.Fprint(w, responses[requests])
+		requests++
+	}))
+	defer server.Close()
+
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+	poller, err := NewAlertsPoller(am, config.Poller{Name: "am", Type: alertmanagerPollerType, URL: server.URL + "/"})
+	require.NoError(t, err)
+
+	first := sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "first"})
+	second := sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "second"})
+
+	poller.poll()
+	require.Len(t, am.AlertsBuffer, 2)
+	assert.Equal(t, sharedtools.Pending, am.AlertsBuffer[first].Status)
+	assert.True(t, am.AlertsBuffer[second].EndsAt.After(time.Now()))
+
+	poller.poll()
+	require.Len(t, am.AlertsBuffer, 2)
+	assert.True(t, am.AlertsBuffer[first].EndsAt.After(time.Now()))
+	assert.False(t, am.AlertsBuffer[second].EndsAt.After(time.Now()))
+	assert.Equal(t, map[string]bool{first: true}, poller.seen)
+}
+
+func TestAlertsPoller_FailedPoll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, "bad gateway")
+	}))
+	defer server.Close()
+
+	am := &AlertManager{
+		runbooks: &config.RunbooksConfig{},
+		AlertsBuffer: map[string]*sharedtools.Alert{
+			"alert1": {Fingerprint: "alert1", EndsAt: time.Now().Add(time.Hour)},
+		},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+	poller, err := NewAlertsPoller(am, config.Poller{Name: "am", Type: alertmanagerPollerType, URL: server.URL})
+	require.NoError(t, err)
+	poller.seen = map[string]bool{"alert1": true}
+
+	poller.poll()
+	assert.True(t, am.AlertsBuffer["alert1"].EndsAt.After(time.Now()))
+	assert.Equal(t, map[string]bool{"alert1": true}, poller.seen)
+}
+
+func TestAlertsPoller_RestoreSeen(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	am := &AlertManager{
+		runbooks: &config.RunbooksConfig{},
+		AlertsBuffer: map[string]*sharedtools.Alert{
+			"polled":   {Fingerprint: "polled", Status: sharedtools.Firing, Labels: map[string]string{SourceLabel: "am"}, EndsAt: time.Now().Add(time.Hour)},
+			"other":    {Fingerprint: "other", Status: sharedtools.Firing, Labels: map[string]string{SourceLabel: "grafana"}, EndsAt: time.Now().Add(time.Hour)},
+			"resolved": {Fingerprint: "resolved", Status: sharedtools.Resolved, Labels: map[string]string{SourceLabel: "am"}},
+		},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+	poller, err := NewAlertsPoller(am, config.Poller{Name: "am", Type: alertmanagerPollerType, URL: server.URL})
+	require.NoError(t, err)
+
+	// alert disappeared from alertmanager while alertsforge was down
+	poller.restoreSeen()
+	assert.Equal(t, map[string]bool{"polled": true}, poller.seen)
+	poller.poll()
+	assert.False(t, am.AlertsBuffer["polled"].EndsAt.After(time.Now()))
+	assert.True(t, am.AlertsBuffer["other"].EndsAt.After(time.Now()))
+}
+
+func TestParseVmalertAlerts(t *testing.T) {
+	now := time.Now()
+	body := `{"status":"success","data":{"alerts":[
+		{"name":"HighLatency","state":"firing","labels":{"service":"api"},"annotations":{"summary":"slow"},
+		 "activeAt":"2024-06-05T19:10:47Z","source":"http://vmalert/rule"},
+		{"name":"Pending","state":"pending","labels":{"alertname":"Pending"},"annotations":{},"activeAt":"2024-06-05T19:10:47Z"}
+	]}}`
+
+	alerts, err := parseVmalertAlerts([]byte(body), now)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, map[string]string{"alertname": "HighLatency", "service": "api"}, alerts[0].Labels)
+	assert.Equal(t, "http://vmalert/rule", alerts[0].GeneratorURL)
+	assert.True(t, alerts[0].EndsAt.After(now))
+}
@@ -0,0 +1,263 @@
+package alertsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+// SourceLabel is added to every received alert with the name of source it came from
+const SourceLabel = "alertsforge_source"
+
+// Source types which can be declared in alert_sources
+const (
+	AlertmanagerSourceType        = "alertmanager"
+	AlertmanagerWebhookSourceType = "alertmanager_webhook"
+	GrafanaSourceType             = "grafana"
+)
+
+// default sources used when alert_sources is absent in config
+var defaultAlertSources = []config.AlertSource{
+	{Name: AlertmanagerSourceType, Type: AlertmanagerSourceType, Path: "/alertWebhook"},
+	{Name: AlertmanagerWebhookSourceType, Type: AlertmanagerWebhookSourceType, Path: "/alertWebhook/alertmanager"},
+	{Name: GrafanaSourceType, Type: GrafanaSourceType, Path: "/alertWebhook/grafana"},
+}
+
+type AlertSourceInterface interface {
+	Name() string
+	Start(mux *http.ServeMux) error
+}
+
+type alertsParser func(body []byte) ([]sharedtools.Alert, error)
+
+// pushSource accepts alerts with http requests on configured paths,
+// GET and HEAD requests to readPaths only read alerts buffer
+type pushSource struct {
+	name      string
+	handlers  map[string]http.HandlerFunc
+	readPaths []string
+}
+
+func (p *pushSource) Name() string {
+	return p.name
+}
+
+func (p *pushSource) Start(mux *http.ServeMux) error {
+	for path, handler := range p.handlers {
+		zap.S().Infof("source %s listens on %s", p.name, path)
+		mux.HandleFunc(path, handler)
+	}
+	return nil
+}
+
+// pollSource periodically pulls alerts from remote api
+type pollSource struct {
+	poller *alertsPoller
+}
+
+func (p *pollSource) Name() string {
+	return p.poller.config.Name
+}
+
+func (p *pollSource) Start(mux *http.ServeMux) error {
+	go p.poller.Run()
+	return nil
+}
+
+type SourceRegistry struct {
+	sources []AlertSourceInterface
+}
+
+// NewSourceRegistry creates sources declared in alert_sources, json_sources and pollers, all of them share one alerts buffer
+func NewSourceRegistry(am AlertManagerInterface, runbooks *config.RunbooksConfig) (*SourceRegistry, error) {
+	registry := &SourceRegistry{}
+	alertSources := runbooks.AlertSources
+	if len(alertSources) == 0 {
+		alertSources = defaultAlertSources
+	}
+
+	for _, alertSource := range alertSources {
+		source, err := newPushSource(am, alertSource)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Add(source); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, jsonSource := range runbooks.JSONSources {
+		if jsonSource.Name == "" || jsonSource.Path == "" {
+			return nil, fmt.Errorf("json source '%s' must have name and path", jsonSource.Name)
+		}
+		source := &pushSource{name: jsonSource.Name, handlers: map[string]http.HandlerFunc{jsonSource.Path: am.JSONWebhook(jsonSource)}}
+		if err := registry.Add(source); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pollerConfig := range runbooks.Pollers {
+		poller, err := NewAlertsPoller(am, pollerConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := registry.Add(&pollSource{poller: poller}); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func newPushSource(am AlertManagerInterface, alertSource config.AlertSource) (*pushSource, error) {
+	if alertSource.Name == "" {
+		return nil, fmt.Errorf("source of type %s has no name", alertSource.Type)
+	}
+	if alertSource.Path == "" {
+		return nil, fmt.Errorf("source %s has no path", alertSource.Name)
+	}
+	name := alertSource.Name
+	path := alertSource.Path
+	handlers := map[string]http.HandlerFunc{}
+	readPaths := []string{}
+
+	switch alertSource.Type {
+	case AlertmanagerSourceType:
+		path = strings.TrimSuffix(path, "/")
+		pushHandler := am.pushHandler(name, parseAlerts)
+		handlers[path+"/api/v2/alerts"] = func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet {
+				am.GetAlertsWebhook(w, r)
+				return
+			}
+			pushHandler(w, r)
+		}
+		handlers[path+"/api/v2/alerts/groups"] = am.GetAlertGroupsWebhook
+		handlers[path+"/api/v2/status"] = am.GetStatusWebhook
+		readPaths = append(readPaths, path+"/api/v2/alerts", path+"/api/v2/alerts/groups", path+"/api/v2/status")
+	case AlertmanagerWebhookSourceType:
+		handlers[path] = am.pushHandler(name, parseAlertmanagerWebhook)
+	case GrafanaSourceType:
+		handlers[path] = am.pushHandler(name, parseGrafanaWebhook)
+	default:
+		return nil, fmt.Errorf("unknown type '%s' of source %s", alertSource.Type, name)
+	}
+	return &pushSource{name: name, handlers: handlers, readPaths: readPaths}, nil
+}
+
+// Add registers source, names and paths of sources must be unique as http.ServeMux panics on duplicate path
+func (r *SourceRegistry) Add(source AlertSourceInterface) error {
+	for _, existing := range r.sources {
+		if existing.Name() == source.Name() {
+			return fmt.Errorf("source %s is declared twice", source.Name())
+		}
+		push, ok := source.(*pushSource)
+		existingPush, existingOk := existing.(*pushSource)
+		if !ok || !existingOk {
+			continue
+		}
+		for path := range push.handlers {
+			if _, used := existingPush.handlers[path]; used {
+				return fmt.Errorf("path %s of source %s is already used by source %s", path, source.Name(), existing.Name())
+			}
+		}
+	}
+	r.sources = append(r.sources, source)
+	return nil
+}
+
+func (r *SourceRegistry) Sources() []AlertSourceInterface {
+	return r.sources
+}
+
+// ReadOnly is true for GET and HEAD requests to alertmanager api endpoints of sources,
+// other requests to sources push alerts
+func (r *SourceRegistry) ReadOnly(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	for _, source := range r.sources {
+		if push, ok := source.(*pushSource); ok && slices.Contains(push.readPaths, req.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *SourceRegistry) Start(mux *http.ServeMux) error {
+	for _, source := range r.sources {
+		if err := source.Start(mux); err != nil {
+			return fmt.Errorf("can't start source %s: %w", source.Name(), err)
+		}
+	}
+	return nil
+}
+
+// pushHandler reads request body, parses it to alerts and puts them to buffer tagged with source name
+func (a *AlertManager) pushHandler(source string, parse alertsParser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if r.Method != http.MethodPost {
+			asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+			return
+		}
+		log := zap.S()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Errorf("Can't get body", err)
+			return
+		}
+
+		alerts, err := parse(body)
+		if err != nil {
+			asJson(w, http.StatusBadRequest, err.Error())
+			log.Errorf("Can't parse request from source %s: %s, body: \n%s", source, err, body)
+			return
+		}
+
+		a.receiveAlerts(tagSource(alerts, source))
+
+		log.Debugf("got %d alerts from source %s", len(alerts), source)
+		asJson(w, http.StatusOK, "success")
+	}
+}
+
+func tagSource(alerts []sharedtools.Alert, source string) []sharedtools.Alert {
+	for i := range alerts {
+		labels := sharedtools.CopyMap(alerts[i].Labels)
+		labels[SourceLabel] = source
+		alerts[i].Labels = labels
+	}
+	return alerts
+}
+
+func parseAlerts(body []byte) ([]sharedtools.Alert, error) {
+	alerts := []sharedtools.Alert{}
+	if err := json.Unmarshal(body, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func parseAlertmanagerWebhook(body []byte) ([]sharedtools.Alert, error) {
+	message := AlertmanagerWebhookMessage{}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return message.toAlerts(time.Now()), nil
+}
+
+func parseGrafanaWebhook(body []byte) ([]sharedtools.Alert, error) {
+	message := GrafanaWebhookMessage{}
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, err
+	}
+	return message.toAlerts(time.Now()), nil
+}
@@ -0,0 +1,144 @@
+package alertsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sourceNames(registry *SourceRegistry) []string {
+	names := []string{}
+	for _, source := range registry.Sources() {
+		names = append(names, source.Name())
+	}
+	return names
+}
+
+func TestNewSourceRegistry(t *testing.T) {
+	am := &AlertManager{}
+
+	t.Run("default sources", func(t *testing.T) {
+		registry, err := NewSourceRegistry(am, &config.RunbooksConfig{
+			JSONSources: []config.JSONSource{{Name: "ci", Path: "/alertWebhook/ci"}},
+			Pollers:     []config.Poller{{Name: "vmalert", Type: vmalertPollerType, URL: "http://vmalert"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"alertmanager", "alertmanager_webhook", "grafana", "ci", "vmalert"}, sourceNames(registry))
+	})
+
+	t.Run("configured sources", func(t *testing.T) {
+		registry, err := NewSourceRegistry(am, &config.RunbooksConfig{
+			AlertSources: []config.AlertSource{
+				{Name: "vmalert-push", Type: AlertmanagerSourceType, Path: "/vmalert"},
+				{Name: "grafana-cloud", Type: GrafanaSourceType, Path: "/grafana"},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vmalert-push", "grafana-cloud"}, sourceNames(registry))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := NewSourceRegistry(am, &config.RunbooksConfig{
+			AlertSources: []config.AlertSource{{Name: "unknown", Type: "zabbix", Path: "/zabbix"}},
+		})
+		assert.Error(t, err)
+
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			AlertSources: []config.AlertSource{{Name: "grafana", Type: GrafanaSourceType}},
+		})
+		assert.Error(t, err)
+
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			JSONSources: []config.JSONSource{{Name: "grafana", Path: "/json"}},
+		})
+		assert.Error(t, err)
+
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			Pollers: []config.Poller{{Name: "am", Type: "unknown", URL: "http://am"}},
+		})
+		assert.Error(t, err)
+
+		// duplicate paths make http.ServeMux panic on start
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			AlertSources: []config.AlertSource{
+				{Name: "vmalert-push", Type: AlertmanagerSourceType, Path: "/vmalert"},
+				{Name: "vmalert-push-2", Type: AlertmanagerSourceType, Path: "/vmalert/"},
+			},
+		})
+		assert.ErrorContains(t, err, "path /vmalert/api/v2/")
+
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			JSONSources: []config.JSONSource{{Name: "json-grafana", Path: "/alertWebhook/grafana"}},
+		})
+		assert.ErrorContains(t, err, "path /alertWebhook/grafana of source json-grafana is already used by source grafana")
+
+		_, err = NewSourceRegistry(am, &config.RunbooksConfig{
+			AlertSources: []config.AlertSource{{Name: "vmalert-push", Type: AlertmanagerSourceType, Path: "/vmalert"}},
+			JSONSources:  []config.JSONSource{{Name: "json-alerts", Path: "/vmalert/api/v2/alerts"}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestSourceRegistry_Start(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+	registry, err := NewSourceRegistry(am, &config.RunbooksConfig{
+		AlertSources: []config.AlertSource{
+			{Name: "vmalert", Type: AlertmanagerSourceType, Path: "/vmalert/"},
+			{Name: "grafana", Type: GrafanaSourceType, Path: "/grafana"},
+		},
+	})
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	require.NoError(t, registry.Start(mux))
+
+	writer := httptest.NewRecorder()
+	mux.ServeHTTP(writer, httptest.NewRequest(http.MethodPost, "/vmalert/api/v2/alerts", strings.NewReader(`[{"labels":{"alertname":"test"}}]`)))
+	assert.Equal(t, http.StatusOK, writer.Code)
+
+	writer = httptest.NewRecorder()
+	mux.ServeHTTP(writer, httptest.NewRequest(http.MethodPost, "/grafana", strings.NewReader(grafanaWebhookPayload)))
+	assert.Equal(t, http.StatusOK, writer.Code)
+
+	writer = httptest.NewRecorder()
+	mux.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/grafana", strings.NewReader(grafanaWebhookPayload)))
+	assert.Equal(t, http.StatusMethodNotAllowed, writer.Code)
+
+	require.Len(t, am.AlertsBuffer, 2)
+	alert := am.AlertsBuffer[sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "test"})]
+	require.NotNil(t, alert)
+	assert.Equal(t, "vmalert", alert.Labels[SourceLabel])
+	alert = am.AlertsBuffer[sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "High CPU", "grafana_folder": "infra"})]
+	require.NotNil(t, alert)
+	assert.Equal(t, "grafana", alert.Labels[SourceLabel])
+
+	for _, path := range []string{"/vmalert/api/v2/alerts", "/vmalert/api/v2/alerts/groups", "/vmalert/api/v2/status"} {
+		writer = httptest.NewRecorder()
+		mux.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, writer.Code, path)
+		assert.True(t, registry.ReadOnly(httptest.NewRequest(http.MethodGet, path, nil)), path)
+	}
+	assert.False(t, registry.ReadOnly(httptest.NewRequest(http.MethodPost, "/vmalert/api/v2/alerts", nil)))
+	assert.False(t, registry.ReadOnly(httptest.NewRequest(http.MethodGet, "/grafana", nil)))
+}
+
+func TestTagSource(t *testing.T) {
+	labels := map[string]string{"alertname": "test"}
+	alerts := tagSource([]sharedtools.Alert{{Labels: labels}, {}}, "ci")
+	assert.Equal(t, map[string]string{"alertname": "test", SourceLabel: "ci"}, alerts[0].Labels)
+	assert.Equal(t, map[string]string{SourceLabel: "ci"}, alerts[1].Labels)
+	assert.Equal(t, map[string]string{"alertname": "test"}, labels)
+}
@@ -0,0 +1,74 @@
+package alertsource
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+)
+
+// alertmanager repeats notifications every 4h by default, so firing alert without endsAt is kept a bit longer
+const defaultWebhookAlertTTL = 5 * time.Hour
+
+// Annotations added to alerts received through alertmanager webhook, they are available in enrichers and oncall templates
+const (
+	groupKeyAnnotation    = "alertsforge_group_key"
+	externalURLAnnotation = "alertsforge_external_url"
+	receiverAnnotation    = "alertsforge_receiver"
+)
+
+// AlertmanagerWebhookMessage is the payload of alertmanager webhook_config, version 4
+type AlertmanagerWebhookMessage struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []sharedtools.Alert `json:"alerts"`
+}
+
+func (a *AlertManager) AlertmanagerWebhook(w http.ResponseWriter, r *http.Request) {
+	a.pushHandler(AlertmanagerWebhookSourceType, parseAlertmanagerWebhook)(w, r)
+}
+
+func (m AlertmanagerWebhookMessage) toAlerts(now time.Time) []sharedtools.Alert {
+	alerts := make([]sharedtools.Alert, 0, len(m.Alerts))
+	for _, alert := range m.Alerts {
+		if alert.Labels == nil {
+			alert.Labels = map[string]string{}
+		}
+		if alert.Annotations == nil {
+			alert.Annotations = map[string]string{}
+		}
+		alert.Annotations[groupKeyAnnotation] = m.GroupKey
+		alert.Annotations[externalURLAnnotation] = m.ExternalURL
+		alert.Annotations[receiverAnnotation] = m.Receiver
+		alert.EndsAt = webhookAlertEndsAt(alert.Status, alert.EndsAt, now)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// webhookAlertEndsAt returns end time for alert from push based sources: firing alerts usually come without endsAt
+// and are kept for AF_WEBHOOK_ALERT_TTL, resolved alerts without endsAt are resolved right now
+func webhookAlertEndsAt(status string, endsAt time.Time, now time.Time) time.Time {
+	if status == sharedtools.Resolved {
+		if endsAt.IsZero() || endsAt.After(now) {
+			return now
+		}
+		return endsAt
+	}
+	if endsAt.After(now) {
+		return endsAt
+	}
+	ttl := defaultWebhookAlertTTL
+	if parsed, err := time.ParseDuration(os.Getenv("AF_WEBHOOK_ALERT_TTL")); err == nil {
+		ttl = parsed
+	}
+	return now.Add(ttl)
+}
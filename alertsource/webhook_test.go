@@ -0,0 +1,103 @@
+package alertsource
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/mobalyticshq/alertsforge/sharedtools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var alertmanagerWebhookPayload = `{
+  "version": "4",
+  "groupKey": "{}:{alertname=\"container-oom\"}",
+  "truncatedAlerts": 0,
+  "status": "firing",
+  "receiver": "alertsforge",
+  "groupLabels": {"alertname": "container-oom"},
+  "commonLabels": {"alertname": "container-oom"},
+  "commonAnnotations": {},
+  "externalURL": "http://alertmanager:9093",
+  "alerts": [
+    {
+      "status": "firing",
+      "labels": {"alertname": "container-oom", "pod": "app-1"},
+      "annotations": {"description": "oom"},
+      "startsAt": "2024-06-05T19:10:47.047759595Z",
+      "endsAt": "0001-01-01T00:00:00Z",
+      "generatorURL": "http://prometheus/graph",
+      "fingerprint": "aaaa"
+    },
+    {
+      "status": "resolved",
+      "labels": {"alertname": "container-oom", "pod": "app-2"},
+      "annotations": {"description": "oom"},
+      "startsAt": "2024-06-05T19:10:47.047759595Z",
+      "endsAt": "2024-06-05T19:12:47.047759595Z",
+      "generatorURL": "http://prometheus/graph",
+      "fingerprint": "bbbb"
+    }
+  ]
+}`
+
+func TestAlertManager_AlertmanagerWebhook(t *testing.T) {
+	os.Setenv("AF_DEFAULT_RESOLVE_DELAY", "")
+	os.Setenv("AF_WEBHOOK_ALERT_TTL", "1h")
+	defer os.Setenv("AF_WEBHOOK_ALERT_TTL", "")
+
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/alertWebhook/alertmanager", strings.NewReader(alertmanagerWebhookPayload))
+	am.AlertmanagerWebhook(writer, request)
+
+	assert.Equal(t, http.StatusOK, writer.Code)
+	require.Len(t, am.AlertsBuffer, 2)
+
+	firing := am.AlertsBuffer[sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "container-oom", "pod": "app-1"})]
+	require.NotNil(t, firing)
+	assert.Equal(t, "{}:{alertname=\"container-oom\"}", firing.Annotations[groupKeyAnnotation])
+	assert.Equal(t, "http://alertmanager:9093", firing.Annotations[externalURLAnnotation])
+	assert.Equal(t, "alertsforge", firing.Annotations[receiverAnnotation])
+	assert.WithinDuration(t, time.Now().Add(time.Hour), firing.EndsAt, time.Minute)
+
+	resolved := am.AlertsBuffer[sharedtools.LabelSetToFingerprint(map[string]string{"alertname": "container-oom", "pod": "app-2"})]
+	require.NotNil(t, resolved)
+	assert.True(t, resolved.EndsAt.Before(time.Now()))
+}
+
+func TestAlertManager_AlertmanagerWebhook_BadRequest(t *testing.T) {
+	am := &AlertManager{
+		runbooks:         &config.RunbooksConfig{},
+		AlertsBuffer:     map[string]*sharedtools.Alert{},
+		AlertBufferMutex: sync.RWMutex{},
+	}
+
+	writer := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/alertWebhook/alertmanager", strings.NewReader(`[{"labels":`))
+	am.AlertmanagerWebhook(writer, request)
+
+	assert.Equal(t, http.StatusBadRequest, writer.Code)
+	assert.Empty(t, am.AlertsBuffer)
+}
+
+func TestWebhookAlertEndsAt(t *testing.T) {
+	now := time.Now()
+	os.Setenv("AF_WEBHOOK_ALERT_TTL", "")
+
+	assert.Equal(t, now.Add(defaultWebhookAlertTTL), webhookAlertEndsAt(sharedtools.Firing, time.Time{}, now))
+	assert.Equal(t, now.Add(time.Minute), webhookAlertEndsAt(sharedtools.Firing, now.Add(time.Minute), now))
+	assert.Equal(t, now, webhookAlertEndsAt(sharedtools.Resolved, time.Time{}, now))
+	assert.Equal(t, now.Add(-time.Minute), webhookAlertEndsAt(sharedtools.Resolved, now.Add(-time.Minute), now))
+}
@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Roles which can be required by endpoints, admin is allowed everywhere
+const (
+	RoleNone   = ""
+	RoleIngest = "ingest"
+	RoleRead   = "read"
+	RoleAdmin  = "admin"
+)
+
+// SignatureHeader carries hex encoded HMAC-SHA256 of timestamp header, dot and request body prefixed with sha256=,
+// TimestampHeader is unix time of signing, requests signed more than signatureTolerance ago or ahead are rejected
+// so captured requests can't be replayed
+const (
+	SignatureHeader = "X-Alertsforge-Signature"
+	TimestampHeader = "X-Alertsforge-Timestamp"
+
+	signatureTolerance = 5 * time.Minute
+	// maxSignedBodySize limits body which is read to check signature
+	maxSignedBodySize = 10 << 20
+)
+
+type basicUser struct {
+	password string
+	role     string
+}
+
+type Authenticator struct {
+	tokens     map[string]string
+	users      map[string]basicUser
+	hmacSecret []byte
+}
+
+// RoleFunc returns role required for request, RoleNone means request is not authenticated
+type RoleFunc func(r *http.Request) string
+
+// NewAuthenticatorFromEnv reads credentials from environment:
+// AF_AUTH_TOKENS is comma separated list of role:token,
+// AF_AUTH_BASIC is comma separated list of role:user:password,
+// AF_AUTH_HMAC_SECRET is the secret for ingest request signatures
+func NewAuthenticatorFromEnv() (*Authenticator, error) {
+	return NewAuthenticator(os.Getenv("AF_AUTH_TOKENS"), os.Getenv("AF_AUTH_BASIC"), os.Getenv("AF_AUTH_HMAC_SECRET"))
+}
+
+func NewAuthenticator(tokens, users, hmacSecret string) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens:     map[string]string{},
+		users:      map[string]basicUser{},
+		hmacSecret: []byte(hmacSecret),
+	}
+	for _, item := range splitList(tokens) {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("token must be in role:token format")
+		}
+		if err := validateRole(parts[0]); err != nil {
+			return nil, err
+		}
+		a.tokens[parts[1]] = parts[0]
+	}
+	for _, item := range splitList(users) {
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 || parts[1] == "" {
+			return nil, fmt.Errorf("basic auth user must be in role:user:password format")
+		}
+		if err := validateRole(parts[0]); err != nil {
+			return nil, err
+		}
+		a.users[parts[1]] = basicUser{password: parts[2], role: parts[0]}
+	}
+	return a, nil
+}
+
+// Enabled is false when no credentials are configured, all requests are allowed then
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0 || len(a.users) > 0 || len(a.hmacSecret) > 0
+}
+
+// Middleware rejects requests without credentials with 401 and requests with credentials of wrong role with 403
+func (a *Authenticator) Middleware(requiredRole RoleFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := requiredRole(r)
+		if role == RoleNone || !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		roles, err := a.authenticate(w, r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		if err != nil {
+			zap.S().Warnf("unauthenticated request %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, err)
+			if len(a.users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="alertsforge"`)
+			}
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !allowed(roles, role) {
+			zap.S().Warnf("forbidden request %s %s from %s: %s role required", r.Method, r.URL.Path, r.RemoteAddr, role)
+			writeError(w, http.StatusForbidden, role+" role required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns roles granted by credentials of request
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) ([]string, error) {
+	roles := []string{}
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token := strings.TrimPrefix(header, "Bearer ")
+		role, ok := a.lookupToken(token)
+		if !ok {
+			return nil, fmt.Errorf("invalid bearer token")
+		}
+		roles = append(roles, role)
+	} else if user, password, ok := r.BasicAuth(); ok {
+		basic, found := a.users[user]
+		if !found || subtle.ConstantTimeCompare([]byte(basic.password), []byte(password)) != 1 {
+			return nil, fmt.Errorf("invalid user or password")
+		}
+		roles = append(roles, basic.role)
+	}
+
+	if signature := r.Header.Get(SignatureHeader); signature != "" {
+		if len(a.hmacSecret) == 0 {
+			return nil, fmt.Errorf("request signatures are not configured")
+		}
+		timestamp := r.Header.Get(TimestampHeader)
+		signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s header with unix time is required for signed request", TimestampHeader)
+		}
+		if age := time.Since(time.Unix(signedAt, 0)); age > signatureTolerance || age < -signatureTolerance {
+			return nil, fmt.Errorf("request signature is expired")
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if !hmac.Equal([]byte(signature), []byte(Sign(a.hmacSecret, timestamp, body))) {
+			return nil, fmt.Errorf("invalid request signature")
+		}
+		roles = append(roles, RoleIngest)
+	}
+
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("credentials required")
+	}
+	return roles, nil
+}
+
+func (a *Authenticator) lookupToken(token string) (string, bool) {
+	for known, role := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// Sign returns value of signature header for body signed at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func allowed(roles []string, required string) bool {
+	for _, role := range roles {
+		if role == required || role == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRole(role string) error {
+	switch role {
+	case RoleIngest, RoleRead, RoleAdmin:
+		return nil
+	}
+	return fmt.Errorf("unknown role %q, must be one of %s, %s, %s", role, RoleIngest, RoleRead, RoleAdmin)
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	bytes, _ := json.Marshal(struct {
+		Status  int
+		Message string
+	}{Status: status, Message: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(bytes)
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	a, err := NewAuthenticator("", "", "")
+	require.NoError(t, err)
+	assert.False(t, a.Enabled())
+
+	a, err = NewAuthenticator("admin:t1, read:t:2", "read:grafana:pass:word", "")
+	require.NoError(t, err)
+	assert.True(t, a.Enabled())
+	assert.Equal(t, map[string]string{"t1": RoleAdmin, "t:2": RoleRead}, a.tokens)
+	assert.Equal(t, map[string]basicUser{"grafana": {password: "pass:word", role: RoleRead}}, a.users)
+
+	_, err = NewAuthenticator("token", "", "")
+	assert.Error(t, err)
+	_, err = NewAuthenticator("owner:token", "", "")
+	assert.Error(t, err)
+	_, err = NewAuthenticator("", "read:user", "")
+	assert.Error(t, err)
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	a, err := NewAuthenticator("ingest:ingest-token,read:read-token,admin:admin-token", "read:viewer:secret", "hmac-secret")
+	require.NoError(t, err)
+
+	body := `[{"labels":{"alertname":"test"}}]`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	signed := func(secret, timestamp string) map[string]string {
+		return map[string]string{SignatureHeader: Sign([]byte(secret), timestamp, []byte(body)), TimestampHeader: timestamp}
+	}
+	var receivedBody string
+	handler := a.Middleware(func(r *http.Request) string {
+		switch r.URL.Path {
+		case "/healthz":
+			return RoleNone
+		case "/processAlertBuffer":
+			return RoleAdmin
+		case "/showAlertBuffer":
+			return RoleRead
+		}
+		return RoleIngest
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bytes, _ := io.ReadAll(r.Body)
+		receivedBody = string(bytes)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		user     string
+		password string
+		expected int
+	}{
+		{name: "open endpoint", path: "/healthz", expected: http.StatusOK},
+		{name: "no credentials", path: "/alertWebhook", expected: http.StatusUnauthorized},
+		{name: "invalid token", path: "/alertWebhook", headers: map[string]string{"Authorization": "Bearer wrong"}, expected: http.StatusUnauthorized},
+		{name: "ingest token", path: "/alertWebhook", headers: map[string]string{"Authorization": "Bearer ingest-token"}, expected: http.StatusOK},
+		{name: "read token can't ingest", path: "/alertWebhook", headers: map[string]string{"Authorization": "Bearer read-token"}, expected: http.StatusForbidden},
+		{name: "admin token can ingest", path: "/alertWebhook", headers: map[string]string{"Authorization": "Bearer admin-token"}, expected: http.StatusOK},
+		{name: "valid signature", path: "/alertWebhook", headers: signed("hmac-secret", now), expected: http.StatusOK},
+		{name: "invalid signature", path: "/alertWebhook", headers: signed("other", now), expected: http.StatusUnauthorized},
+		{name: "replayed signature", path: "/alertWebhook", headers: signed("hmac-secret", old), expected: http.StatusUnauthorized},
+		{name: "signature without timestamp", path: "/alertWebhook", headers: map[string]string{SignatureHeader: Sign([]byte("hmac-secret"), "", []byte(body))}, expected: http.StatusUnauthorized},
+		{name: "timestamp is signed", path: "/alertWebhook", headers: map[string]string{SignatureHeader: signed("hmac-secret", old)[SignatureHeader], TimestampHeader: now}, expected: http.StatusUnauthorized},
+		{name: "signature can't read", path: "/showAlertBuffer", headers: signed("hmac-secret", now), expected: http.StatusForbidden},
+		{name: "read token", path: "/showAlertBuffer", headers: map[string]string{"Authorization": "Bearer read-token"}, expected: http.StatusOK},
+		{name: "ingest token can't read", path: "/showAlertBuffer", headers: map[string]string{"Authorization": "Bearer ingest-token"}, expected: http.StatusForbidden},
+		{name: "basic auth", path: "/showAlertBuffer", user: "viewer", password: "secret", expected: http.StatusOK},
+		{name: "basic auth wrong password", path: "/showAlertBuffer", user: "viewer", password: "wrong", expected: http.StatusUnauthorized},
+		{name: "basic auth not admin", path: "/processAlertBuffer", user: "viewer", password: "secret", expected: http.StatusForbidden},
+		{name: "admin token", path: "/processAlertBuffer", headers: map[string]string{"Authorization": "Bearer admin-token"}, expected: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receivedBody = ""
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			writer := httptest.NewRecorder()
+			handler.ServeHTTP(writer, req)
+			assert.Equal(t, tt.expected, writer.Code)
+			if tt.expected == http.StatusOK {
+				assert.Equal(t, body, receivedBody)
+			} else {
+				assert.Empty(t, receivedBody)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_SignedBodyLimit(t *testing.T) {
+	a, err := NewAuthenticator("", "", "hmac-secret")
+	require.NoError(t, err)
+	handler := a.Middleware(func(r *http.Request) string { return RoleIngest }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	body := strings.Repeat("a", maxSignedBodySize+1)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/alertWebhook", strings.NewReader(body))
+	req.Header.Set(SignatureHeader, Sign([]byte("hmac-secret"), timestamp, []byte(body)))
+	req.Header.Set(TimestampHeader, timestamp)
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, writer.Code)
+}
+
+func TestAuthenticator_MiddlewareDisabled(t *testing.T) {
+	a, err := NewAuthenticator("", "", "")
+	require.NoError(t, err)
+	handler := a.Middleware(func(r *http.Request) string { return RoleAdmin }, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	writer := httptest.NewRecorder()
+	handler.ServeHTTP(writer, httptest.NewRequest(http.MethodPost, "/processAlertBuffer", nil))
+	assert.Equal(t, http.StatusOK, writer.Code)
+}
@@ -13,9 +13,80 @@ type Runbook struct {
 }
 
 type RunbooksConfig struct {
-	EnrichmentFlow []EnrichmentStep `yaml:"enrichment_flow"`
-	OncallMessage  `yaml:"oncall_message"`
-	Silences       []Silence `yaml:"silenced_alerts"`
+	EnrichmentFlow     []EnrichmentStep `yaml:"enrichment_flow"`
+	OncallMessage      `yaml:"oncall_message"`
+	OncallIntegrations []OncallIntegration `yaml:"oncall_integrations"`
+	Silences           []Silence           `yaml:"silenced_alerts"`
+	AlertSources       []AlertSource       `yaml:"alert_sources"`
+	JSONSources        []JSONSource        `yaml:"json_sources"`
+	Pollers            []Poller            `yaml:"pollers"`
+	Fingerprint        Fingerprint         `yaml:"fingerprint"`
+	Sinks              []Sink              `yaml:"sinks"`
+	Route              *Route              `yaml:"route"`
+}
+
+// Sink is a named destination of alerts, config is specific to sink type
+type Sink struct {
+	Name   string            `yaml:"name"`
+	Type   string            `yaml:"type"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// OncallIntegration is named OnCall formatted webhook integration, url is full integration url
+// or integration token which is appended to AF_ONCALL_API_URL
+type OncallIntegration struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// Route sends alerts matching labelsSelector to sinks, the first matching child route wins unless it has continue,
+// child route without sinks inherits them from parent, route is used itself only when none of children matched
+type Route struct {
+	LabelsSelector map[string]string `yaml:"labelsSelector,omitempty"`
+	Sinks          []string          `yaml:"sinks,omitempty"`
+	Continue       bool              `yaml:"continue,omitempty"`
+	Routes         []Route           `yaml:"routes,omitempty"`
+}
+
+// Fingerprint configures which labels identify alert in buffer, global policy is used if none of rules matches
+type Fingerprint struct {
+	FingerprintPolicy `yaml:",inline"`
+	Rules             []FingerprintPolicy `yaml:"rules,omitempty"`
+}
+
+// FingerprintPolicy selects labels for fingerprint: only include labels if set, minus exclude and excludeRegex ones
+type FingerprintPolicy struct {
+	LabelsSelector map[string]string `yaml:"labelsSelector,omitempty"`
+	Include        []string          `yaml:"include,omitempty"`
+	Exclude        []string          `yaml:"exclude,omitempty"`
+	ExcludeRegex   string            `yaml:"excludeRegex,omitempty"`
+}
+
+// AlertSource enables builtin push source of given type on the path
+type AlertSource struct {
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+}
+
+// Poller describes alertmanager or vmalert api which is periodically queried for active alerts
+type Poller struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	URL      string `yaml:"url"`
+	Interval string `yaml:"interval,omitempty"`
+}
+
+// JSONSource describes webhook accepting arbitrary json, every field is a template over request body
+type JSONSource struct {
+	Name        string            `yaml:"name"`
+	Path        string            `yaml:"path"`
+	AlertsKey   string            `yaml:"alertsKey,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+	StartsAt    string            `yaml:"startsAt,omitempty"`
+	EndsAt      string            `yaml:"endsAt,omitempty"`
+	Status      string            `yaml:"status,omitempty"`
 }
 
 type Silence struct {
@@ -34,6 +105,7 @@ type OncallMessage struct {
 	SimpleMessage   string `yaml:"simple_message,omitempty"`
 	TelegramMessage string `yaml:"telegram_message,omitempty"`
 	EscalationChain string `yaml:"escalation_chain,omitempty"`
+	Integration     string `yaml:"integration,omitempty"`
 }
 
 type Config struct {
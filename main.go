@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/mobalyticshq/alertsforge/alertsource"
+	"github.com/mobalyticshq/alertsforge/auth"
 	"github.com/mobalyticshq/alertsforge/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -29,11 +31,42 @@ func main() {
 	if err != nil {
 		log.Fatalf("error during structure loading: %v", err)
 	}
-	am := alertsource.NewAlertManager(runbooks)
-	http.HandleFunc("/healthz", healthz)
-	http.HandleFunc("/alertWebhook/api/v2/alerts", am.AlertWebhook)
-	http.HandleFunc("/processAlertBuffer", am.ProcessAlertsBufferWebhook)
-	http.HandleFunc("/showAlertBuffer", am.ShowAlertsBufferWebhook)
+	am, err := alertsource.NewAlertManager(runbooks)
+	if err != nil {
+		log.Fatalf("error during alert manager creation: %v", err)
+	}
+	sources, err := alertsource.NewSourceRegistry(am, runbooks)
+	if err != nil {
+		log.Fatalf("error during alert sources creation: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthz)
+	mux.HandleFunc("/processAlertBuffer", am.ProcessAlertsBufferWebhook)
+	mux.HandleFunc("/showAlertBuffer", am.ShowAlertsBufferWebhook)
+	mux.HandleFunc("/deadLetters", am.DeadLettersWebhook)
+	mux.HandleFunc("/deadLetters/replay", am.ReplayDeadLettersWebhook)
+	mux.HandleFunc("/oncall/webhook", am.OncallWebhook)
+	if err := sources.Start(mux); err != nil {
+		log.Fatal(err)
+	}
+
+	cluster, err := alertsource.NewClusterFromEnv(am)
+	if err != nil {
+		log.Fatalf("error during cluster creation: %v", err)
+	}
+	if cluster != nil {
+		cluster.Register(mux)
+		go cluster.Run()
+	}
+
+	authenticator, err := auth.NewAuthenticatorFromEnv()
+	if err != nil {
+		log.Fatalf("error during auth configuration: %v", err)
+	}
+	if !authenticator.Enabled() {
+		log.Warn("authentication is not configured, all endpoints are open")
+	}
 
 	go am.AlertsProcessor()
 	listenAddress := ":8080"
@@ -42,7 +75,23 @@ func main() {
 	}
 
 	log.Info("listening on: ", listenAddress)
-	log.Fatal(http.ListenAndServe(listenAddress, nil))
+	log.Fatal(http.ListenAndServe(listenAddress, authenticator.Middleware(requiredRole(sources), mux)))
+}
+
+// requiredRole classifies endpoints by path: alert sources accept pushes with ingest role and serve
+// alertmanager api with read role, unknown paths require ingest role
+func requiredRole(sources *alertsource.SourceRegistry) auth.RoleFunc {
+	return func(r *http.Request) string {
+		switch {
+		case r.URL.Path == "/healthz":
+			return auth.RoleNone
+		case r.URL.Path == "/processAlertBuffer", strings.HasPrefix(r.URL.Path, "/cluster/"), strings.HasPrefix(r.URL.Path, "/deadLetters"):
+			return auth.RoleAdmin
+		case r.URL.Path == "/showAlertBuffer", sources.ReadOnly(r):
+			return auth.RoleRead
+		}
+		return auth.RoleIngest
+	}
 }
 
 func healthz(w http.ResponseWriter, r *http.Request) {
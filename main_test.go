@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/alertsource"
+	"github.com/mobalyticshq/alertsforge/auth"
+	"github.com/mobalyticshq/alertsforge/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredRole_ReadTokenCantIngest(t *testing.T) {
+	t.Setenv("AF_BUFFER_PATH", "")
+	runbooks := &config.RunbooksConfig{JSONSources: []config.JSONSource{{Name: "json", Path: "/json"}}}
+	am, err := alertsource.NewAlertManager(runbooks)
+	require.NoError(t, err)
+	sources, err := alertsource.NewSourceRegistry(am, runbooks)
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	require.NoError(t, sources.Start(mux))
+	authenticator, err := auth.NewAuthenticator("read:read-token,ingest:ingest-token", "", "")
+	require.NoError(t, err)
+	handler := authenticator.Middleware(requiredRole(sources), mux)
+
+	request := func(method, path, token string) int {
+		body := `[{"labels":{"alertname":"test"}}]`
+		if strings.HasSuffix(path, "/alertmanager") {
+			body = `{"alerts":[{"status":"firing","labels":{"alertname":"test"}}]}`
+		}
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for _, path := range []string{"/alertWebhook/api/v2/alerts", "/alertWebhook/alertmanager", "/alertWebhook/grafana", "/json"} {
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut} {
+			if method == http.MethodGet && path == "/alertWebhook/api/v2/alerts" {
+				continue
+			}
+			assert.Equal(t, http.StatusForbidden, request(method, path, "read-token"), method+" "+path)
+		}
+	}
+	assert.Empty(t, am.(*alertsource.AlertManager).AlertsBuffer)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/alertWebhook/api/v2/alerts", "read-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/alertWebhook/api/v2/status", "read-token"))
+	assert.Equal(t, http.StatusMethodNotAllowed, request(http.MethodGet, "/alertWebhook/alertmanager", "ingest-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/alertWebhook/alertmanager", "ingest-token"))
+	assert.Len(t, am.(*alertsource.AlertManager).AlertsBuffer, 1)
+}
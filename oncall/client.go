@@ -0,0 +1,171 @@
+// Package oncall is client of Grafana OnCall public api
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second
+	defaultMaxPages = 1000
+
+	alertGroupsPath  = "/api/v1/alert_groups/"
+	alertsPath       = "/api/v1/alerts/"
+	integrationsPath = "/api/v1/integrations/"
+)
+
+// states of alert group
+const (
+	StateNew          = "new"
+	StateAcknowledged = "acknowledged"
+	StateResolved     = "resolved"
+	StateSilenced     = "silenced"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// AlertGroup is alert group of oncall api
+type AlertGroup struct {
+	ID             string            `json:"id"`
+	IntegrationID  string            `json:"integration_id,omitempty"`
+	RouteID        string            `json:"route_id,omitempty"`
+	AlertsCount    int               `json:"alerts_count"`
+	State          string            `json:"state"`
+	Title          string            `json:"title"`
+	CreatedAt      *time.Time        `json:"created_at,omitempty"`
+	AcknowledgedAt *time.Time        `json:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time        `json:"resolved_at,omitempty"`
+	SilencedAt     *time.Time        `json:"silenced_at,omitempty"`
+	Permalinks     map[string]string `json:"permalinks,omitempty"`
+}
+
+// Alert is alert of alert group, Payload is the body sent to integration
+type Alert struct {
+	ID           string          `json:"id"`
+	AlertGroupID string          `json:"alert_group_id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+// Integration is integration of oncall api, Link is the url alerts are sent to
+type Integration struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Link string `json:"link"`
+}
+
+// AlertGroupsQuery filters alert groups, empty fields are not used
+type AlertGroupsQuery struct {
+	State         string
+	IntegrationID string
+	RouteID       string
+}
+
+// Client calls oncall api with api token, next pages are requested from baseURL even if oncall
+// returns other public host in links
+type Client struct {
+	baseURL  *url.URL
+	token    string
+	client   *http.Client
+	maxPages int
+}
+
+// NewClient creates client of oncall api at baseURL, requests are cancelled after timeout
+func NewClient(baseURL, token string, timeout time.Duration) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("can't parse oncall api url: %w", err)
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Client{baseURL: parsed, token: token, client: &http.Client{Timeout: timeout}, maxPages: defaultMaxPages}, nil
+}
+
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+// AlertGroups iterates alert groups matching query
+func (c *Client) AlertGroups(ctx context.Context, query AlertGroupsQuery) *Iterator[AlertGroup] {
+	values := url.Values{}
+	for name, value := range map[string]string{"state": query.State, "integration_id": query.IntegrationID, "route_id": query.RouteID} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	return newIterator[AlertGroup](ctx, c, c.url(alertGroupsPath, values))
+}
+
+// AlertGroup returns alert group by id, ErrNotFound is returned if it doesn't exist
+func (c *Client) AlertGroup(ctx context.Context, id string) (AlertGroup, error) {
+	group := AlertGroup{}
+	err := c.get(ctx, c.url(alertGroupsPath+url.PathEscape(id)+"/", nil), &group)
+	return group, err
+}
+
+// Alerts iterates alerts of alert group from the oldest to the latest
+func (c *Client) Alerts(ctx context.Context, alertGroupID string) *Iterator[Alert] {
+	return newIterator[Alert](ctx, c, c.url(alertsPath, url.Values{"alert_group_id": {alertGroupID}}))
+}
+
+// Integrations iterates all integrations
+func (c *Client) Integrations(ctx context.Context) *Iterator[Integration] {
+	return newIterator[Integration](ctx, c, c.url(integrationsPath, nil))
+}
+
+func (c *Client) url(path string, query url.Values) string {
+	result := *c.baseURL
+	result.Path += path
+	result.RawQuery = query.Encode()
+	return result.String()
+}
+
+// pageURL keeps path and query of next page link and takes scheme and host from baseURL
+func (c *Client) pageURL(link string) (string, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("can't parse next page url: %w", err)
+	}
+	parsed.Scheme, parsed.Host, parsed.User = c.baseURL.Scheme, c.baseURL.Host, c.baseURL.User
+	return parsed.String(), nil
+}
+
+func (c *Client) get(ctx context.Context, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Authorization", c.token)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", req.URL.Redacted(), ErrNotFound)
+	case res.StatusCode != http.StatusOK:
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		return fmt.Errorf("unexpected status code %d from %s: %s", res.StatusCode, req.URL.Redacted(), body)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("can't parse response of %s: %w", req.URL.Redacted(), err)
+	}
+	return nil
+}
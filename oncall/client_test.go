@@ -0,0 +1,83 @@
+package oncall_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mobalyticshq/alertsforge/oncall"
+	"github.com/mobalyticshq/alertsforge/oncall/oncalltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	server := oncalltest.NewServer("token")
+	defer server.Close()
+	server.PageSize = 2
+	// next links point to public host which is not reachable from alertsforge
+	server.PublicURL = "https://oncall.example.com"
+	for _, title := range []string{"a", "b", "c", "d", "e"} {
+		server.AddAlertGroup(title, oncall.StateNew, map[string]string{"title": title})
+	}
+	resolved := server.AddAlertGroup("f", oncall.StateResolved, map[string]string{"n": "1"}, map[string]string{"n": "2"}, map[string]string{"n": "3"})
+
+	client, err := oncall.NewClient(server.URL+"/", "token", 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	groups, err := client.AlertGroups(ctx, oncall.AlertGroupsQuery{State: oncall.StateNew}).All()
+	require.NoError(t, err)
+	titles := []string{}
+	for _, group := range groups {
+		titles = append(titles, group.Title)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, titles)
+	assert.Equal(t, 3, server.Requests("/api/v1/alert_groups/"))
+
+	group, err := client.AlertGroup(ctx, resolved.ID)
+	require.NoError(t, err)
+	assert.Equal(t, oncall.StateResolved, group.State)
+	assert.Equal(t, 3, group.AlertsCount)
+	_, err = client.AlertGroup(ctx, "unknown")
+	assert.ErrorIs(t, err, oncall.ErrNotFound)
+
+	alerts, err := client.Alerts(ctx, resolved.ID).All()
+	require.NoError(t, err)
+	require.Len(t, alerts, 3)
+	assert.JSONEq(t, `{"n":"3"}`, string(alerts[2].Payload))
+	assert.Equal(t, resolved.ID, alerts[2].AlertGroupID)
+
+	// iteration stops on cancelled context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	iterator := client.Alerts(cancelled, resolved.ID)
+	assert.False(t, iterator.Next())
+	assert.ErrorIs(t, iterator.Err(), context.Canceled)
+
+	unauthorized, err := oncall.NewClient(server.URL, "wrong", 0)
+	require.NoError(t, err)
+	_, err = unauthorized.AlertGroups(ctx, oncall.AlertGroupsQuery{}).All()
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestClient_Integrations(t *testing.T) {
+	server := oncalltest.NewServer("token")
+	defer server.Close()
+	backend := server.AddIntegrationAlertGroup("b4ck3nd", "HighCPU", oncall.StateNew)
+	server.AddIntegrationAlertGroup("d3v0ps", "HighCPU", oncall.StateNew)
+
+	client, err := oncall.NewClient(server.URL, "token", 0)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	integrations, err := client.Integrations(ctx).All()
+	require.NoError(t, err)
+	require.Len(t, integrations, 2)
+	assert.Equal(t, backend.IntegrationID, integrations[0].ID)
+	assert.Equal(t, server.IntegrationURL("b4ck3nd"), integrations[0].Link)
+
+	groups, err := client.AlertGroups(ctx, oncall.AlertGroupsQuery{IntegrationID: backend.IntegrationID}).All()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, backend.ID, groups[0].ID)
+}
@@ -0,0 +1,83 @@
+package oncall
+
+import (
+	"context"
+	"fmt"
+)
+
+// Iterator goes through items of paginated list, pages are requested while iterating:
+//
+//	groups := client.AlertGroups(ctx, query)
+//	for groups.Next() {
+//		group := groups.Item()
+//	}
+//	err := groups.Err()
+type Iterator[T any] struct {
+	ctx     context.Context
+	client  *Client
+	next    string
+	items   []T
+	current T
+	pages   int
+	err     error
+}
+
+type page[T any] struct {
+	Next    *string `json:"next"`
+	Results []T     `json:"results"`
+}
+
+func newIterator[T any](ctx context.Context, client *Client, url string) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, client: client, next: url}
+}
+
+// Next moves to the next item, false is returned at the end of list or on error
+func (i *Iterator[T]) Next() bool {
+	for len(i.items) == 0 {
+		if i.err != nil || i.next == "" {
+			return false
+		}
+		if err := i.ctx.Err(); err != nil {
+			i.err = err
+			return false
+		}
+		if i.pages >= i.client.maxPages {
+			i.err = fmt.Errorf("more than %d pages in %s", i.client.maxPages, i.next)
+			return false
+		}
+		result := page[T]{}
+		if err := i.client.get(i.ctx, i.next, &result); err != nil {
+			i.err = err
+			return false
+		}
+		i.pages++
+		i.next = ""
+		if result.Next != nil && *result.Next != "" {
+			if i.next, i.err = i.client.pageURL(*result.Next); i.err != nil {
+				return false
+			}
+		}
+		i.items = result.Results
+	}
+	i.current, i.items = i.items[0], i.items[1:]
+	return true
+}
+
+// Item returns current item
+func (i *Iterator[T]) Item() T {
+	return i.current
+}
+
+// Err returns error which stopped iteration
+func (i *Iterator[T]) Err() error {
+	return i.err
+}
+
+// All returns remaining items
+func (i *Iterator[T]) All() ([]T, error) {
+	items := []T{}
+	for i.Next() {
+		items = append(items, i.Item())
+	}
+	return items, i.Err()
+}
@@ -0,0 +1,32 @@
+package oncall
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterator_MaxPages(t *testing.T) {
+	// every page links to the next one
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"next":"%s/api/v1/alert_groups/?page=x","results":[{"id":"1"}]}`, server.URL)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL, "", 0)
+	require.NoError(t, err)
+	client.maxPages = 2
+
+	iterator := client.AlertGroups(context.Background(), AlertGroupsQuery{})
+	items := 0
+	for iterator.Next() {
+		items++
+	}
+	assert.Equal(t, 2, items)
+	assert.ErrorContains(t, iterator.Err(), "more than 2 pages")
+}
@@ -0,0 +1,271 @@
+// Package oncalltest provides fake OnCall server with public api and formatted webhook integrations for tests
+package oncalltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mobalyticshq/alertsforge/oncall"
+)
+
+const integrationPath = "/integrations/v1/formatted_webhook/"
+
+// Server is fake OnCall, payloads posted to integrations are grouped by title like formatted webhook does:
+// alert is added to the active group of the integration with the same title or new group is created,
+// state "ok" resolves the group. Integrations are created on first use of their token.
+// List endpoints return PageSize items per page and links to next pages on PublicURL host,
+// integrations respond with IntegrationStatus if it's set and api paths with their PathStatus
+type Server struct {
+	*httptest.Server
+	Token             string
+	PageSize          int
+	PublicURL         string
+	IntegrationStatus int
+	PathStatus        map[string]int
+
+	mutex        sync.Mutex
+	groups       []oncall.AlertGroup
+	alerts       []oncall.Alert
+	integrations map[string]string
+	requests     map[string]int
+	lastID       int
+}
+
+// NewServer starts fake server which requires api token
+func NewServer(token string) *Server {
+	s := &Server{Token: token, PageSize: 50, integrations: map[string]string{}, requests: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.PublicURL = s.URL
+	return s
+}
+
+// IntegrationURL returns formatted webhook url of integration token
+func (s *Server) IntegrationURL(token string) string {
+	return s.URL + integrationPath + token + "/"
+}
+
+// AddAlertGroup creates alert group without integration with alerts of payloads and returns it
+func (s *Server) AddAlertGroup(title, state string, payloads ...any) oncall.AlertGroup {
+	return s.AddIntegrationAlertGroup("", title, state, payloads...)
+}
+
+// AddIntegrationAlertGroup creates alert group of integration with token like it was sent to the integration
+func (s *Server) AddIntegrationAlertGroup(token, title, state string, payloads ...any) oncall.AlertGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	group := s.addGroup(s.integrationID(token), title, state)
+	for _, payload := range payloads {
+		data, _ := json.Marshal(payload)
+		s.addAlert(group, data)
+	}
+	return *group
+}
+
+// SetState changes state of alert group like engineer does in oncall
+func (s *Server) SetState(id, state string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if group := s.group(id); group != nil {
+		group.State = state
+	}
+}
+
+// DeleteAlertGroup removes alert group
+func (s *Server) DeleteAlertGroup(id string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := range s.groups {
+		if s.groups[i].ID == id {
+			s.groups = append(s.groups[:i], s.groups[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) AlertGroups() []oncall.AlertGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]oncall.AlertGroup{}, s.groups...)
+}
+
+// Alerts returns alerts of alert group from the oldest to the latest
+func (s *Server) Alerts(alertGroupID string) []oncall.Alert {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	alerts := []oncall.Alert{}
+	for _, alert := range s.alerts {
+		if alert.AlertGroupID == alertGroupID {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// Requests returns number of requests to path
+func (s *Server) Requests(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.requests[r.URL.Path]++
+
+	if strings.HasPrefix(r.URL.Path, integrationPath) {
+		s.receivePayload(w, r)
+		return
+	}
+	if status := s.PathStatus[r.URL.Path]; status != 0 {
+		http.Error(w, `{"detail":"Unavailable."}`, status)
+		return
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != s.Token {
+		http.Error(w, `{"detail":"Invalid token."}`, http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.URL.Path == "/api/v1/alert_groups/":
+		groups := []oncall.AlertGroup{}
+		query := r.URL.Query()
+		for _, group := range s.groups {
+			if (query.Get("state") == "" || group.State == query.Get("state")) &&
+				(query.Get("integration_id") == "" || group.IntegrationID == query.Get("integration_id")) {
+				groups = append(groups, group)
+			}
+		}
+		s.writePage(w, r, groups)
+	case r.URL.Path == "/api/v1/integrations/":
+		integrations := []oncall.Integration{}
+		for token, id := range s.integrations {
+			integrations = append(integrations, oncall.Integration{ID: id, Name: token, Link: s.PublicURL + integrationPath + token + "/"})
+		}
+		sort.Slice(integrations, func(i, j int) bool { return integrations[i].ID < integrations[j].ID })
+		s.writePage(w, r, integrations)
+	case strings.HasPrefix(r.URL.Path, "/api/v1/alert_groups/"):
+		group := s.group(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/alert_groups/"), "/"))
+		if group == nil {
+			http.Error(w, `{"detail":"Not found."}`, http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(group)
+	case r.URL.Path == "/api/v1/alerts/":
+		alerts := []oncall.Alert{}
+		for _, alert := range s.alerts {
+			if id := r.URL.Query().Get("alert_group_id"); id == "" || alert.AlertGroupID == id {
+				alerts = append(alerts, alert)
+			}
+		}
+		s.writePage(w, r, alerts)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) receivePayload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.IntegrationStatus != 0 && s.IntegrationStatus != http.StatusOK {
+		http.Error(w, "integration is not available", s.IntegrationStatus)
+		return
+	}
+	payload := struct {
+		Title string `json:"title"`
+		State string `json:"state"`
+	}{}
+	data := json.RawMessage{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	integrationID := s.integrationID(strings.Trim(strings.TrimPrefix(r.URL.Path, integrationPath), "/"))
+	var group *oncall.AlertGroup
+	for i := range s.groups {
+		if s.groups[i].IntegrationID == integrationID && s.groups[i].Title == payload.Title && s.groups[i].State != oncall.StateResolved {
+			group = &s.groups[i]
+		}
+	}
+	if group == nil {
+		group = s.addGroup(integrationID, payload.Title, oncall.StateNew)
+	}
+	s.addAlert(group, data)
+	if payload.State == "ok" {
+		group.State = oncall.StateResolved
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Ok."))
+}
+
+// writePage writes page of items selected by page query parameter
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items any) {
+	data, _ := json.Marshal(items)
+	all := []json.RawMessage{}
+	json.Unmarshal(data, &all)
+
+	number, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if number < 1 {
+		number = 1
+	}
+	start, end := (number-1)*s.PageSize, number*s.PageSize
+	if start > len(all) {
+		start = len(all)
+	}
+	if end > len(all) {
+		end = len(all)
+	}
+	var next *string
+	if end < len(all) {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(number+1))
+		link := s.PublicURL + r.URL.Path + "?" + query.Encode()
+		next = &link
+	}
+	json.NewEncoder(w).Encode(map[string]any{"count": len(all), "next": next, "results": all[start:end]})
+}
+
+func (s *Server) group(id string) *oncall.AlertGroup {
+	for i := range s.groups {
+		if s.groups[i].ID == id {
+			return &s.groups[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) addGroup(integrationID, title, state string) *oncall.AlertGroup {
+	now := time.Now()
+	s.lastID++
+	s.groups = append(s.groups, oncall.AlertGroup{ID: "I" + strconv.Itoa(s.lastID), IntegrationID: integrationID, Title: title, State: state, CreatedAt: &now})
+	return &s.groups[len(s.groups)-1]
+}
+
+// integrationID returns id of integration with token, integration is created if it doesn't exist
+func (s *Server) integrationID(token string) string {
+	if token == "" {
+		return ""
+	}
+	if _, ok := s.integrations[token]; !ok {
+		s.lastID++
+		s.integrations[token] = "C" + strconv.Itoa(s.lastID)
+	}
+	return s.integrations[token]
+}
+
+func (s *Server) addAlert(group *oncall.AlertGroup, payload json.RawMessage) {
+	s.lastID++
+	s.alerts = append(s.alerts, oncall.Alert{ID: "A" + strconv.Itoa(s.lastID), AlertGroupID: group.ID, CreatedAt: time.Now(), Payload: payload})
+	group.AlertsCount++
+}
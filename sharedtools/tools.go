@@ -3,6 +3,7 @@ package sharedtools
 import (
 	"bytes"
 	"fmt"
+	htmltemplate "html/template"
 	"io"
 	"net/http"
 	"sort"
@@ -36,6 +37,15 @@ type Alert struct {
 	Title         string            `json:"title"`
 	LastSinkAt    time.Time         `json:"-"`
 	LastReceiveAt time.Time         `json:"-"`
+	AcceptedBy    []string          `json:"-"`
+	// FingerprintPolicy and FingerprintLabels describe how fingerprint was calculated, they are shown
+	// in buffer view only and are not sent to sinks
+	FingerprintPolicy string   `json:"-"`
+	FingerprintLabels []string `json:"-"`
+	// SinkState is state of alert group in sinks and SilencedBy is sink which silenced alert locally,
+	// they are synced back from sinks and are not sent to them
+	SinkState  string `json:"-"`
+	SilencedBy string `json:"-"`
 }
 
 type AlertsSlice []Alert
@@ -70,6 +80,30 @@ func TemplateString(tpl string, variables any) (string, error) {
 	return parsedValue.String(), nil
 }
 
+// MustHTMLTemplateString is MustTemplateString for html, values are escaped so they can't break markup
+func MustHTMLTemplateString(tpl string, variables any, onerror string) string {
+	parsedValue, err := HTMLTemplateString(tpl, variables)
+	if err != nil {
+		return onerror
+	}
+	return parsedValue
+}
+
+func HTMLTemplateString(tpl string, variables any) (string, error) {
+	parsedtemplate, err := htmltemplate.New("value").Funcs(sprig.HtmlFuncMap()).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		zap.S().Errorf("template error:", err)
+		return "", err
+	}
+
+	parsedValue := new(bytes.Buffer)
+	if err := parsedtemplate.Execute(parsedValue, variables); err != nil && !strings.Contains(err.Error(), "map has no entry for key") {
+		zap.S().Errorf("template error:", err)
+		return "", err
+	}
+	return parsedValue.String(), nil
+}
+
 func LabelSetToFingerprint(labels map[string]string) string {
 	if len(labels) == 0 {
 		return fmt.Sprintf("%016x", uint64(offset64))
@@ -132,6 +166,12 @@ func CopyAlert(alert *Alert) Alert {
 		Fingerprint:   alert.Fingerprint,
 		LastSinkAt:    alert.LastSinkAt,
 		LastReceiveAt: alert.LastReceiveAt,
+		AcceptedBy:    append([]string(nil), alert.AcceptedBy...),
+
+		FingerprintPolicy: alert.FingerprintPolicy,
+		FingerprintLabels: append([]string(nil), alert.FingerprintLabels...),
+		SinkState:         alert.SinkState,
+		SilencedBy:        alert.SilencedBy,
 	}
 }
 
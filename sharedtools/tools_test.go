@@ -256,6 +256,21 @@ func TestMustTemplateString(t *testing.T) {
 	})
 }
 
+func TestMustHTMLTemplateString(t *testing.T) {
+	variables := struct{ Name string }{Name: `<script>&"John"`}
+	tests := map[string]string{
+		"<b>Hello {{ .Name }}</b>": "<b>Hello &lt;script&gt;&amp;&#34;John&#34;</b>",
+		// html function doesn't escape values twice
+		"<b>{{ html .Name }}</b>": "<b>&lt;script&gt;&amp;&#34;John&#34;</b>",
+		"{{ .Missing }}":          "error",
+	}
+	for tpl, expected := range tests {
+		if result := MustHTMLTemplateString(tpl, variables, "error"); result != expected {
+			t.Errorf("Expected '%s' for %s, got %s", expected, tpl, result)
+		}
+	}
+}
+
 func TestCopyAlert(t *testing.T) {
 	alert := &Alert{
 		Status:       "firing",